@@ -0,0 +1,202 @@
+package crudley
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// linkNames names the routes of a Path in an APIResource's links
+var linkNames = map[string]string{
+	"/":                    "collection",
+	"/{id}":                "item",
+	"/_schema":             "schema",
+	"/_openapi.json":       "openapi",
+	"/_batch":              "batch",
+	"/_changes":            "changes",
+	"/_live":               "live",
+	"/{id}/_history":       "history",
+	"/{id}/_history/{rev}": "revision",
+	"/{id}/_restore":       "restore",
+}
+
+// API serves the Paths of many Models under a common prefix, each mounted under
+// its own path. The API's index lists the resources it serves, and the OpenAPI
+// document describing all of them is served at /_openapi.json:
+//
+//	api := crudley.NewAPI("/api")
+//	api.Register(&Incident{}, s)
+//	api.RegisterAt("/people", &User{}, s, crudley.OptionReadOnly)
+//	api.MountServeMux(http.DefaultServeMux)
+//
+// API is an http.Handler for requests to its full path, so it can also be
+// mounted by other routers under its prefix, see muxrouter.MountAPI.
+type API struct {
+	Prefix string
+	Info   OpenAPIInfo
+
+	resources []apiResource
+}
+
+type apiResource struct {
+	path string
+	p    *Path
+}
+
+// NewAPI returns an API serving its resources under prefix, such as /api
+func NewAPI(prefix string) *API {
+	return &API{
+		Prefix: "/" + strings.Trim(prefix, "/"),
+		Info:   OpenAPIInfo{Title: "crudley", Version: "1.0.0"},
+	}
+}
+
+// Register creates a Path for m from s and opts, serving it under the API's
+// prefix followed by the Model's name
+func (a *API) Register(m Model, s Store, opts ...Option) *Path {
+	return a.RegisterAt("/"+m.GetName(), m, s, opts...)
+}
+
+// RegisterAt creates a Path for m from s and opts, serving it under the API's
+// prefix followed by path
+func (a *API) RegisterAt(path string, m Model, s Store, opts ...Option) *Path {
+	p := NewPath(m, s, opts...)
+	a.resources = append(a.resources, apiResource{path: "/" + strings.Trim(path, "/"), p: p})
+	return p
+}
+
+// MountServeMux serves the API from m
+func (a *API) MountServeMux(m *http.ServeMux) {
+	m.Handle(a.root()+"/", a)
+}
+
+// root is the prefix without a trailing slash, so that "/" is the empty string
+func (a *API) root() string {
+	return strings.TrimSuffix(a.Prefix, "/")
+}
+
+// ServeHTTP routes requests to the Path of the resource they are for, with the
+// API's prefix and the resource's path stripped
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, a.root()) {
+		a.notFound(w)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, a.root())
+	switch rest {
+	case "", "/":
+		a.Index(w, r)
+		return
+	case openAPIPath:
+		a.OpenAPI(w, r)
+		return
+	}
+	var match *apiResource
+	for i, res := range a.resources {
+		if rest != res.path && !strings.HasPrefix(rest, res.path+"/") {
+			continue
+		}
+		// the longest path matches, so resources can be nested
+		if match == nil || len(res.path) > len(match.path) {
+			match = &a.resources[i]
+		}
+	}
+	if match == nil {
+		a.notFound(w)
+		return
+	}
+	if rest == match.path {
+		// the resource's path without a trailing slash is its collection
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = a.root() + match.path + "/"
+		r2.URL.RawPath = ""
+		r = r2
+	}
+	http.StripPrefix(a.root()+match.path, match.p).ServeHTTP(w, r)
+}
+
+func (a *API) notFound(w http.ResponseWriter) {
+	res := &Response{}
+	res.AddError(ErrorResourceNotFound)
+	res.SetStatusCode(http.StatusNotFound)
+	WriteResponse(w, res)
+}
+
+// APIIndex lists the resources served by an API
+type APIIndex struct {
+	Resources []APIResource `json:"resources"`
+	Links     APILinks      `json:"links"`
+}
+
+// APIResource describes one of the Paths served by an API, its links and
+// methods are keyed by the name of the route, such as collection or item
+type APIResource struct {
+	Name    string              `json:"name"`
+	Links   APILinks            `json:"links"`
+	Methods map[string][]string `json:"methods"`
+	Schema  *Schema             `json:"schema"`
+}
+
+// APILinks are the URL paths of an API's routes, keyed by name
+type APILinks map[string]string
+
+// Index is the http handler listing the API's resources
+func (a *API) Index(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		res := &Response{}
+		res.AddError(ErrorMethodNotAllowed)
+		res.SetStatusCode(http.StatusMethodNotAllowed)
+		WriteResponse(w, res)
+		return
+	}
+	index := APIIndex{
+		Resources: make([]APIResource, 0, len(a.resources)),
+		Links: APILinks{
+			"self":    a.root() + "/",
+			"openapi": a.root() + openAPIPath,
+		},
+	}
+	for _, res := range a.resources {
+		index.Resources = append(index.Resources, a.describe(res))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(index)
+}
+
+func (a *API) describe(res apiResource) APIResource {
+	out := APIResource{
+		Name:    res.p.Model.GetName(),
+		Links:   make(APILinks),
+		Methods: make(map[string][]string),
+		Schema:  res.p.schema,
+	}
+	for _, rt := range res.p.routes {
+		name, ok := linkNames[rt.path]
+		if !ok {
+			name = rt.path
+		}
+		out.Links[name] = a.root() + res.path + rt.path
+		out.Methods[name] = append(out.Methods[name], rt.method)
+	}
+	for _, methods := range out.Methods {
+		sort.Strings(methods)
+	}
+	return out
+}
+
+// OpenAPI is the http handler serving the OpenAPI document describing all of the
+// API's resources
+func (a *API) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	paths := make(map[string]*Path, len(a.resources))
+	for _, res := range a.resources {
+		paths[a.root()+res.path] = res.p
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OpenAPI(a.Info, paths))
+}
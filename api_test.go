@@ -0,0 +1,120 @@
+package crudley_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+func setUpAPI() *crudley.API {
+	s := mem.NewStore()
+	api := crudley.NewAPI("/api/")
+	api.Register(&model.TestModel{}, s)
+	api.RegisterAt("/accounts", &account{}, s, crudley.OptionReadOnly)
+	return api
+}
+
+func TestAPIIndex(t *testing.T) {
+	s := httptest.NewServer(setUpAPI())
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "/api")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	defer res.Body.Close()
+	var index crudley.APIIndex
+	err = json.NewDecoder(res.Body).Decode(&index)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if len(index.Resources) != 2 {
+		t.Fatalf("expected 2 resources, got %+v", index.Resources)
+	}
+	test, accounts := index.Resources[0], index.Resources[1]
+	if test.Name != "testmodel" || test.Links["item"] != "/api/testmodel/{id}" || test.Links["schema"] != "/api/testmodel/_schema" {
+		t.Errorf("expected testmodel links, got %+v", test)
+	}
+	if !reflect.DeepEqual(test.Methods["collection"], []string{"GET", "POST"}) || !reflect.DeepEqual(test.Methods["item"], []string{"DELETE", "GET", "PUT"}) {
+		t.Errorf("expected read write methods, got %v", test.Methods)
+	}
+	if test.Schema == nil || test.Schema.Properties["string_val"] == nil {
+		t.Errorf("expected testmodel schema, got %+v", test.Schema)
+	}
+	if accounts.Links["collection"] != "/api/accounts/" || !reflect.DeepEqual(accounts.Methods["collection"], []string{"GET"}) {
+		t.Errorf("expected read only accounts, got %+v", accounts)
+	}
+	if _, ok := accounts.Links["batch"]; ok {
+		t.Errorf("expected no batch link for a read only resource")
+	}
+	if index.Links["openapi"] != "/api/_openapi.json" {
+		t.Errorf("expected openapi link, got %v", index.Links)
+	}
+
+	res, err = http.Get(s.URL + "/api/_openapi.json")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	defer res.Body.Close()
+	var doc crudley.OpenAPIDocument
+	err = json.NewDecoder(res.Body).Decode(&doc)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if doc.Paths["/api/testmodel/{id}"]["get"] == nil || doc.Paths["/api/accounts/"]["get"] == nil {
+		t.Errorf("expected both resources, got %v", doc.Paths)
+	}
+}
+
+func TestAPIMount(t *testing.T) {
+	sm := http.NewServeMux()
+	setUpAPI().MountServeMux(sm)
+
+	for name, h := range map[string]http.Handler{"ServeMux": sm, "API": setUpAPI()} {
+		s := httptest.NewServer(h)
+		res, err := http.Post(s.URL+"/api/testmodel/", "application/json", strings.NewReader(`{"string_val": "mounted"}`))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		var out model.TestModelResponse
+		json.NewDecoder(res.Body).Decode(&out)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || len(out.Results) != 1 {
+			t.Fatalf("%s: expected 200, got %v %s", name, res.StatusCode, out.Error)
+		}
+
+		for path, code := range map[string]int{
+			"/api/testmodel/" + out.Results[0].ID: http.StatusOK,
+			"/api/accounts/":                      http.StatusOK,
+			"/api/":                               http.StatusOK,
+			"/api/unknown/":                       http.StatusNotFound,
+			"/api/testmodel":                      http.StatusOK,
+			"/api/testmodelx":                     http.StatusNotFound,
+		} {
+			res, err := http.Get(s.URL + path)
+			if err != nil {
+				t.Fatalf("expected nil, got %s", err)
+			}
+			res.Body.Close()
+			if res.StatusCode != code {
+				t.Errorf("%s: expected %v for %s, got %v", name, code, path, res.StatusCode)
+			}
+		}
+		res, err = http.Post(s.URL+"/api/", "application/json", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("%s: expected 405, got %v", name, res.StatusCode)
+		}
+		s.Close()
+	}
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/arussellsaw/crudley"
+)
+
+// APIKeyPrefix starts every API key, to make them easy to recognise
+const APIKeyPrefix = "ck_"
+
+// APIKey is a stored API key. Only the hash of the key is stored, as its ID, so
+// keys can be looked up but not recovered from the Store.
+type APIKey struct {
+	ID          string    `json:"id" bson:"_id" firestore:"id"`
+	Name        string    `json:"name" bson:"name" firestore:"name"`
+	PrincipalID string    `json:"principal_id" bson:"principal_id" firestore:"principal_id"`
+	Roles       []string  `json:"roles" bson:"roles" firestore:"roles"`
+	Tenant      string    `json:"tenant" bson:"tenant" firestore:"tenant"`
+	Created     time.Time `json:"created" bson:"created" firestore:"created"`
+	// Expires is when the key stops working, if set
+	Expires time.Time `json:"expires" bson:"expires" firestore:"expires"`
+	Deleted bool      `json:"deleted" bson:"deleted" firestore:"deleted"`
+}
+
+// New returns an empty APIKey with the ID
+func (k *APIKey) New(id string) crudley.Model {
+	return &APIKey{ID: id}
+}
+
+// GetName returns the collection name APIKeys are stored in
+func (k *APIKey) GetName() string {
+	return "api_keys"
+}
+
+// PrimaryKey returns the APIKey's ID
+func (k *APIKey) PrimaryKey() string {
+	return k.ID
+}
+
+// Delete marks the APIKey as deleted, revoking it
+func (k *APIKey) Delete() {
+	k.Deleted = true
+}
+
+// IsDeleted returns true if the APIKey is revoked
+func (k *APIKey) IsDeleted() bool {
+	return k.Deleted
+}
+
+// HashAPIKey returns the ID of the APIKey for key. API keys are random, so a
+// fast hash is enough to protect them, and allows them to be looked up by ID.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeys authenticates requests with an API key in Header, looked up in Store
+type APIKeys struct {
+	Store  crudley.Store
+	Header string
+}
+
+// NewAPIKeys returns an APIKeys Authenticator that reads keys from the X-API-Key
+// header
+func NewAPIKeys(s crudley.Store) *APIKeys {
+	return &APIKeys{Store: s, Header: "X-API-Key"}
+}
+
+// Create generates a new API key for k's principal, saving k with the key's
+// hash as its ID. The key is only available from the return value.
+func (a *APIKeys) Create(ctx context.Context, k *APIKey) (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	c, err := a.Store.Collection(k)
+	if err != nil {
+		return "", err
+	}
+	ic, ok := c.(crudley.IDCreater)
+	if !ok {
+		return "", crudley.ErrorClientIDUnsupported
+	}
+	err = ic.CreateWithID(ctx, HashAPIKey(key), func(id string) (crudley.Model, error) {
+		k.ID = id
+		if k.Created.IsZero() {
+			k.Created = time.Now()
+		}
+		return k, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Revoke deletes the APIKey with the ID, see HashAPIKey
+func (a *APIKeys) Revoke(ctx context.Context, id string) error {
+	c, err := a.Store.Collection(&APIKey{})
+	if err != nil {
+		return err
+	}
+	return c.Delete(ctx, id)
+}
+
+// Authenticate implements Authenticator
+func (a *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(a.Header)
+	if key == "" {
+		return nil, ErrorNoCredentials
+	}
+	c, err := a.Store.Collection(&APIKey{})
+	if err != nil {
+		return nil, err
+	}
+	m, err := c.View(r.Context(), HashAPIKey(key))
+	if _, notFound := err.(crudley.NotFoundError); err != nil && !notFound {
+		return nil, err
+	}
+	k, ok := m.(*APIKey)
+	if !ok || k.Deleted || (!k.Expires.IsZero() && time.Now().After(k.Expires)) {
+		return nil, ErrorInvalidAPIKey
+	}
+	return &Principal{ID: k.PrincipalID, Roles: k.Roles, Tenant: k.Tenant}, nil
+}
@@ -0,0 +1,110 @@
+// Package auth authenticates requests to crudley Paths with JWTs or API keys,
+// and puts the authenticated Principal on the request context, where it is
+// available to Authorisers as Action.Principal, to field permissions as its
+// roles, and to tenant scoping with crudley.TenantOfPrincipal:
+//
+//	p := crudley.NewPath(m, s,
+//		auth.Authenticate(auth.NewJWT(auth.HS256(secret)), auth.NewAPIKeys(s)),
+//		crudley.OptionTenant(crudley.TenantOfPrincipal, "owner"),
+//	)
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/arussellsaw/crudley"
+)
+
+var (
+	// ErrorNoCredentials is returned when a request has no token or API key
+	ErrorNoCredentials = errors.New("no credentials")
+	// ErrorInvalidToken is returned for tokens that are malformed, have an
+	// unknown key or algorithm, or fail verification
+	ErrorInvalidToken = errors.New("invalid token")
+	// ErrorTokenExpired is returned for tokens that have expired, or aren't valid
+	// yet
+	ErrorTokenExpired = errors.New("token expired")
+	// ErrorInvalidAPIKey is returned for unknown, revoked or expired API keys
+	ErrorInvalidAPIKey = errors.New("invalid API key")
+)
+
+// Principal is an authenticated user or service
+type Principal struct {
+	ID     string                 `json:"id"`
+	Roles  []string               `json:"roles"`
+	Tenant string                 `json:"tenant"`
+	Claims map[string]interface{} `json:"claims,omitempty"`
+}
+
+// PrincipalID implements crudley.Principal
+func (p *Principal) PrincipalID() string {
+	return p.ID
+}
+
+// PrincipalRoles returns the Principal's roles
+func (p *Principal) PrincipalRoles() []string {
+	return p.Roles
+}
+
+// PrincipalTenant implements crudley.TenantPrincipal
+func (p *Principal) PrincipalTenant() string {
+	return p.Tenant
+}
+
+// FromContext returns the Principal authenticated for a request, or nil
+func FromContext(ctx context.Context) *Principal {
+	p, _ := crudley.PrincipalFromContext(ctx).(*Principal)
+	return p
+}
+
+// Authenticator authenticates a request, returning ErrorNoCredentials if it has
+// none of the credentials the Authenticator checks
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthenticatorFunc is a func that implements Authenticator
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+// Authenticate calls fn
+func (fn AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return fn(r)
+}
+
+// Resolver returns a PrincipalResolver that tries each Authenticator in turn,
+// until one finds credentials on the request
+func Resolver(authenticators ...Authenticator) crudley.PrincipalResolver {
+	return func(r *http.Request) (crudley.Principal, error) {
+		for _, a := range authenticators {
+			p, err := a.Authenticate(r)
+			if err == ErrorNoCredentials {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			return p, nil
+		}
+		return nil, ErrorNoCredentials
+	}
+}
+
+// Roles is a RoleResolver that returns the roles of the request's Principal
+func Roles(r *http.Request) []string {
+	p := FromContext(r.Context())
+	if p == nil {
+		return nil
+	}
+	return p.Roles
+}
+
+// Authenticate requires requests to the Path to be authenticated by one of
+// authenticators, and sets the Principal and its roles on their context
+func Authenticate(authenticators ...Authenticator) crudley.Option {
+	return func(p *crudley.Path) {
+		crudley.OptionPrincipal(Resolver(authenticators...))(p)
+		crudley.OptionRoles(Roles)(p)
+	}
+}
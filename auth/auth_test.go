@@ -0,0 +1,225 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/auth"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+func encode(v interface{}) string {
+	buf, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func signHS256(secret []byte, header, claims map[string]interface{}) string {
+	signed := encode(header) + "." + encode(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(key *rsa.PrivateKey, header, claims map[string]interface{}) string {
+	signed := encode(header) + "." + encode(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWT(t *testing.T) {
+	secret := []byte("secret")
+	j := auth.NewJWT(auth.HS256(secret))
+	j.Issuer = "crudley"
+	hs256 := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	claims := map[string]interface{}{
+		"sub":    "alice",
+		"iss":    "crudley",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"roles":  []string{"editor"},
+		"tenant": "a",
+	}
+
+	p, err := j.Verify(signHS256(secret, hs256, claims))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if p.ID != "alice" || p.Tenant != "a" || !reflect.DeepEqual(p.Roles, []string{"editor"}) {
+		t.Errorf("expected alice, got %+v", p)
+	}
+
+	expired := map[string]interface{}{"sub": "alice", "iss": "crudley", "exp": time.Now().Add(-time.Hour).Unix()}
+	wrongIssuer := map[string]interface{}{"sub": "alice", "iss": "other"}
+	for name, token := range map[string]string{
+		"wrong secret": signHS256([]byte("wrong"), hs256, claims),
+		"alg none":     encode(map[string]interface{}{"alg": "none"}) + "." + encode(claims) + ".",
+		"malformed":    "not.a.jwt",
+		"wrong issuer": signHS256(secret, hs256, wrongIssuer),
+	} {
+		if _, err := j.Verify(token); err != auth.ErrorInvalidToken {
+			t.Errorf("expected %s for %s, got %v", auth.ErrorInvalidToken, name, err)
+		}
+	}
+	if _, err := j.Verify(signHS256(secret, hs256, expired)); err != auth.ErrorTokenExpired {
+		t.Errorf("expected %s, got %v", auth.ErrorTokenExpired, err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	jwks := fmt.Sprintf(`{"keys": [{"kty": "RSA", "kid": "1", "alg": "RS256", "use": "sig", "n": %q, "e": %q}, {"kty": "EC", "kid": "2"}]}`,
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	)
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "jwks.json")
+	err = ioutil.WriteFile(filename, []byte(jwks), 0600)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	keys, err := auth.LoadJWKS(filename)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 key, got %v", len(keys))
+	}
+	j := auth.NewJWT(keys...)
+
+	claims := map[string]interface{}{"sub": "bob", "roles": "admin auditor"}
+	p, err := j.Verify(signRS256(key, map[string]interface{}{"alg": "RS256", "kid": "1"}, claims))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if p.ID != "bob" || !reflect.DeepEqual(p.Roles, []string{"admin", "auditor"}) {
+		t.Errorf("expected bob, got %+v", p)
+	}
+	_, err = j.Verify(signRS256(key, map[string]interface{}{"alg": "RS256", "kid": "2"}, claims))
+	if err != auth.ErrorInvalidToken {
+		t.Errorf("expected %s, got %v", auth.ErrorInvalidToken, err)
+	}
+	// the RSA public key can't be used as an HMAC secret
+	_, err = j.Verify(signHS256(key.N.Bytes(), map[string]interface{}{"alg": "HS256", "kid": "1"}, claims))
+	if err != auth.ErrorInvalidToken {
+		t.Errorf("expected %s, got %v", auth.ErrorInvalidToken, err)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	keys := auth.NewAPIKeys(mem.NewStore())
+	key, err := keys.Create(context.Background(), &auth.APIKey{Name: "ci", PrincipalID: "ci", Roles: []string{"deployer"}})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+
+	authenticate := func(key string) (*auth.Principal, error) {
+		r := httptest.NewRequest("GET", "/", nil)
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		return keys.Authenticate(r)
+	}
+	p, err := authenticate(key)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if p.ID != "ci" || !reflect.DeepEqual(p.Roles, []string{"deployer"}) {
+		t.Errorf("expected ci, got %+v", p)
+	}
+	if _, err := authenticate(""); err != auth.ErrorNoCredentials {
+		t.Errorf("expected %s, got %v", auth.ErrorNoCredentials, err)
+	}
+	if _, err := authenticate(key + "x"); err != auth.ErrorInvalidAPIKey {
+		t.Errorf("expected %s, got %v", auth.ErrorInvalidAPIKey, err)
+	}
+
+	err = keys.Revoke(context.Background(), auth.HashAPIKey(key))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if _, err := authenticate(key); err != auth.ErrorInvalidAPIKey {
+		t.Errorf("expected %s, got %v", auth.ErrorInvalidAPIKey, err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := mem.NewStore()
+	secret := []byte("secret")
+	keys := auth.NewAPIKeys(mem.NewStore())
+	key, err := keys.Create(context.Background(), &auth.APIKey{PrincipalID: "ci", Tenant: "b"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	var principals []crudley.Principal
+	model.AuthoriseFunc = func(ctx context.Context, action crudley.Action, m *model.TestModel) error {
+		principals = append(principals, action.Principal)
+		return nil
+	}
+	defer func() { model.AuthoriseFunc = nil }()
+
+	p := crudley.NewPath(&model.TestModel{}, s,
+		auth.Authenticate(auth.NewJWT(auth.HS256(secret)), keys),
+		crudley.OptionTenant(crudley.TenantOfPrincipal, "owner"),
+	)
+	api := httptest.NewServer(http.StripPrefix("/api/test", p))
+	defer api.Close()
+
+	do := func(method string, header http.Header, body string) (int, []*model.TestModel) {
+		req, err := http.NewRequest(method, api.URL+"/api/test/", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		req.Header = header
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		defer res.Body.Close()
+		var tmr model.TestModelResponse
+		json.NewDecoder(res.Body).Decode(&tmr)
+		return res.StatusCode, tmr.Results
+	}
+
+	code, _ := do("GET", http.Header{}, "")
+	if code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %v", code)
+	}
+	token := signHS256(secret, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "alice", "tenant": "a"})
+	code, res := do("POST", http.Header{"Authorization": {"Bearer " + token}}, `{"string_val": "foo"}`)
+	if code != http.StatusOK || len(res) != 1 || res[0].Owner != "a" {
+		t.Fatalf("expected a's model, got %v %+v", code, res)
+	}
+	if len(principals) == 0 || principals[0].PrincipalID() != "alice" {
+		t.Errorf("expected alice, got %v", principals)
+	}
+	code, res = do("GET", http.Header{"X-Api-Key": {key}}, "")
+	if code != http.StatusOK || len(res) != 0 {
+		t.Errorf("expected no models for b, got %v %+v", code, res)
+	}
+}
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Supported JWT signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+)
+
+// Key verifies the signatures of JWTs
+type Key struct {
+	// ID is matched against the kid header of tokens, if both are set
+	ID        string
+	Algorithm string
+	// Secret is the key for HS256
+	Secret []byte
+	// PublicKey is the key for RS256
+	PublicKey *rsa.PublicKey
+}
+
+// HS256 returns a Key for tokens signed with HMAC SHA-256 and secret
+func HS256(secret []byte) Key {
+	return Key{Algorithm: AlgorithmHS256, Secret: secret}
+}
+
+// RS256 returns a Key for tokens signed with RSA SHA-256 and the private key of
+// pub
+func RS256(pub *rsa.PublicKey) Key {
+	return Key{Algorithm: AlgorithmRS256, PublicKey: pub}
+}
+
+// RS256PEM returns a Key for tokens signed with RSA SHA-256, from a PEM encoded
+// public key
+func RS256PEM(buf []byte) (Key, error) {
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return Key{}, errors.New("no PEM data")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return Key{}, err
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return Key{}, fmt.Errorf("expected an RSA public key, got %T", pub)
+	}
+	return RS256(rsaPub), nil
+}
+
+func (k Key) verify(signed, sig []byte) bool {
+	switch k.Algorithm {
+	case AlgorithmHS256:
+		if len(k.Secret) == 0 {
+			return false
+		}
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), sig)
+	case AlgorithmRS256:
+		if k.PublicKey == nil {
+			return false
+		}
+		sum := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(k.PublicKey, crypto.SHA256, sum[:], sig) == nil
+	}
+	return false
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// ParseJWKS parses the signing keys of a JSON Web Key Set, skipping keys of
+// unsupported types
+func ParseJWKS(buf []byte) ([]Key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := json.Unmarshal(buf, &set)
+	if err != nil {
+		return nil, err
+	}
+	var keys []Key
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "oct":
+			if k.Alg != "" && k.Alg != AlgorithmHS256 {
+				continue
+			}
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %s: %s", k.Kid, err)
+			}
+			key := HS256(secret)
+			key.ID = k.Kid
+			keys = append(keys, key)
+		case "RSA":
+			if k.Alg != "" && k.Alg != AlgorithmRS256 {
+				continue
+			}
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %s: %s", k.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %s: %s", k.Kid, err)
+			}
+			key := RS256(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())})
+			key.ID = k.Kid
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// LoadJWKS reads a JSON Web Key Set from a file
+func LoadJWKS(filename string) ([]Key, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(buf)
+}
+
+// JWT authenticates requests with a bearer token in the Authorization header.
+// The token's sub claim is the Principal's ID, and its roles and tenant are read
+// from the RolesClaim and TenantClaim.
+type JWT struct {
+	Keys []Key
+	// Issuer and Audience are checked against the iss and aud claims, if set
+	Issuer   string
+	Audience string
+	// Leeway allows for clock skew when checking the exp and nbf claims
+	Leeway time.Duration
+	// RolesClaim is a list of roles, or a string of roles separated by spaces
+	RolesClaim  string
+	TenantClaim string
+}
+
+// NewJWT returns a JWT Authenticator that accepts tokens signed with any of keys
+func NewJWT(keys ...Key) *JWT {
+	return &JWT{
+		Keys:        keys,
+		Leeway:      time.Minute,
+		RolesClaim:  "roles",
+		TenantClaim: "tenant",
+	}
+}
+
+// Authenticate implements Authenticator
+func (j *JWT) Authenticate(r *http.Request) (*Principal, error) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return nil, ErrorNoCredentials
+	}
+	return j.Verify(strings.TrimSpace(header[7:]))
+}
+
+// Verify verifies token, returning its Principal
+func (j *JWT) Verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrorInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrorInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrorInvalidToken
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range j.Keys {
+		// the key decides the algorithm, so a token can't choose a weaker one
+		if k.Algorithm != header.Alg || (k.ID != "" && header.Kid != "" && k.ID != header.Kid) {
+			continue
+		}
+		if k.verify(signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrorInvalidToken
+	}
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrorInvalidToken
+	}
+	if err := j.validate(claims); err != nil {
+		return nil, err
+	}
+	p := &Principal{Claims: claims}
+	p.ID, _ = claims["sub"].(string)
+	p.Tenant, _ = claims[j.TenantClaim].(string)
+	switch roles := claims[j.RolesClaim].(type) {
+	case string:
+		p.Roles = strings.Fields(roles)
+	case []interface{}:
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				p.Roles = append(p.Roles, s)
+			}
+		}
+	}
+	if p.ID == "" {
+		return nil, ErrorInvalidToken
+	}
+	return p, nil
+}
+
+func (j *JWT) validate(claims map[string]interface{}) error {
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok && now.Add(-j.Leeway).After(time.Unix(int64(exp), 0)) {
+		return ErrorTokenExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(j.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return ErrorTokenExpired
+	}
+	if j.Issuer != "" && claims["iss"] != j.Issuer {
+		return ErrorInvalidToken
+	}
+	if j.Audience == "" {
+		return nil
+	}
+	switch aud := claims["aud"].(type) {
+	case string:
+		if aud == j.Audience {
+			return nil
+		}
+	case []interface{}:
+		for _, a := range aud {
+			if a == j.Audience {
+				return nil
+			}
+		}
+	}
+	return ErrorInvalidToken
+}
+
+func decodeSegment(s string, v interface{}) error {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
@@ -0,0 +1,195 @@
+package crudley
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Batch operation types
+const (
+	BatchCreate  = "create"
+	BatchUpdate  = "update"
+	BatchDelete  = "delete"
+	BatchRestore = "restore"
+)
+
+var errBatchRolledBack = errors.New("rolled back")
+
+// BatchRequest is the body accepted by the batch endpoint. If Atomic is set then
+// either all of the operations are applied, or none are, this requires the Store
+// to implement Transactor.
+type BatchRequest struct {
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperation is a single create, update, delete or restore in a BatchRequest. Data is
+// decoded in the same way as the body of a POST or PUT request. Creates may set
+// an ID if the Store's Collection implements IDCreater.
+type BatchOperation struct {
+	Op   string          `json:"op"`
+	ID   string          `json:"id,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// BatchResult is the outcome of a single BatchOperation
+type BatchResult struct {
+	Op     string `json:"op"`
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Result Model  `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Batch handles applying multiple operations in a single request, the outcome of
+// each operation is added to the Response in the same order as the request
+func (p *Path) Batch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	c, res, err := p.initHandler(ctx)
+	if err != nil {
+		WriteResponse(w, res)
+		return
+	}
+	defer WriteResponse(w, res)
+
+	var req BatchRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		res.AddError(ErrorMalformedJSON)
+		res.SetStatusCode(http.StatusBadRequest)
+		return
+	}
+	if p.BatchLimit > 0 && len(req.Operations) > p.BatchLimit {
+		res.AddError(fmt.Errorf("batch exceeds limit of %v operations", p.BatchLimit))
+		res.SetStatusCode(http.StatusRequestEntityTooLarge)
+		return
+	}
+	// the batch as a whole is authorised before each of its operations
+	err = authorise(ctx, p.Model.New(""), Action{Method: http.MethodPost, Op: OpBatch, Request: r, Partial: true})
+	if err != nil {
+		res.AddError(err)
+		res.SetStatusCode(http.StatusUnauthorized)
+		return
+	}
+
+	if !req.Atomic {
+		for _, op := range req.Operations {
+			result := p.batchOperation(ctx, c, op)
+			p.emitBatchResult(ctx, result)
+			res.AddBatchResult(result)
+		}
+		return
+	}
+
+	var results []BatchResult
+	s, err := p.store(ctx)
+	if err != nil {
+		res.AddError(fmt.Errorf("failed to retrieve Store: %s", err.Error()))
+		res.SetStatusCode(http.StatusInternalServerError)
+		return
+	}
+	err = RunInTransaction(ctx, s, func(ctx context.Context, tx Store) error {
+		// the transaction may be retried, so discard any previous attempt
+		results = nil
+		c, err := p.collection(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, op := range req.Operations {
+			result := p.batchOperation(ctx, c, op)
+			results = append(results, result)
+			if result.Status >= http.StatusBadRequest {
+				return errBatchRolledBack
+			}
+		}
+		return nil
+	})
+	switch {
+	case err == ErrorTransactionsUnsupported:
+		res.AddError(err)
+		res.SetStatusCode(http.StatusBadRequest)
+		return
+	case err == errBatchRolledBack:
+		failed := len(results) - 1
+		res.AddError(fmt.Errorf("batch operation %v failed: %s", failed, results[failed].Error))
+		res.SetStatusCode(results[failed].Status)
+		for i := range results[:failed] {
+			results[i] = BatchResult{
+				Op:     results[i].Op,
+				ID:     results[i].ID,
+				Status: http.StatusFailedDependency,
+				Error:  errBatchRolledBack.Error(),
+			}
+		}
+		for _, op := range req.Operations[failed+1:] {
+			results = append(results, BatchResult{
+				Op:     op.Op,
+				ID:     op.ID,
+				Status: http.StatusFailedDependency,
+				Error:  "not attempted",
+			})
+		}
+	case err != nil:
+		res.AddError(fmt.Errorf("failed to run batch: %s", err.Error()))
+		res.SetStatusCode(http.StatusInternalServerError)
+		return
+	default:
+		for _, result := range results {
+			p.emitBatchResult(ctx, result)
+		}
+	}
+	res.AddBatchResult(results...)
+}
+
+// emitBatchResult notifies the Path's Observers of a successful operation
+func (p *Path) emitBatchResult(ctx context.Context, result BatchResult) {
+	if result.Result == nil {
+		return
+	}
+	switch {
+	case result.Op == BatchCreate, result.Status == http.StatusCreated:
+		p.emit(ctx, ChangeCreated, result.Result)
+	case result.Op == BatchDelete:
+		p.emit(ctx, ChangeDeleted, result.Result)
+	default:
+		p.emit(ctx, ChangeUpdated, result.Result)
+	}
+}
+
+func (p *Path) batchOperation(ctx context.Context, c Collection, op BatchOperation) BatchResult {
+	var (
+		m    Model
+		code int
+		err  error
+	)
+	switch op.Op {
+	case BatchCreate:
+		m, code, err = p.create(ctx, c, op.ID, op.Data)
+	case BatchUpdate, BatchDelete, BatchRestore:
+		if op.ID == "" {
+			code, err = http.StatusBadRequest, ErrorNoID
+			break
+		}
+		switch op.Op {
+		case BatchUpdate:
+			m, code, err = p.update(ctx, c, op.ID, op.Data)
+		case BatchDelete:
+			m, code, err = p.remove(ctx, c, op.ID)
+		case BatchRestore:
+			m, code, err = p.restore(ctx, c, op.ID)
+		}
+	default:
+		code, err = http.StatusBadRequest, fmt.Errorf("unknown batch operation %q", op.Op)
+	}
+	result := BatchResult{Op: op.Op, ID: op.ID, Status: code}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Result = m
+	result.ID = m.PrimaryKey()
+	return result
+}
@@ -0,0 +1,280 @@
+package crudley
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Change event types
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// DefaultChangeFeedSize is the number of events a ChangeFeed keeps for clients
+// resuming from a sequence number
+const DefaultChangeFeedSize = 1024
+
+// sseHeartbeat is how often an idle change stream sends a comment to keep the
+// connection open
+const sseHeartbeat = 15 * time.Second
+
+// ChangeEvent describes a mutation made to a Model through a Path. Seq is set
+// by the ChangeFeed and is increasing.
+type ChangeEvent struct {
+	Seq    uint64    `json:"seq"`
+	Tenant string    `json:"tenant,omitempty"`
+	Type   string    `json:"type"`
+	Model  string    `json:"model"`
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Data   Model     `json:"data"`
+}
+
+// Observer is notified of every successful mutation made through a Path
+type Observer interface {
+	Observe(ctx context.Context, ev ChangeEvent)
+}
+
+// ObserverFunc adapts a function to the Observer interface
+type ObserverFunc func(ctx context.Context, ev ChangeEvent)
+
+// Observe calls f
+func (f ObserverFunc) Observe(ctx context.Context, ev ChangeEvent) {
+	f(ctx, ev)
+}
+
+// OptionObserver adds an Observer to the Path
+func OptionObserver(o Observer) Option {
+	return func(p *Path) {
+		p.Observers = append(p.Observers, o)
+	}
+}
+
+// OptionChangeFeed publishes the Path's changes to f, and serves them as
+// Server-Sent Events from the _changes endpoint
+func OptionChangeFeed(f *ChangeFeed) Option {
+	return func(p *Path) {
+		p.ChangeFeed = f
+		p.Observers = append(p.Observers, f)
+	}
+}
+
+// emit notifies the Path's Observers of a change to m
+func (p *Path) emit(ctx context.Context, typ string, m Model) {
+	if len(p.Observers) == 0 {
+		return
+	}
+	ev := ChangeEvent{
+		Tenant: TenantFromContext(ctx),
+		Type:   typ,
+		Model:  p.Model.GetName(),
+		ID:     m.PrimaryKey(),
+		Time:   time.Now(),
+		Data:   m,
+	}
+	for _, o := range p.Observers {
+		o.Observe(ctx, ev)
+	}
+}
+
+// NewChangeFeed returns a ChangeFeed which keeps the last size events in memory
+func NewChangeFeed(size int) *ChangeFeed {
+	return &ChangeFeed{
+		size: size,
+		subs: make(map[chan ChangeEvent]struct{}),
+	}
+}
+
+// ChangeFeed is an Observer that sequences events and fans them out to
+// subscribers, keeping a window of recent events so that subscribers can resume
+// after disconnecting
+type ChangeFeed struct {
+	sync.Mutex
+	seq    uint64
+	size   int
+	events []ChangeEvent
+	subs   map[chan ChangeEvent]struct{}
+}
+
+// Observe assigns the event a sequence number and publishes it to subscribers.
+// Subscribers that aren't keeping up are disconnected, and can resume from the
+// last sequence number they received.
+func (f *ChangeFeed) Observe(ctx context.Context, ev ChangeEvent) {
+	f.Lock()
+	defer f.Unlock()
+	f.seq++
+	ev.Seq = f.seq
+	f.events = append(f.events, ev)
+	if len(f.events) > f.size {
+		f.events = f.events[len(f.events)-f.size:]
+	}
+	for ch := range f.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the retained events after sequence number since, and a
+// channel of events published from then on. Passing math.MaxUint64 subscribes
+// to new events only. The channel is closed when cancel
+// is called, or if the subscriber falls too far behind. ErrorChangesExpired is
+// returned if events after since are no longer retained.
+func (f *ChangeFeed) Subscribe(since uint64) ([]ChangeEvent, <-chan ChangeEvent, func(), error) {
+	f.Lock()
+	defer f.Unlock()
+	var backlog []ChangeEvent
+	if since < f.seq {
+		if len(f.events) == 0 || f.events[0].Seq > since+1 {
+			return nil, nil, nil, ErrorChangesExpired
+		}
+		for _, ev := range f.events {
+			if ev.Seq > since {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+	ch := make(chan ChangeEvent, 64)
+	f.subs[ch] = struct{}{}
+	cancel := func() {
+		f.Lock()
+		defer f.Unlock()
+		if _, ok := f.subs[ch]; ok {
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, cancel, nil
+}
+
+// Changes is the http handler streaming the Path's ChangeFeed as Server-Sent
+// Events. Clients resume from a sequence number with the Last-Event-ID header or
+// the since query parameter, and the remaining query parameters filter events in
+// the same way as they do for Query.
+func (p *Path) Changes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	params := r.URL.Query()
+	since := params.Get("since")
+	params.Del("since")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		since = id
+	}
+	var seq uint64 = math.MaxUint64
+	if since != "" {
+		var err error
+		seq, err = strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			res := &Response{}
+			res.AddError(fmt.Errorf("invalid sequence number: %s", since))
+			res.SetStatusCode(http.StatusBadRequest)
+			WriteResponse(w, res)
+			return
+		}
+	}
+
+	// filtering on fields the user can't read would reveal their values
+	err := checkQueryable(p.Model, params, RolesFromContext(ctx))
+	if err != nil {
+		res := &Response{}
+		res.AddError(err)
+		res.SetStatusCode(http.StatusBadRequest)
+		WriteResponse(w, res)
+		return
+	}
+	filter, err := NewFilter(ctx, p.Model, params)
+	if err != nil {
+		res := &Response{}
+		res.AddError(fmt.Errorf("failed to build Query: %s", err.Error()))
+		res.SetStatusCode(http.StatusBadRequest)
+		WriteResponse(w, res)
+		return
+	}
+
+	backlog, events, cancel, err := p.ChangeFeed.Subscribe(seq)
+	if err != nil {
+		res := &Response{}
+		res.AddError(err)
+		res.SetStatusCode(http.StatusGone)
+		WriteResponse(w, res)
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(ev ChangeEvent) error {
+		if !p.visible(ctx, filter, ev) {
+			return nil
+		}
+		ev.Data = redact(ev.Data, RolesFromContext(ctx))
+		buf, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %v\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, buf)
+		flusher.Flush()
+		return err
+	}
+	for _, ev := range backlog {
+		if err := send(ev); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := send(ev); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// visible returns true if the event is for the Path's Model, matches the filter
+// and may be read by the request. A ChangeFeed can be shared by many Paths, so
+// events for other Models are skipped.
+func (p *Path) visible(ctx context.Context, filter *Filter, ev ChangeEvent) bool {
+	if ev.Model != p.Model.GetName() {
+		return false
+	}
+	m := ev.Data
+	if p.Tenant != nil && ev.Tenant != TenantFromContext(ctx) {
+		return false
+	}
+	if !filter.Match(m) {
+		return false
+	}
+	return authorise(ctx, m, Action{Method: http.MethodGet, Op: OpList}) == nil
+}
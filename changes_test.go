@@ -0,0 +1,190 @@
+package crudley_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+func TestChangeFeedResume(t *testing.T) {
+	f := crudley.NewChangeFeed(2)
+	for i := 0; i < 3; i++ {
+		f.Observe(context.Background(), crudley.ChangeEvent{Type: crudley.ChangeCreated, ID: fmt.Sprint(i)})
+	}
+	backlog, _, cancel, err := f.Subscribe(1)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	cancel()
+	if len(backlog) != 2 || backlog[0].Seq != 2 || backlog[1].Seq != 3 {
+		t.Errorf("expected events 2 and 3, got %+v", backlog)
+	}
+	_, _, _, err = f.Subscribe(0)
+	if err != crudley.ErrorChangesExpired {
+		t.Errorf("expected %s, got %v", crudley.ErrorChangesExpired, err)
+	}
+	backlog, events, cancel, err := f.Subscribe(math.MaxUint64)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	defer cancel()
+	if len(backlog) != 0 {
+		t.Errorf("expected 0, got %v", len(backlog))
+	}
+	f.Observe(context.Background(), crudley.ChangeEvent{Type: crudley.ChangeUpdated, ID: "3"})
+	ev := <-events
+	if ev.Seq != 4 || ev.Type != crudley.ChangeUpdated {
+		t.Errorf("expected event 4, got %+v", ev)
+	}
+}
+
+type sseEvent struct {
+	id, event string
+	data      struct {
+		Seq   uint64          `json:"seq"`
+		Type  string          `json:"type"`
+		Model string          `json:"model"`
+		ID    string          `json:"id"`
+		Data  model.TestModel `json:"data"`
+	}
+}
+
+func readSSE(t *testing.T, r *bufio.Reader) sseEvent {
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && ev.id != "":
+			return ev
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			ev.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.data)
+			if err != nil {
+				t.Fatalf("expected nil, got %s", err)
+			}
+		}
+	}
+}
+
+func TestChangesSSE(t *testing.T) {
+	r := http.NewServeMux()
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore(), crudley.OptionChangeFeed(crudley.NewChangeFeed(crudley.DefaultChangeFeedSize)))
+	r.Handle("/api/test/", http.StripPrefix("/api/test", p))
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	res, err := http.Get(fmt.Sprintf("%s/api/test/_changes?owner=foo", s.URL))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %s", ct)
+	}
+	stream := bufio.NewReader(res.Body)
+
+	tmr, err := testHandler("POST", fmt.Sprintf("%s/api/test/", s.URL), bytes.NewBufferString(`{"string_val": "ignored", "owner": "bar"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	tmr, err = testHandler("POST", fmt.Sprintf("%s/api/test/", s.URL), bytes.NewBufferString(`{"string_val": "watched", "owner": "foo"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	mID := tmr.Results[0].ID
+	_, err = testHandler("DELETE", fmt.Sprintf("%s/api/test/%s", s.URL, mID), nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+
+	ev := readSSE(t, stream)
+	if ev.event != crudley.ChangeCreated || ev.id != "2" || ev.data.Data.StringVal != "watched" {
+		t.Errorf("expected created event 2 for watched, got %+v", ev)
+	}
+	ev = readSSE(t, stream)
+	if ev.event != crudley.ChangeDeleted || ev.id != "3" || ev.data.ID != mID {
+		t.Errorf("expected deleted event 3 for %s, got %+v", mID, ev)
+	}
+
+	// resume from the first event, which is filtered out
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/test/_changes?owner=foo", s.URL), nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	req.Header.Set("Last-Event-ID", "1")
+	res2, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	defer res2.Body.Close()
+	ev = readSSE(t, bufio.NewReader(res2.Body))
+	if ev.id != "2" {
+		t.Errorf("expected event 2, got %+v", ev)
+	}
+}
+
+func TestChangesUnreadableFilter(t *testing.T) {
+	p := crudley.NewPath(&account{}, mem.NewStore(), crudley.OptionChangeFeed(crudley.NewChangeFeed(crudley.DefaultChangeFeedSize)))
+	s := httptest.NewServer(p)
+	defer s.Close()
+
+	for _, query := range []string{"password=hunter2", "secret=s", "notes=n"} {
+		res, err := http.Get(s.URL + "/_changes?" + query)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %v", query, res.StatusCode)
+		}
+	}
+}
+
+func TestChangesSharedFeed(t *testing.T) {
+	feed := crudley.NewChangeFeed(crudley.DefaultChangeFeedSize)
+	store := mem.NewStore()
+	api := crudley.NewAPI("/api")
+	api.Register(&model.TestModel{}, store, crudley.OptionChangeFeed(feed))
+	api.Register(&account{}, store, crudley.OptionChangeFeed(feed))
+	s := httptest.NewServer(api)
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "/api/testmodel/_changes")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	defer res.Body.Close()
+	stream := bufio.NewReader(res.Body)
+
+	tmr, err := testHandler("POST", s.URL+"/api/accounts/", bytes.NewBufferString(`{"name": "other"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	tmr, err = testHandler("POST", s.URL+"/api/testmodel/", bytes.NewBufferString(`{"string_val": "watched"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+
+	ev := readSSE(t, stream)
+	if ev.id != "2" || ev.data.Model != "testmodel" || ev.data.Data.StringVal != "watched" {
+		t.Errorf("expected event 2 for watched, got %+v", ev)
+	}
+}
@@ -0,0 +1,371 @@
+// Package client is a typed Go client for crudley APIs. A Collection calls the
+// endpoints of a single Path, decoding the Response envelope into the Model's
+// type:
+//
+//	c := client.New("https://example.com", client.OptionHeader("Authorization", "Bearer "+token))
+//	users := client.NewCollection[*User](c, "/api/users")
+//	admins, err := users.List(ctx, client.NewQuery().Equal("role", "admin").Sort("-created"))
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Errors matching the status codes of failed requests, for use with errors.Is
+var (
+	ErrorBadRequest   = errors.New("bad request")
+	ErrorUnauthorized = errors.New("unauthorized")
+	ErrorForbidden    = errors.New("forbidden")
+	ErrorNotFound     = errors.New("not found")
+	ErrorConflict     = errors.New("conflict")
+)
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:   ErrorBadRequest,
+	http.StatusUnauthorized: ErrorUnauthorized,
+	http.StatusForbidden:    ErrorForbidden,
+	http.StatusNotFound:     ErrorNotFound,
+	http.StatusConflict:     ErrorConflict,
+}
+
+// Error is returned for responses with an error status code
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("%s: %s", http.StatusText(e.StatusCode), e.Message)
+}
+
+// Is reports whether target is the Error* var for the Error's status code
+func (e *Error) Is(target error) bool {
+	return statusErrors[e.StatusCode] == target
+}
+
+// Client makes requests to a crudley API
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Header is added to every request
+	Header http.Header
+}
+
+// Option configures a Client
+type Option func(c *Client)
+
+// OptionHTTPClient sets the http.Client used to make requests
+func OptionHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.HTTPClient = hc
+	}
+}
+
+// OptionHeader adds a header to every request, such as Authorization
+func OptionHeader(key, value string) Option {
+	return func(c *Client) {
+		c.Header.Add(key, value)
+	}
+}
+
+// New returns a Client for the API served at baseURL
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+		Header:     make(http.Header),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// envelope is the Response of a crudley Path
+type envelope[T any] struct {
+	Results []T              `json:"results"`
+	Batch   []batchResult[T] `json:"batch"`
+	Error   string           `json:"error"`
+}
+
+// batchResult is the outcome of a single batch operation
+type batchResult[T any] struct {
+	Status int    `json:"status"`
+	Result T      `json:"result"`
+	Error  string `json:"error"`
+}
+
+// do makes a request, decoding the results of the response
+func do[T any](ctx context.Context, c *Client, method, path string, params url.Values, body interface{}) ([]T, error) {
+	env, err := request[T](ctx, c, method, path, params, body)
+	if err != nil {
+		return nil, err
+	}
+	return env.Results, nil
+}
+
+// request makes a request, decoding the whole response envelope
+func request[T any](ctx context.Context, c *Client, method, path string, params url.Values, body interface{}) (*envelope[T], error) {
+	u := c.BaseURL + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	var r io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	for key, vals := range c.Header {
+		req.Header[key] = append(req.Header[key], vals...)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var env envelope[T]
+	decodeErr := json.NewDecoder(res.Body).Decode(&env)
+	if res.StatusCode >= http.StatusBadRequest {
+		return nil, &Error{StatusCode: res.StatusCode, Message: env.Error}
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to decode response: %s", decodeErr)
+	}
+	return &env, nil
+}
+
+// Collection is a typed client for the Models served by a Path. T is the type
+// the Models are decoded into, usually a pointer to a struct.
+type Collection[T any] struct {
+	client *Client
+	path   string
+}
+
+// NewCollection returns a Collection for the Path served under path
+func NewCollection[T any](c *Client, path string) *Collection[T] {
+	return &Collection[T]{client: c, path: "/" + strings.Trim(path, "/")}
+}
+
+func (c *Collection[T]) one(ctx context.Context, method, path string, params url.Values, body interface{}) (T, error) {
+	var zero T
+	results, err := do[T](ctx, c.client, method, c.path+path, params, body)
+	if err != nil {
+		return zero, err
+	}
+	if len(results) == 0 {
+		return zero, &Error{StatusCode: http.StatusNotFound}
+	}
+	return results[0], nil
+}
+
+func (c *Collection[T]) idPath(id string, suffix string) string {
+	return "/" + url.PathEscape(id) + suffix
+}
+
+// Get returns the Model with the ID
+func (c *Collection[T]) Get(ctx context.Context, id string) (T, error) {
+	return c.one(ctx, http.MethodGet, c.idPath(id, ""), nil, nil)
+}
+
+// List returns the Models matching q, which may be nil
+func (c *Collection[T]) List(ctx context.Context, q *Query) ([]T, error) {
+	return do[T](ctx, c.client, http.MethodGet, c.path+"/", q.Values(), nil)
+}
+
+// Create creates m, returning it as saved
+func (c *Collection[T]) Create(ctx context.Context, m T) (T, error) {
+	return c.one(ctx, http.MethodPost, "/", nil, m)
+}
+
+// CreateWithID creates m with the ID through the Path's batch endpoint, which
+// requires the Path's Store to support client IDs. If a Model with the ID
+// already exists the Error has StatusConflict.
+func (c *Collection[T]) CreateWithID(ctx context.Context, id string, m T) (T, error) {
+	var zero T
+	data, err := json.Marshal(m)
+	if err != nil {
+		return zero, err
+	}
+	body := map[string]interface{}{
+		"operations": []map[string]interface{}{
+			{"op": "create", "id": id, "data": json.RawMessage(data)},
+		},
+	}
+	env, err := request[T](ctx, c.client, http.MethodPost, c.path+"/_batch", nil, body)
+	if err != nil {
+		return zero, err
+	}
+	if len(env.Batch) == 0 {
+		return zero, fmt.Errorf("failed to decode response: no batch result")
+	}
+	result := env.Batch[0]
+	if result.Status >= http.StatusBadRequest {
+		return zero, &Error{StatusCode: result.Status, Message: result.Error}
+	}
+	return result.Result, nil
+}
+
+// Update sets all of the writable fields of the Model with the ID to those of m
+func (c *Collection[T]) Update(ctx context.Context, id string, m T) (T, error) {
+	return c.one(ctx, http.MethodPut, c.idPath(id, ""), nil, m)
+}
+
+// Patch sets only the fields of the Model with the ID in fields, by their json
+// names
+func (c *Collection[T]) Patch(ctx context.Context, id string, fields map[string]interface{}) (T, error) {
+	return c.one(ctx, http.MethodPut, c.idPath(id, ""), nil, fields)
+}
+
+// Delete deletes the Model with the ID, returning it
+func (c *Collection[T]) Delete(ctx context.Context, id string) (T, error) {
+	return c.one(ctx, http.MethodDelete, c.idPath(id, ""), nil, nil)
+}
+
+// Restore restores the deleted Model with the ID, returning it
+func (c *Collection[T]) Restore(ctx context.Context, id string) (T, error) {
+	return c.one(ctx, http.MethodPost, c.idPath(id, "/_restore"), nil, nil)
+}
+
+// Iterate returns an Iterator over all of the Models matching q, fetched a page
+// at a time. The page size is q's limit, or DefaultPageSize.
+func (c *Collection[T]) Iterate(q *Query) *Iterator[T] {
+	q = q.clone()
+	if q.limit <= 0 {
+		q.limit = DefaultPageSize
+	}
+	return &Iterator[T]{c: c, q: q, orig: q.clone()}
+}
+
+// DefaultPageSize is the number of Models fetched at a time by Iterators
+const DefaultPageSize = 100
+
+// Iterator pages through the results of a query
+//
+//	it := users.Iterate(q)
+//	for it.Next(ctx) {
+//		u := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//
+// If the query is sorted, each page after the first is fetched with a cursor,
+// the Models after the last sort value of the previous page, so Models created
+// or deleted while iterating don't cause others to be repeated or skipped. The
+// Models sharing the last sort value are skipped by offset, so sort on a field
+// that is unique, such as the ID, or nearly so. Unsorted queries and Models
+// that don't return the sort field are paged by offset.
+type Iterator[T any] struct {
+	c    *Collection[T]
+	q    *Query
+	page []T
+	i    int
+	done bool
+	err  error
+
+	// orig is the query being iterated, n the number of Models returned, and
+	// offset is set once a Model has no sort value to page from
+	orig   *Query
+	n      int
+	offset bool
+	// last is the sort value of the last Model returned, tail is the number of
+	// Models returned with it, and prev is the sort value before them
+	last, prev json.RawMessage
+	tail       int
+}
+
+// Next advances to the next Model, fetching the next page if needed. It returns
+// false at the end of the results, or if there is an error.
+func (it *Iterator[T]) Next(ctx context.Context) bool {
+	it.i++
+	if it.i < len(it.page) {
+		return true
+	}
+	if it.done || it.err != nil {
+		return false
+	}
+	it.page, it.err = it.c.List(ctx, it.q)
+	if it.err != nil {
+		return false
+	}
+	it.i = 0
+	it.n += len(it.page)
+	it.done = len(it.page) < it.q.limit
+	if !it.done {
+		it.advance()
+	}
+	return len(it.page) > 0
+}
+
+// advance sets the query for the page after it.page, with a cursor if the
+// query is sorted and offsets otherwise
+func (it *Iterator[T]) advance() {
+	field := strings.TrimPrefix(it.orig.sort, "-")
+	for _, m := range it.page {
+		if it.offset {
+			break
+		}
+		val, ok := sortValue(m, field)
+		if field == "" || !ok {
+			it.offset = true
+			break
+		}
+		if bytes.Equal(val, it.last) {
+			it.tail++
+			continue
+		}
+		it.prev, it.last, it.tail = it.last, val, 1
+	}
+	it.q = it.orig.clone()
+	if it.offset || it.prev == nil {
+		// the Models so far share a sort value, or can't be paged by it
+		it.q.skip += it.n
+		return
+	}
+	it.q.after(it.prev)
+	it.q.skip = it.tail
+}
+
+// sortValue returns the json value of m's field, which is false if m has no
+// such field
+func sortValue(m interface{}, field string) (json.RawMessage, bool) {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return nil, false
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(buf, &fields) != nil {
+		return nil, false
+	}
+	val, ok := fields[field]
+	return val, ok && string(val) != "null"
+}
+
+// Value returns the current Model
+func (it *Iterator[T]) Value() T {
+	return it.page[it.i]
+}
+
+// Err returns the error that stopped iteration, if any
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
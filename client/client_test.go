@@ -0,0 +1,191 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/client"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+func setUp() (*client.Collection[*model.TestModel], func()) {
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore())
+	mux := http.NewServeMux()
+	mux.Handle("/api/test/", http.StripPrefix("/api/test", p))
+	s := httptest.NewServer(mux)
+	c := client.New(s.URL, client.OptionHeader("X-Test", "1"))
+	return client.NewCollection[*model.TestModel](c, "/api/test"), s.Close
+}
+
+func TestCollection(t *testing.T) {
+	tests, done := setUp()
+	defer done()
+	ctx := context.Background()
+
+	m, err := tests.Create(ctx, &model.TestModel{StringVal: "foo", IntVal: 1})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if m.ID == "" || m.StringVal != "foo" {
+		t.Errorf("expected created model, got %+v", m)
+	}
+	got, err := tests.Get(ctx, m.ID)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("expected %+v, got %+v", m, got)
+	}
+
+	m.StringVal = "bar"
+	m, err = tests.Update(ctx, m.ID, m)
+	if err != nil || m.StringVal != "bar" {
+		t.Errorf("expected bar, got %+v, %v", m, err)
+	}
+	m, err = tests.Patch(ctx, m.ID, map[string]interface{}{"int_val": 2})
+	if err != nil || m.StringVal != "bar" || m.IntVal != 2 {
+		t.Errorf("expected patched model, got %+v, %v", m, err)
+	}
+
+	m, err = tests.Delete(ctx, m.ID)
+	if err != nil || !m.Deleted {
+		t.Errorf("expected deleted model, got %+v, %v", m, err)
+	}
+	_, err = tests.Get(ctx, m.ID)
+	if !errors.Is(err, client.ErrorNotFound) {
+		t.Errorf("expected %s, got %v", client.ErrorNotFound, err)
+	}
+	var cerr *client.Error
+	if !errors.As(err, &cerr) || cerr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a 404 Error, got %v", err)
+	}
+	m, err = tests.Restore(ctx, m.ID)
+	if err != nil || m.Deleted {
+		t.Errorf("expected restored model, got %+v, %v", m, err)
+	}
+
+	m, err = tests.CreateWithID(ctx, "natural-key", &model.TestModel{StringVal: "baz"})
+	if err != nil || m.ID != "natural-key" || m.StringVal != "baz" {
+		t.Errorf("expected natural-key, got %+v, %v", m, err)
+	}
+	_, err = tests.CreateWithID(ctx, "natural-key", &model.TestModel{})
+	if !errors.Is(err, client.ErrorConflict) {
+		t.Errorf("expected %s, got %v", client.ErrorConflict, err)
+	}
+}
+
+func TestList(t *testing.T) {
+	tests, done := setUp()
+	defer done()
+	ctx := context.Background()
+
+	for i := 1; i <= 7; i++ {
+		owner := "a"
+		if i%2 == 0 {
+			owner = "b"
+		}
+		_, err := tests.Create(ctx, &model.TestModel{IntVal: i, Owner: owner})
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+	}
+
+	ms, err := tests.List(ctx, client.NewQuery().Equal("owner", "a").GreaterThan("int_val", 1).Sort("-int_val"))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	var vals []int
+	for _, m := range ms {
+		vals = append(vals, m.IntVal)
+	}
+	if !reflect.DeepEqual(vals, []int{7, 5, 3}) {
+		t.Errorf("expected [7 5 3], got %v", vals)
+	}
+
+	ms, err = tests.List(ctx, nil)
+	if err != nil || len(ms) != 7 {
+		t.Errorf("expected 7 models, got %v, %v", len(ms), err)
+	}
+
+	it := tests.Iterate(client.NewQuery().Sort("int_val").Limit(3))
+	vals = nil
+	for it.Next(ctx) {
+		vals = append(vals, it.Value().IntVal)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if !reflect.DeepEqual(vals, []int{1, 2, 3, 4, 5, 6, 7}) {
+		t.Errorf("expected 1-7, got %v", vals)
+	}
+
+	_, err = tests.List(ctx, client.NewQuery().Equal("int_val", "one"))
+	if !errors.Is(err, client.ErrorBadRequest) {
+		t.Errorf("expected %s, got %v", client.ErrorBadRequest, err)
+	}
+}
+
+func TestIterateCursor(t *testing.T) {
+	tests, done := setUp()
+	defer done()
+	ctx := context.Background()
+
+	var first string
+	expected := make(map[string]bool)
+	for _, v := range []int{1, 1, 2, 2, 2, 3, 4} {
+		m, err := tests.Create(ctx, &model.TestModel{IntVal: v})
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		expected[m.ID] = true
+	}
+
+	it := tests.Iterate(client.NewQuery().Sort("int_val").Limit(2))
+	seen := make(map[string]int)
+	for it.Next(ctx) {
+		m := it.Value()
+		seen[m.ID]++
+		if len(seen) == 1 {
+			first = m.ID
+		}
+		if len(seen) != 4 {
+			continue
+		}
+		// a Model that has been seen is deleted, and one after the cursor is
+		// created, which offsets would skip a Model for
+		_, err := tests.Delete(ctx, first)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		m, err = tests.Create(ctx, &model.TestModel{IntVal: 5})
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		expected[m.ID] = true
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	for id := range expected {
+		if seen[id] != 1 {
+			t.Errorf("expected %s once, got %v", id, seen[id])
+		}
+	}
+	if len(seen) != len(expected) {
+		t.Errorf("expected %v models, got %v", len(expected), len(seen))
+	}
+}
+
+func TestQueryValues(t *testing.T) {
+	q := client.NewQuery().Equal("a", 1).Equal("a", 2).LessThan("b", 3).Has("c").Skip(4).Limit(5).IncludeDeleted()
+	expected := "a=1&a=2&b_lessthan=3&has=c&include_deleted=true&limit=5&skip=4"
+	if v := q.Values().Encode(); v != expected {
+		t.Errorf("expected %s, got %s", expected, v)
+	}
+}
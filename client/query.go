@@ -0,0 +1,155 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query builds the query parameters of a list request, like crudley.Query
+// builds a query for a Store. Equal predicates on the same field match Models
+// equal to any of the values, other predicates must all be satisfied. The HTTP
+// API has no not equal operator, so Query has no NotEqual.
+type Query struct {
+	params         url.Values
+	skip, limit    int
+	sort, has      string
+	includeDeleted bool
+}
+
+// NewQuery returns an empty Query, matching every Model
+func NewQuery() *Query {
+	return &Query{params: make(url.Values)}
+}
+
+func formatValue(val interface{}) string {
+	switch v := val.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(val)
+}
+
+// Equal matches Models where the field key is val
+func (q *Query) Equal(key string, val interface{}) *Query {
+	q.params.Add(key, formatValue(val))
+	return q
+}
+
+// LessThan matches Models where the field key is less than, or before, val
+func (q *Query) LessThan(key string, val interface{}) *Query {
+	q.params.Add(key+"_lessthan", formatValue(val))
+	return q
+}
+
+// GreaterThan matches Models where the field key is greater than, or after, val
+func (q *Query) GreaterThan(key string, val interface{}) *Query {
+	q.params.Add(key+"_greaterthan", formatValue(val))
+	return q
+}
+
+// Before matches Models where the time field key is before t
+func (q *Query) Before(key string, t time.Time) *Query {
+	q.params.Add(key+"_before", formatValue(t))
+	return q
+}
+
+// After matches Models where the time field key is after t
+func (q *Query) After(key string, t time.Time) *Query {
+	q.params.Add(key+"_after", formatValue(t))
+	return q
+}
+
+// Has matches Models where the field key is set
+func (q *Query) Has(key string) *Query {
+	q.has = key
+	return q
+}
+
+// Sort orders the results by the field key, prefix it with - for descending
+// order
+func (q *Query) Sort(key string) *Query {
+	q.sort = key
+	return q
+}
+
+// Skip skips the first n results
+func (q *Query) Skip(n int) *Query {
+	q.skip = n
+	return q
+}
+
+// Limit returns at most n results
+func (q *Query) Limit(n int) *Query {
+	q.limit = n
+	return q
+}
+
+// IncludeDeleted includes deleted Models in the results
+func (q *Query) IncludeDeleted() *Query {
+	q.includeDeleted = true
+	return q
+}
+
+// Values returns the query parameters of q, which may be nil
+func (q *Query) Values() url.Values {
+	if q == nil {
+		return nil
+	}
+	v := make(url.Values)
+	for key, vals := range q.params {
+		v[key] = append([]string{}, vals...)
+	}
+	if q.skip > 0 {
+		v.Set("skip", strconv.Itoa(q.skip))
+	}
+	if q.limit > 0 {
+		v.Set("limit", strconv.Itoa(q.limit))
+	}
+	if q.sort != "" {
+		v.Set("sort", q.sort)
+	}
+	if q.has != "" {
+		v.Set("has", q.has)
+	}
+	if q.includeDeleted {
+		v.Set("include_deleted", "true")
+	}
+	return v
+}
+
+// after replaces the query's bounds on its sort field with one matching the
+// Models after the json value val in the sort order
+func (q *Query) after(val json.RawMessage) {
+	field := strings.TrimPrefix(q.sort, "-")
+	suffixes := []string{"_after", "_greaterthan"}
+	if strings.HasPrefix(q.sort, "-") {
+		suffixes = []string{"_before", "_lessthan"}
+	}
+	for _, suffix := range suffixes {
+		q.params.Del(field + suffix)
+	}
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(val))
+	d.UseNumber()
+	d.Decode(&v)
+	q.params.Set(field+suffixes[1], formatValue(v))
+}
+
+func (q *Query) clone() *Query {
+	if q == nil {
+		return NewQuery()
+	}
+	out := *q
+	out.params = make(url.Values)
+	for key, vals := range q.params {
+		out.params[key] = append([]string{}, vals...)
+	}
+	return &out
+}
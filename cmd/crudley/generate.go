@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"text/template"
+)
+
+// generate returns the formatted source of the generated file for p
+func generate(p *pkg) ([]byte, error) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, p)
+	if err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %s", err)
+	}
+	return src, nil
+}
+
+// UsesTime reports whether the generated code refers to time.Time
+func (p *pkg) UsesTime() bool {
+	for _, m := range p.Models {
+		for _, f := range m.Fields {
+			if f.Time {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var tmpl = template.Must(template.New("crudley").Parse(`// Code generated by crudley. DO NOT EDIT.
+
+package {{.Name}}
+
+import (
+	"context"
+	"fmt"
+{{- if .UsesTime}}
+	"time"
+{{- end}}
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/client"
+)
+
+{{range .Models}}{{$m := .}}
+{{- if not .Declared.New}}
+// New returns a new {{.Type}} with the ID set
+func (m *{{.Type}}) New(id string) crudley.Model {
+	out := &{{.Type}}{}
+	out.{{.ID}} = id
+	return out
+}
+{{end}}
+{{- if not .Declared.GetName}}
+// GetName returns the name of the {{.Type}} Model
+func (m *{{.Type}}) GetName() string {
+	return {{printf "%q" .Name}}
+}
+{{end}}
+{{- if not .Declared.PrimaryKey}}
+// PrimaryKey returns the {{.Type}}'s ID
+func (m *{{.Type}}) PrimaryKey() string {
+	return m.{{.ID}}
+}
+{{end}}
+{{- if not .Declared.Delete}}
+// Delete marks the {{.Type}} as deleted
+func (m *{{.Type}}) Delete() {
+	m.{{.Deleted}} = true
+}
+{{end}}
+{{- if not .Declared.IsDeleted}}
+// IsDeleted returns the deleted status of the {{.Type}}
+func (m *{{.Type}}) IsDeleted() bool {
+	return m.{{.Deleted}}
+}
+{{end}}
+{{- if not (or .Declared.Restore .Declared.Delete)}}
+// Restore unmarks the {{.Type}} as deleted
+func (m *{{.Type}}) Restore() {
+	m.{{.Deleted}} = false
+}
+{{end}}
+// Field names of {{.Type}}, for use in queries
+const (
+{{- range .Fields}}
+	{{$m.Type}}Field{{.Name}} = {{printf "%q" .JSON}}
+{{- end}}
+)
+
+// Register{{.Type}} serves {{.Type}}s from s as a resource of the API
+func Register{{.Type}}(a *crudley.API, s crudley.Store, opts ...crudley.Option) *crudley.Path {
+	return a.Register(&{{.Type}}{}, s, opts...)
+}
+
+// New{{.Type}}Client returns a client for the {{.Type}}s registered with an API
+// served under prefix
+func New{{.Type}}Client(c *client.Client, prefix string) *client.Collection[*{{.Type}}] {
+	return client.NewCollection[*{{.Type}}](c, prefix+"/"+(&{{.Type}}{}).GetName())
+}
+
+// {{.Type}}Query is a crudley.Query of {{.Type}}s with typed predicates for
+// each field
+type {{.Type}}Query struct {
+	q crudley.Query
+}
+
+// New{{.Type}}Query returns a {{.Type}}Query of the Models in c
+func New{{.Type}}Query(c crudley.Collection) *{{.Type}}Query {
+	return &{{.Type}}Query{q: c.Query()}
+}
+
+// Query returns the underlying crudley.Query
+func (q *{{.Type}}Query) Query() crudley.Query {
+	return q.q
+}
+{{range .Fields}}{{if .Comparable}}
+// {{.Name}}Equal matches {{$m.Type}}s where {{.JSON}} is v
+func (q *{{$m.Type}}Query) {{.Name}}Equal(v {{.Type}}) *{{$m.Type}}Query {
+	q.q.Equal({{$m.Type}}Field{{.Name}}, v)
+	return q
+}
+
+// {{.Name}}NotEqual matches {{$m.Type}}s where {{.JSON}} is not v
+func (q *{{$m.Type}}Query) {{.Name}}NotEqual(v {{.Type}}) *{{$m.Type}}Query {
+	q.q.NotEqual({{$m.Type}}Field{{.Name}}, v)
+	return q
+}
+{{end}}{{if .Ordered}}
+// {{.Name}}GreaterThan matches {{$m.Type}}s where {{.JSON}} is greater than v
+func (q *{{$m.Type}}Query) {{.Name}}GreaterThan(v {{.Type}}) *{{$m.Type}}Query {
+	q.q.GreaterThan({{$m.Type}}Field{{.Name}}, v)
+	return q
+}
+
+// {{.Name}}LessThan matches {{$m.Type}}s where {{.JSON}} is less than v
+func (q *{{$m.Type}}Query) {{.Name}}LessThan(v {{.Type}}) *{{$m.Type}}Query {
+	q.q.LessThan({{$m.Type}}Field{{.Name}}, v)
+	return q
+}
+{{end}}{{end}}
+// Has matches {{.Type}}s where the field is set
+func (q *{{.Type}}Query) Has(field string) *{{.Type}}Query {
+	q.q.Has(field)
+	return q
+}
+
+// Sort orders the results by the field, prefix it with - for descending order
+func (q *{{.Type}}Query) Sort(field string) *{{.Type}}Query {
+	q.q.Sort(field)
+	return q
+}
+
+// Skip skips the first n results
+func (q *{{.Type}}Query) Skip(n int) *{{.Type}}Query {
+	q.q.Skip(n)
+	return q
+}
+
+// Limit returns at most n results
+func (q *{{.Type}}Query) Limit(n int) *{{.Type}}Query {
+	q.q.Limit(n)
+	return q
+}
+
+// Execute runs the Query
+func (q *{{.Type}}Query) Execute(ctx context.Context) ([]*{{.Type}}, error) {
+	models, err := q.q.Execute(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*{{.Type}}, 0, len(models))
+	for _, m := range models {
+		t, ok := m.(*{{.Type}})
+		if !ok {
+			return nil, fmt.Errorf("expected *{{.Type}}, got %T", m)
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+{{end}}
+// RegisterModels serves all of the annotated Models from s as resources of the
+// API
+func RegisterModels(a *crudley.API, s crudley.Store, opts ...crudley.Option) {
+{{- range .Models}}
+	Register{{.Type}}(a, s, opts...)
+{{- end}}
+}
+`))
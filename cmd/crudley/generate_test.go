@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const example = "../../examples/codegen"
+
+func TestGenerateExample(t *testing.T) {
+	p, err := parse(example, "crudley_gen.go")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	src, err := generate(p)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	committed, err := os.ReadFile(filepath.Join(example, "crudley_gen.go"))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if !bytes.Equal(src, committed) {
+		t.Errorf("expected %s/crudley_gen.go to be up to date, run go generate", example)
+	}
+}
+
+func TestParse(t *testing.T) {
+	p, err := parse(example, "crudley_gen.go")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if p.Name != "main" || len(p.Models) != 2 {
+		t.Fatalf("expected 2 models in main, got %s %v", p.Name, len(p.Models))
+	}
+	post, comment := p.Models[0], p.Models[1]
+	if post.Type != "Post" || post.Name != "posts" || post.Deleted != "Deleted" {
+		t.Errorf("expected posts, got %+v", post)
+	}
+	fields := make(map[string]field)
+	for _, f := range post.Fields {
+		fields[f.JSON] = f
+	}
+	for name, expected := range map[string]field{
+		"status":  {Name: "Status", JSON: "status", Type: "Status", Ordered: true, Comparable: true},
+		"created": {Name: "Created", JSON: "created", Type: "time.Time", Ordered: true, Comparable: true, Time: true},
+		"deleted": {Name: "Deleted", JSON: "deleted", Type: "bool", Comparable: true},
+		"tags":    {Name: "Tags", JSON: "tags"},
+	} {
+		if fields[name] != expected {
+			t.Errorf("expected %+v, got %+v", expected, fields[name])
+		}
+	}
+	if comment.Name != "comment" || comment.Deleted != "Removed" || !comment.Declared["GetName"] {
+		t.Errorf("expected comment with a declared GetName, got %+v", comment)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for src, expected := range map[string]string{
+		"//crudley:model\ntype T struct{ Key string }":                                        "no ID field",
+		"//crudley:model id=Key\ntype T struct{ Key string }":                                 "no Deleted field",
+		"//crudley:model colour=red\ntype T struct{ ID string }":                              "unknown setting",
+		"//crudley:model name\ntype T struct{ ID string }":                                    "malformed setting",
+		"//crudley:model\ntype T string":                                                      "only structs",
+		"type T struct{ ID string }":                                                          "no structs annotated",
+		"//crudley:model id=Key deleted=Gone\ntype T struct {\n\tKey  string\n\tGone bool\n}": "",
+	} {
+		dir := t.TempDir()
+		err := os.WriteFile(filepath.Join(dir, "t.go"), []byte("package t\n\n"+src+"\n"), 0644)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		err = run(dir, "crudley_gen.go")
+		switch {
+		case expected == "" && err != nil:
+			t.Errorf("expected nil, got %s", err)
+		case expected != "" && (err == nil || !strings.Contains(err.Error(), expected)):
+			t.Errorf("expected %s, got %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Command crudley generates the boilerplate for crudley Models. Annotate a
+// struct with a //crudley:model directive and run crudley in its package,
+// usually with go generate:
+//
+//	//go:generate go run github.com/arussellsaw/crudley/cmd/crudley
+//
+//	//crudley:model name=incidents
+//	type Incident struct {
+//		ID      string `json:"id" rest:"immutable"`
+//		Name    string `json:"name"`
+//		Deleted bool   `json:"deleted" rest:"immutable"`
+//	}
+//
+// For each annotated struct it generates the crudley.Model methods not already
+// declared, a function registering a Path with a crudley.API, a typed client, and
+// a typed query builder with a constant for each field name, such as
+// IncidentFieldName. The directive's settings are:
+//
+//	name     the Model's name, the lower case type name by default
+//	id       the ID field, ID by default
+//	deleted  the bool field marking the Model as deleted, Deleted by default
+//
+// The generated code is written to crudley_gen.go unless set with -output.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("crudley: ")
+	output := flag.String("output", "crudley_gen.go", "file to write the generated code to, relative to the package directory")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: crudley [-output file] [dir]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	err := run(dir, *output)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run generates the code for the package in dir
+func run(dir, output string) error {
+	p, err := parse(dir, output)
+	if err != nil {
+		return err
+	}
+	if len(p.Models) == 0 {
+		return fmt.Errorf("no structs annotated with %s in %s", annotation, dir)
+	}
+	src, err := generate(p)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, output), src, 0644)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// annotation marks a struct to generate code for, it is a directive comment in
+// the struct's doc with optional key=value settings:
+//
+//	//crudley:model name=incidents id=ID deleted=Deleted
+const annotation = "//crudley:model"
+
+// ordered are the basic types which can be compared with GreaterThan and
+// LessThan, all basic types can be compared with Equal
+var ordered = map[string]bool{
+	"string": true, "int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true, "byte": true, "rune": true,
+}
+
+// model is an annotated struct
+type model struct {
+	Type    string
+	Name    string
+	ID      string
+	Deleted string
+	Fields  []field
+	// Declared is the set of methods already declared on the type, which aren't
+	// generated
+	Declared map[string]bool
+}
+
+// field is a field of a model in its JSON encoding
+type field struct {
+	Name string
+	JSON string
+	Type string
+	// Ordered fields have GreaterThan and LessThan predicates, Comparable fields
+	// have Equal and NotEqual predicates
+	Ordered    bool
+	Comparable bool
+	Time       bool
+}
+
+// pkg is the parsed package models are generated for
+type pkg struct {
+	Name    string
+	Models  []*model
+	types   map[string]*ast.TypeSpec
+	methods map[string]map[string]bool
+}
+
+// parse parses the Go files of the package in dir, except for tests and the
+// output file, returning its annotated structs
+func parse(dir, output string) (*pkg, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	p := &pkg{
+		types:   make(map[string]*ast.TypeSpec),
+		methods: make(map[string]map[string]bool),
+	}
+	fset := token.NewFileSet()
+	var annotated []*ast.TypeSpec
+	var settings [][]string
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") || filepath.Base(name) == filepath.Base(output) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if p.Name == "" {
+			p.Name = f.Name.Name
+		}
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil || len(d.Recv.List) == 0 {
+					continue
+				}
+				recv := receiverType(d.Recv.List[0].Type)
+				if p.methods[recv] == nil {
+					p.methods[recv] = make(map[string]bool)
+				}
+				p.methods[recv][d.Name.Name] = true
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					ts, ok := spec.(*ast.TypeSpec)
+					if !ok {
+						continue
+					}
+					p.types[ts.Name.Name] = ts
+					doc := ts.Doc
+					if doc == nil && len(d.Specs) == 1 {
+						doc = d.Doc
+					}
+					if args, ok := directive(doc); ok {
+						annotated = append(annotated, ts)
+						settings = append(settings, args)
+					}
+				}
+			}
+		}
+	}
+	if p.Name == "" {
+		return nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	for i, ts := range annotated {
+		m, err := p.model(ts, settings[i])
+		if err != nil {
+			return nil, err
+		}
+		p.Models = append(p.Models, m)
+	}
+	return p, nil
+}
+
+func receiverType(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverType(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// directive returns the settings of the annotation in doc, if it has one
+func directive(doc *ast.CommentGroup) ([]string, bool) {
+	if doc == nil {
+		return nil, false
+	}
+	for _, c := range doc.List {
+		if c.Text == annotation || strings.HasPrefix(c.Text, annotation+" ") {
+			return strings.Fields(strings.TrimPrefix(c.Text, annotation)), true
+		}
+	}
+	return nil, false
+}
+
+func (p *pkg) model(ts *ast.TypeSpec, settings []string) (*model, error) {
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return nil, fmt.Errorf("%s: only structs can be annotated with %s", ts.Name.Name, annotation)
+	}
+	m := &model{
+		Type:     ts.Name.Name,
+		Name:     strings.ToLower(ts.Name.Name),
+		ID:       "ID",
+		Deleted:  "Deleted",
+		Declared: p.methods[ts.Name.Name],
+	}
+	if m.Declared == nil {
+		m.Declared = make(map[string]bool)
+	}
+	explicit := make(map[string]bool)
+	for _, s := range settings {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("%s: malformed setting %q, expected key=value", m.Type, s)
+		}
+		switch kv[0] {
+		case "name":
+			m.Name = kv[1]
+		case "id":
+			m.ID = kv[1]
+		case "deleted":
+			m.Deleted = kv[1]
+		default:
+			return nil, fmt.Errorf("%s: unknown setting %q", m.Type, kv[0])
+		}
+		explicit[kv[0]] = true
+	}
+
+	seen := make(map[string]bool)
+	goNames := make(map[string]bool)
+	p.fields(m, st, seen, goNames)
+
+	// fields of embedded structs from other packages can't be found, so an
+	// explicitly set field is trusted
+	if !explicit["id"] && !goNames[m.ID] && !(m.Declared["New"] && m.Declared["PrimaryKey"]) {
+		return nil, fmt.Errorf("%s: no %s field, set the ID field with id=", m.Type, m.ID)
+	}
+	if !explicit["deleted"] && !goNames[m.Deleted] && !(m.Declared["Delete"] && m.Declared["IsDeleted"]) {
+		return nil, fmt.Errorf("%s: no %s field, set the deleted bool field with deleted=", m.Type, m.Deleted)
+	}
+	return m, nil
+}
+
+// fields adds the fields of st to m in the order they are encoded as JSON, the
+// fields of embedded structs declared in the package are flattened
+func (p *pkg) fields(m *model, st *ast.StructType, seen, goNames map[string]bool) {
+	for _, f := range st.Fields.List {
+		tag := ""
+		if f.Tag != nil {
+			tag, _ = strconv.Unquote(f.Tag.Value)
+		}
+		jsonName, _, _ := strings.Cut(reflect.StructTag(tag).Get("json"), ",")
+		if jsonName == "-" {
+			continue
+		}
+		if len(f.Names) == 0 {
+			name := receiverType(f.Type)
+			if ts, ok := p.types[name]; ok && jsonName == "" {
+				if embedded, ok := ts.Type.(*ast.StructType); ok {
+					p.fields(m, embedded, seen, goNames)
+					continue
+				}
+			}
+			if name == "" {
+				continue
+			}
+			p.addField(m, name, jsonName, f.Type, seen, goNames)
+			continue
+		}
+		for _, n := range f.Names {
+			if !n.IsExported() {
+				continue
+			}
+			p.addField(m, n.Name, jsonName, f.Type, seen, goNames)
+		}
+	}
+}
+
+func (p *pkg) addField(m *model, name, jsonName string, typ ast.Expr, seen, goNames map[string]bool) {
+	if jsonName == "" {
+		jsonName = name
+	}
+	goNames[name] = true
+	if seen[jsonName] {
+		return
+	}
+	seen[jsonName] = true
+	f := field{Name: name, JSON: jsonName}
+	switch t := typ.(type) {
+	case *ast.Ident:
+		f.Type = t.Name
+		basic := t.Name
+		if ts, ok := p.types[t.Name]; ok {
+			underlying, ok := ts.Type.(*ast.Ident)
+			if !ok {
+				break
+			}
+			basic = underlying.Name
+		}
+		f.Ordered = ordered[basic]
+		f.Comparable = f.Ordered || basic == "bool"
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok && pkg.Name == "time" && t.Sel.Name == "Time" {
+			f.Type = "time.Time"
+			f.Ordered, f.Comparable, f.Time = true, true, true
+		}
+	}
+	m.Fields = append(m.Fields, f)
+}
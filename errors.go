@@ -12,4 +12,20 @@ var (
 	ErrorPreSaveFailed    = errors.New("PreSave failed")
 	ErrorNoID             = errors.New("ID parameter missing")
 	ErrorForbidden        = errors.New("Permission Denied")
+
+	ErrorTransactionsUnsupported = errors.New("Store does not support transactions")
+	ErrorNestedTransaction       = errors.New("a transaction is already open, use the Store passed to the TransactionFunc")
+	ErrorClientIDUnsupported     = errors.New("Collection does not support client supplied IDs")
+	ErrorRestoreUnsupported      = errors.New("Model does not support being restored")
+	ErrorHistoryUnsupported      = errors.New("Store does not keep history")
+	ErrorRevisionNotFound        = errors.New("Revision not found")
+	ErrorFilterNotExecutable     = errors.New("Filter can only be used to match Models")
+	ErrorChangesExpired          = errors.New("requested changes are no longer available")
+	ErrorNoTenant                = errors.New("tenant could not be identified")
+	ErrorTenantMismatch          = errors.New("Model belongs to a different tenant")
+	ErrorResourceNotFound        = errors.New("no resource is served at this path")
+	ErrorMethodNotAllowed        = errors.New("method not allowed")
+
+	ErrorIdempotencyKeyReused     = errors.New("Idempotency-Key has already been used for a different request")
+	ErrorIdempotencyKeyInProgress = errors.New("a request with this Idempotency-Key is in progress")
 )
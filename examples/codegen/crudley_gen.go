@@ -0,0 +1,524 @@
+// Code generated by crudley. DO NOT EDIT.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/client"
+)
+
+// New returns a new Post with the ID set
+func (m *Post) New(id string) crudley.Model {
+	out := &Post{}
+	out.ID = id
+	return out
+}
+
+// GetName returns the name of the Post Model
+func (m *Post) GetName() string {
+	return "posts"
+}
+
+// PrimaryKey returns the Post's ID
+func (m *Post) PrimaryKey() string {
+	return m.ID
+}
+
+// Delete marks the Post as deleted
+func (m *Post) Delete() {
+	m.Deleted = true
+}
+
+// IsDeleted returns the deleted status of the Post
+func (m *Post) IsDeleted() bool {
+	return m.Deleted
+}
+
+// Restore unmarks the Post as deleted
+func (m *Post) Restore() {
+	m.Deleted = false
+}
+
+// Field names of Post, for use in queries
+const (
+	PostFieldID        = "id"
+	PostFieldTitle     = "title"
+	PostFieldBody      = "body"
+	PostFieldStatus    = "status"
+	PostFieldPublished = "published"
+	PostFieldTags      = "tags"
+	PostFieldCreated   = "created"
+	PostFieldDeleted   = "deleted"
+)
+
+// RegisterPost serves Posts from s as a resource of the API
+func RegisterPost(a *crudley.API, s crudley.Store, opts ...crudley.Option) *crudley.Path {
+	return a.Register(&Post{}, s, opts...)
+}
+
+// NewPostClient returns a client for the Posts registered with an API
+// served under prefix
+func NewPostClient(c *client.Client, prefix string) *client.Collection[*Post] {
+	return client.NewCollection[*Post](c, prefix+"/"+(&Post{}).GetName())
+}
+
+// PostQuery is a crudley.Query of Posts with typed predicates for
+// each field
+type PostQuery struct {
+	q crudley.Query
+}
+
+// NewPostQuery returns a PostQuery of the Models in c
+func NewPostQuery(c crudley.Collection) *PostQuery {
+	return &PostQuery{q: c.Query()}
+}
+
+// Query returns the underlying crudley.Query
+func (q *PostQuery) Query() crudley.Query {
+	return q.q
+}
+
+// IDEqual matches Posts where id is v
+func (q *PostQuery) IDEqual(v string) *PostQuery {
+	q.q.Equal(PostFieldID, v)
+	return q
+}
+
+// IDNotEqual matches Posts where id is not v
+func (q *PostQuery) IDNotEqual(v string) *PostQuery {
+	q.q.NotEqual(PostFieldID, v)
+	return q
+}
+
+// IDGreaterThan matches Posts where id is greater than v
+func (q *PostQuery) IDGreaterThan(v string) *PostQuery {
+	q.q.GreaterThan(PostFieldID, v)
+	return q
+}
+
+// IDLessThan matches Posts where id is less than v
+func (q *PostQuery) IDLessThan(v string) *PostQuery {
+	q.q.LessThan(PostFieldID, v)
+	return q
+}
+
+// TitleEqual matches Posts where title is v
+func (q *PostQuery) TitleEqual(v string) *PostQuery {
+	q.q.Equal(PostFieldTitle, v)
+	return q
+}
+
+// TitleNotEqual matches Posts where title is not v
+func (q *PostQuery) TitleNotEqual(v string) *PostQuery {
+	q.q.NotEqual(PostFieldTitle, v)
+	return q
+}
+
+// TitleGreaterThan matches Posts where title is greater than v
+func (q *PostQuery) TitleGreaterThan(v string) *PostQuery {
+	q.q.GreaterThan(PostFieldTitle, v)
+	return q
+}
+
+// TitleLessThan matches Posts where title is less than v
+func (q *PostQuery) TitleLessThan(v string) *PostQuery {
+	q.q.LessThan(PostFieldTitle, v)
+	return q
+}
+
+// BodyEqual matches Posts where body is v
+func (q *PostQuery) BodyEqual(v string) *PostQuery {
+	q.q.Equal(PostFieldBody, v)
+	return q
+}
+
+// BodyNotEqual matches Posts where body is not v
+func (q *PostQuery) BodyNotEqual(v string) *PostQuery {
+	q.q.NotEqual(PostFieldBody, v)
+	return q
+}
+
+// BodyGreaterThan matches Posts where body is greater than v
+func (q *PostQuery) BodyGreaterThan(v string) *PostQuery {
+	q.q.GreaterThan(PostFieldBody, v)
+	return q
+}
+
+// BodyLessThan matches Posts where body is less than v
+func (q *PostQuery) BodyLessThan(v string) *PostQuery {
+	q.q.LessThan(PostFieldBody, v)
+	return q
+}
+
+// StatusEqual matches Posts where status is v
+func (q *PostQuery) StatusEqual(v Status) *PostQuery {
+	q.q.Equal(PostFieldStatus, v)
+	return q
+}
+
+// StatusNotEqual matches Posts where status is not v
+func (q *PostQuery) StatusNotEqual(v Status) *PostQuery {
+	q.q.NotEqual(PostFieldStatus, v)
+	return q
+}
+
+// StatusGreaterThan matches Posts where status is greater than v
+func (q *PostQuery) StatusGreaterThan(v Status) *PostQuery {
+	q.q.GreaterThan(PostFieldStatus, v)
+	return q
+}
+
+// StatusLessThan matches Posts where status is less than v
+func (q *PostQuery) StatusLessThan(v Status) *PostQuery {
+	q.q.LessThan(PostFieldStatus, v)
+	return q
+}
+
+// PublishedEqual matches Posts where published is v
+func (q *PostQuery) PublishedEqual(v time.Time) *PostQuery {
+	q.q.Equal(PostFieldPublished, v)
+	return q
+}
+
+// PublishedNotEqual matches Posts where published is not v
+func (q *PostQuery) PublishedNotEqual(v time.Time) *PostQuery {
+	q.q.NotEqual(PostFieldPublished, v)
+	return q
+}
+
+// PublishedGreaterThan matches Posts where published is greater than v
+func (q *PostQuery) PublishedGreaterThan(v time.Time) *PostQuery {
+	q.q.GreaterThan(PostFieldPublished, v)
+	return q
+}
+
+// PublishedLessThan matches Posts where published is less than v
+func (q *PostQuery) PublishedLessThan(v time.Time) *PostQuery {
+	q.q.LessThan(PostFieldPublished, v)
+	return q
+}
+
+// CreatedEqual matches Posts where created is v
+func (q *PostQuery) CreatedEqual(v time.Time) *PostQuery {
+	q.q.Equal(PostFieldCreated, v)
+	return q
+}
+
+// CreatedNotEqual matches Posts where created is not v
+func (q *PostQuery) CreatedNotEqual(v time.Time) *PostQuery {
+	q.q.NotEqual(PostFieldCreated, v)
+	return q
+}
+
+// CreatedGreaterThan matches Posts where created is greater than v
+func (q *PostQuery) CreatedGreaterThan(v time.Time) *PostQuery {
+	q.q.GreaterThan(PostFieldCreated, v)
+	return q
+}
+
+// CreatedLessThan matches Posts where created is less than v
+func (q *PostQuery) CreatedLessThan(v time.Time) *PostQuery {
+	q.q.LessThan(PostFieldCreated, v)
+	return q
+}
+
+// DeletedEqual matches Posts where deleted is v
+func (q *PostQuery) DeletedEqual(v bool) *PostQuery {
+	q.q.Equal(PostFieldDeleted, v)
+	return q
+}
+
+// DeletedNotEqual matches Posts where deleted is not v
+func (q *PostQuery) DeletedNotEqual(v bool) *PostQuery {
+	q.q.NotEqual(PostFieldDeleted, v)
+	return q
+}
+
+// Has matches Posts where the field is set
+func (q *PostQuery) Has(field string) *PostQuery {
+	q.q.Has(field)
+	return q
+}
+
+// Sort orders the results by the field, prefix it with - for descending order
+func (q *PostQuery) Sort(field string) *PostQuery {
+	q.q.Sort(field)
+	return q
+}
+
+// Skip skips the first n results
+func (q *PostQuery) Skip(n int) *PostQuery {
+	q.q.Skip(n)
+	return q
+}
+
+// Limit returns at most n results
+func (q *PostQuery) Limit(n int) *PostQuery {
+	q.q.Limit(n)
+	return q
+}
+
+// Execute runs the Query
+func (q *PostQuery) Execute(ctx context.Context) ([]*Post, error) {
+	models, err := q.q.Execute(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Post, 0, len(models))
+	for _, m := range models {
+		t, ok := m.(*Post)
+		if !ok {
+			return nil, fmt.Errorf("expected *Post, got %T", m)
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// New returns a new Comment with the ID set
+func (m *Comment) New(id string) crudley.Model {
+	out := &Comment{}
+	out.ID = id
+	return out
+}
+
+// PrimaryKey returns the Comment's ID
+func (m *Comment) PrimaryKey() string {
+	return m.ID
+}
+
+// Delete marks the Comment as deleted
+func (m *Comment) Delete() {
+	m.Removed = true
+}
+
+// IsDeleted returns the deleted status of the Comment
+func (m *Comment) IsDeleted() bool {
+	return m.Removed
+}
+
+// Restore unmarks the Comment as deleted
+func (m *Comment) Restore() {
+	m.Removed = false
+}
+
+// Field names of Comment, for use in queries
+const (
+	CommentFieldID      = "id"
+	CommentFieldPostID  = "post_id"
+	CommentFieldAuthor  = "author"
+	CommentFieldBody    = "body"
+	CommentFieldLikes   = "likes"
+	CommentFieldRemoved = "removed"
+)
+
+// RegisterComment serves Comments from s as a resource of the API
+func RegisterComment(a *crudley.API, s crudley.Store, opts ...crudley.Option) *crudley.Path {
+	return a.Register(&Comment{}, s, opts...)
+}
+
+// NewCommentClient returns a client for the Comments registered with an API
+// served under prefix
+func NewCommentClient(c *client.Client, prefix string) *client.Collection[*Comment] {
+	return client.NewCollection[*Comment](c, prefix+"/"+(&Comment{}).GetName())
+}
+
+// CommentQuery is a crudley.Query of Comments with typed predicates for
+// each field
+type CommentQuery struct {
+	q crudley.Query
+}
+
+// NewCommentQuery returns a CommentQuery of the Models in c
+func NewCommentQuery(c crudley.Collection) *CommentQuery {
+	return &CommentQuery{q: c.Query()}
+}
+
+// Query returns the underlying crudley.Query
+func (q *CommentQuery) Query() crudley.Query {
+	return q.q
+}
+
+// IDEqual matches Comments where id is v
+func (q *CommentQuery) IDEqual(v string) *CommentQuery {
+	q.q.Equal(CommentFieldID, v)
+	return q
+}
+
+// IDNotEqual matches Comments where id is not v
+func (q *CommentQuery) IDNotEqual(v string) *CommentQuery {
+	q.q.NotEqual(CommentFieldID, v)
+	return q
+}
+
+// IDGreaterThan matches Comments where id is greater than v
+func (q *CommentQuery) IDGreaterThan(v string) *CommentQuery {
+	q.q.GreaterThan(CommentFieldID, v)
+	return q
+}
+
+// IDLessThan matches Comments where id is less than v
+func (q *CommentQuery) IDLessThan(v string) *CommentQuery {
+	q.q.LessThan(CommentFieldID, v)
+	return q
+}
+
+// PostIDEqual matches Comments where post_id is v
+func (q *CommentQuery) PostIDEqual(v string) *CommentQuery {
+	q.q.Equal(CommentFieldPostID, v)
+	return q
+}
+
+// PostIDNotEqual matches Comments where post_id is not v
+func (q *CommentQuery) PostIDNotEqual(v string) *CommentQuery {
+	q.q.NotEqual(CommentFieldPostID, v)
+	return q
+}
+
+// PostIDGreaterThan matches Comments where post_id is greater than v
+func (q *CommentQuery) PostIDGreaterThan(v string) *CommentQuery {
+	q.q.GreaterThan(CommentFieldPostID, v)
+	return q
+}
+
+// PostIDLessThan matches Comments where post_id is less than v
+func (q *CommentQuery) PostIDLessThan(v string) *CommentQuery {
+	q.q.LessThan(CommentFieldPostID, v)
+	return q
+}
+
+// AuthorEqual matches Comments where author is v
+func (q *CommentQuery) AuthorEqual(v string) *CommentQuery {
+	q.q.Equal(CommentFieldAuthor, v)
+	return q
+}
+
+// AuthorNotEqual matches Comments where author is not v
+func (q *CommentQuery) AuthorNotEqual(v string) *CommentQuery {
+	q.q.NotEqual(CommentFieldAuthor, v)
+	return q
+}
+
+// AuthorGreaterThan matches Comments where author is greater than v
+func (q *CommentQuery) AuthorGreaterThan(v string) *CommentQuery {
+	q.q.GreaterThan(CommentFieldAuthor, v)
+	return q
+}
+
+// AuthorLessThan matches Comments where author is less than v
+func (q *CommentQuery) AuthorLessThan(v string) *CommentQuery {
+	q.q.LessThan(CommentFieldAuthor, v)
+	return q
+}
+
+// BodyEqual matches Comments where body is v
+func (q *CommentQuery) BodyEqual(v string) *CommentQuery {
+	q.q.Equal(CommentFieldBody, v)
+	return q
+}
+
+// BodyNotEqual matches Comments where body is not v
+func (q *CommentQuery) BodyNotEqual(v string) *CommentQuery {
+	q.q.NotEqual(CommentFieldBody, v)
+	return q
+}
+
+// BodyGreaterThan matches Comments where body is greater than v
+func (q *CommentQuery) BodyGreaterThan(v string) *CommentQuery {
+	q.q.GreaterThan(CommentFieldBody, v)
+	return q
+}
+
+// BodyLessThan matches Comments where body is less than v
+func (q *CommentQuery) BodyLessThan(v string) *CommentQuery {
+	q.q.LessThan(CommentFieldBody, v)
+	return q
+}
+
+// LikesEqual matches Comments where likes is v
+func (q *CommentQuery) LikesEqual(v int) *CommentQuery {
+	q.q.Equal(CommentFieldLikes, v)
+	return q
+}
+
+// LikesNotEqual matches Comments where likes is not v
+func (q *CommentQuery) LikesNotEqual(v int) *CommentQuery {
+	q.q.NotEqual(CommentFieldLikes, v)
+	return q
+}
+
+// LikesGreaterThan matches Comments where likes is greater than v
+func (q *CommentQuery) LikesGreaterThan(v int) *CommentQuery {
+	q.q.GreaterThan(CommentFieldLikes, v)
+	return q
+}
+
+// LikesLessThan matches Comments where likes is less than v
+func (q *CommentQuery) LikesLessThan(v int) *CommentQuery {
+	q.q.LessThan(CommentFieldLikes, v)
+	return q
+}
+
+// RemovedEqual matches Comments where removed is v
+func (q *CommentQuery) RemovedEqual(v bool) *CommentQuery {
+	q.q.Equal(CommentFieldRemoved, v)
+	return q
+}
+
+// RemovedNotEqual matches Comments where removed is not v
+func (q *CommentQuery) RemovedNotEqual(v bool) *CommentQuery {
+	q.q.NotEqual(CommentFieldRemoved, v)
+	return q
+}
+
+// Has matches Comments where the field is set
+func (q *CommentQuery) Has(field string) *CommentQuery {
+	q.q.Has(field)
+	return q
+}
+
+// Sort orders the results by the field, prefix it with - for descending order
+func (q *CommentQuery) Sort(field string) *CommentQuery {
+	q.q.Sort(field)
+	return q
+}
+
+// Skip skips the first n results
+func (q *CommentQuery) Skip(n int) *CommentQuery {
+	q.q.Skip(n)
+	return q
+}
+
+// Limit returns at most n results
+func (q *CommentQuery) Limit(n int) *CommentQuery {
+	q.q.Limit(n)
+	return q
+}
+
+// Execute runs the Query
+func (q *CommentQuery) Execute(ctx context.Context) ([]*Comment, error) {
+	models, err := q.q.Execute(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Comment, 0, len(models))
+	for _, m := range models {
+		t, ok := m.(*Comment)
+		if !ok {
+			return nil, fmt.Errorf("expected *Comment, got %T", m)
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// RegisterModels serves all of the annotated Models from s as resources of the
+// API
+func RegisterModels(a *crudley.API, s crudley.Store, opts ...crudley.Option) {
+	RegisterPost(a, s, opts...)
+	RegisterComment(a, s, opts...)
+}
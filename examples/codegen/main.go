@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/stores/mem"
+)
+
+// an example of generating Models with the crudley command, run go generate in
+// this directory after changing models.go
+//
+// list the published posts
+// curl 'localhost:3000/api/posts?status=published' | jq
+//
+// list the comments on a post
+// curl 'localhost:3000/api/comments?post_id=...' | jq
+func main() {
+	s := mem.NewStore()
+	api := crudley.NewAPI("/api")
+	RegisterModels(api, s)
+	log.Fatal(http.ListenAndServe(":3000", api))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/client"
+	"github.com/arussellsaw/crudley/stores/mem"
+)
+
+func TestGenerated(t *testing.T) {
+	s := mem.NewStore()
+	api := crudley.NewAPI("/api")
+	RegisterModels(api, s)
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	ctx := context.Background()
+
+	c := client.New(srv.URL)
+	posts := NewPostClient(c, "/api")
+	post, err := posts.Create(ctx, &Post{Title: "hello", Status: "published"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	comments := NewCommentClient(c, "/api")
+	for i := 0; i < 3; i++ {
+		_, err = comments.Create(ctx, &Comment{PostID: post.ID, Likes: i})
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+	}
+	_, err = posts.Delete(ctx, post.ID)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+
+	col, err := s.Collection(&Comment{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	res, err := NewCommentQuery(col).PostIDEqual(post.ID).LikesGreaterThan(0).Sort("-" + CommentFieldLikes).Execute(ctx)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if len(res) != 2 || res[0].Likes != 2 {
+		t.Errorf("expected 2 comments, got %+v", res)
+	}
+	col, err = s.Collection(&Post{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	deleted, err := NewPostQuery(col).DeletedEqual(true).StatusEqual("published").Execute(ctx)
+	if err != nil || len(deleted) != 1 || !deleted[0].IsDeleted() {
+		t.Errorf("expected a deleted post, got %+v, %v", deleted, err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "time"
+
+//go:generate go run github.com/arussellsaw/crudley/cmd/crudley
+
+// Post is a blog post, the crudley.Model methods, registration functions,
+// client and query builder are generated in crudley_gen.go
+//
+//crudley:model name=posts
+type Post struct {
+	ID        string    `json:"id" rest:"immutable"`
+	Title     string    `json:"title" validate:"required"`
+	Body      string    `json:"body"`
+	Status    Status    `json:"status" validate:"enum=draft|published"`
+	Published time.Time `json:"published"`
+	Tags      []string  `json:"tags"`
+	Audit
+}
+
+// Status is the publication status of a Post
+type Status string
+
+// Comment is a comment on a Post, it has its own GetName so none is generated
+//
+//crudley:model deleted=Removed
+type Comment struct {
+	ID      string `json:"id" rest:"immutable"`
+	PostID  string `json:"post_id"`
+	Author  string `json:"author"`
+	Body    string `json:"body"`
+	Likes   int    `json:"likes"`
+	Removed bool   `json:"removed" rest:"immutable"`
+}
+
+// GetName returns the name of the Comment Model
+func (c *Comment) GetName() string {
+	return "comments"
+}
+
+// Audit is embedded in Models to record when they change, its fields are
+// flattened into the Model
+type Audit struct {
+	Created time.Time `json:"created" rest:"immutable"`
+	Deleted bool      `json:"deleted" rest:"immutable"`
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/ids"
 	"github.com/arussellsaw/crudley/stores/firestore"
 	"github.com/arussellsaw/crudley/stores/mem"
-	"github.com/gorilla/mux"
 	"log"
 	"net/http"
 	"time"
@@ -32,10 +32,15 @@ func main() {
 
 	// next we create the path for handling all of the REST
 	// handlers for CRUDing this object
-	r := mux.NewRouter()
-	p := crudley.NewPath(&Incident{}, s)
+	// incidents get sortable IDs like incident_1320757205649702912
+	snowflake, err := ids.NewSnowflake(0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	r := http.NewServeMux()
+	p := crudley.NewPath(&Incident{}, s, crudley.OptionIDGenerator(ids.Prefixed("incident", snowflake)))
 
-	r.PathPrefix("/incident/").Handler(http.StripPrefix("/incident", p))
+	r.Handle("/incident/", http.StripPrefix("/incident", p))
 
 	log.Fatal(http.ListenAndServe(":3000", r))
 }
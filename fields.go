@@ -0,0 +1,262 @@
+package crudley
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Field permissions, set with the rest struct tag. Several can be combined,
+// separated by commas, e.g. rest:"readonly,read=admin".
+const (
+	// structFieldReadOnly fields are never set from request bodies
+	structFieldReadOnly = "readonly"
+	// structFieldWriteOnly fields can be set, but are never included in responses
+	structFieldWriteOnly = "writeonly"
+	// structFieldPrivate fields are neither set from requests nor included in
+	// responses
+	structFieldPrivate = "private"
+	// structFieldRead restricts reading a field to a list of roles separated by
+	// |, e.g. rest:"read=admin|auditor"
+	structFieldRead = "read="
+	// structFieldWrite restricts setting a field to a list of roles
+	structFieldWrite = "write="
+)
+
+// RoleResolver returns the roles of the user making a request, which decide the
+// Model fields they can read and write
+type RoleResolver func(r *http.Request) []string
+
+// OptionRoles sets the RoleResolver for the Path
+func OptionRoles(fn RoleResolver) Option {
+	return func(p *Path) {
+		p.Roles = fn
+	}
+}
+
+type rolesKey struct{}
+
+// WithRoles returns a context for a request made by a user with roles
+func WithRoles(ctx context.Context, roles []string) context.Context {
+	return context.WithValue(ctx, rolesKey{}, roles)
+}
+
+// RolesFromContext returns the roles set with WithRoles
+func RolesFromContext(ctx context.Context) []string {
+	roles, _ := ctx.Value(rolesKey{}).([]string)
+	return roles
+}
+
+// fieldPerm is the permissions of a restricted field
+type fieldPerm struct {
+	index      []int
+	path       []string
+	readable   bool
+	writable   bool
+	readRoles  []string
+	writeRoles []string
+}
+
+func (f fieldPerm) canRead(roles []string) bool {
+	return f.readable && (len(f.readRoles) == 0 || hasRole(f.readRoles, roles))
+}
+
+func (f fieldPerm) canWrite(roles []string) bool {
+	return f.writable && (len(f.writeRoles) == 0 || hasRole(f.writeRoles, roles))
+}
+
+func hasRole(allowed, roles []string) bool {
+	for _, a := range allowed {
+		for _, r := range roles {
+			if a == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var fieldPermCache sync.Map
+
+// fieldPerms returns the permissions of the restricted fields of struct type t
+func fieldPerms(t reflect.Type) []fieldPerm {
+	if perms, ok := fieldPermCache.Load(t); ok {
+		return perms.([]fieldPerm)
+	}
+	var perms []fieldPerm
+	walkFieldPerms(t, nil, nil, &perms)
+	fieldPermCache.Store(t, perms)
+	return perms
+}
+
+func walkFieldPerms(t reflect.Type, index []int, path []string, perms *[]fieldPerm) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		idx := append(append([]int{}, index...), i)
+		if f.Anonymous && name == "" {
+			// embedded structs are flattened by encoding/json
+			if f.Type.Kind() == reflect.Struct {
+				walkFieldPerms(f.Type, idx, path, perms)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		p := append(append([]string{}, path...), name)
+		perm, restricted := parseFieldPerm(f.Tag.Get(structTagRest))
+		if restricted {
+			perm.index, perm.path = idx, p
+			*perms = append(*perms, perm)
+			continue
+		}
+		if f.Type.Kind() == reflect.Struct {
+			walkFieldPerms(f.Type, idx, p, perms)
+		}
+	}
+}
+
+func parseFieldPerm(tag string) (fieldPerm, bool) {
+	perm := fieldPerm{readable: true, writable: true}
+	if tag == "" {
+		return perm, false
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		switch {
+		case opt == structFieldImmutable, opt == structFieldReadOnly:
+			perm.writable = false
+		case opt == structFieldWriteOnly:
+			perm.readable = false
+		case opt == structFieldPrivate:
+			perm.readable, perm.writable = false, false
+		case strings.HasPrefix(opt, structFieldRead):
+			perm.readRoles = strings.Split(strings.TrimPrefix(opt, structFieldRead), "|")
+		case strings.HasPrefix(opt, structFieldWrite):
+			perm.writeRoles = strings.Split(strings.TrimPrefix(opt, structFieldWrite), "|")
+		}
+	}
+	return perm, !perm.readable || !perm.writable || perm.readRoles != nil || perm.writeRoles != nil
+}
+
+func structType(m interface{}) (reflect.Type, bool) {
+	t := reflect.TypeOf(m)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t, t != nil && t.Kind() == reflect.Struct
+}
+
+// hiddenFields returns the json paths of the fields of m that can't be read with
+// roles
+func hiddenFields(m interface{}, roles []string) [][]string {
+	t, ok := structType(m)
+	if !ok {
+		return nil
+	}
+	var hidden [][]string
+	for _, f := range fieldPerms(t) {
+		if !f.canRead(roles) {
+			hidden = append(hidden, f.path)
+		}
+	}
+	return hidden
+}
+
+// Redact returns m, omitting the fields that can't be read with roles when it
+// is serialized, as they are from the Path's responses. Observers sending Models
+// elsewhere should redact them.
+func Redact(m Model, roles []string) Model {
+	return redact(m, roles)
+}
+
+// redact returns m, omitting the fields that can't be read with roles when it
+// is serialized
+func redact(m Model, roles []string) Model {
+	if m == nil {
+		return nil
+	}
+	hidden := hiddenFields(m, roles)
+	if len(hidden) == 0 {
+		return m
+	}
+	return &redactedModel{Model: m, hidden: hidden}
+}
+
+type redactedModel struct {
+	Model
+	hidden [][]string
+}
+
+func (r *redactedModel) MarshalJSON() ([]byte, error) {
+	buf, err := json.Marshal(r.Model)
+	if err != nil {
+		return nil, err
+	}
+	return redactJSON(buf, r.hidden)
+}
+
+// redactJSON removes the paths from a serialized object
+func redactJSON(buf []byte, hidden [][]string) ([]byte, error) {
+	if len(hidden) == 0 {
+		return buf, nil
+	}
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	err := dec.Decode(&doc)
+	if err != nil || doc == nil {
+		return buf, err
+	}
+	for _, path := range hidden {
+		obj := doc
+		for _, key := range path[:len(path)-1] {
+			obj, _ = obj[key].(map[string]interface{})
+		}
+		if obj != nil {
+			delete(obj, path[len(path)-1])
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// checkQueryable returns an error if the query parameters filter or sort on a
+// field of m that can't be read with roles
+func checkQueryable(m Model, params url.Values, roles []string) error {
+	hidden := make(map[string]bool)
+	for _, path := range hiddenFields(m, roles) {
+		hidden[path[len(path)-1]] = true
+	}
+	if len(hidden) == 0 {
+		return nil
+	}
+	for key, vals := range params {
+		if key == "sort" || key == "has" {
+			for _, v := range vals {
+				if hidden[strings.TrimPrefix(v, "-")] {
+					return fmt.Errorf("can't query by %s", strings.TrimPrefix(v, "-"))
+				}
+			}
+			continue
+		}
+		for suffix := range queryMap {
+			key = strings.TrimSuffix(key, suffix)
+		}
+		if hidden[key] {
+			return fmt.Errorf("can't query by %s", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package crudley_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/stores/mem"
+)
+
+type account struct {
+	ID       string `json:"id" rest:"immutable"`
+	Name     string `json:"name"`
+	Password string `json:"password" rest:"writeonly"`
+	Secret   string `json:"secret" rest:"private"`
+	Balance  int    `json:"balance" rest:"readonly"`
+	Notes    string `json:"notes" rest:"read=admin,write=admin"`
+	Deleted  bool   `json:"deleted"`
+}
+
+func (a *account) New(id string) crudley.Model { return &account{ID: id} }
+func (a *account) GetName() string             { return "accounts" }
+func (a *account) PrimaryKey() string          { return a.ID }
+func (a *account) Delete()                     { a.Deleted = true }
+func (a *account) IsDeleted() bool             { return a.Deleted }
+
+func TestRestrictedModel(t *testing.T) {
+	body := []byte(`{"id": "2", "name": "new", "password": "hunter2", "secret": "s", "balance": 100, "notes": "n"}`)
+
+	a := &account{ID: "1", Secret: "orig", Balance: 1}
+	err := json.Unmarshal(body, &crudley.RestrictedModel{Model: a})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	expected := account{ID: "1", Name: "new", Password: "hunter2", Secret: "orig", Balance: 1}
+	if *a != expected {
+		t.Errorf("expected %+v, got %+v", expected, *a)
+	}
+
+	a = &account{ID: "1"}
+	err = json.Unmarshal(body, &crudley.RestrictedModel{Model: a, Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if a.Notes != "n" {
+		t.Errorf("expected n, got %s", a.Notes)
+	}
+}
+
+func TestFieldPermissions(t *testing.T) {
+	s := mem.NewStore()
+	p := crudley.NewPath(&account{}, s, crudley.OptionRoles(func(r *http.Request) []string {
+		return r.Header["X-Role"]
+	}))
+	api := httptest.NewServer(http.StripPrefix("/api/accounts", p))
+	defer api.Close()
+
+	do := func(method, path, role, body string) (int, map[string]interface{}) {
+		req, err := http.NewRequest(method, api.URL+"/api/accounts/"+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		if role != "" {
+			req.Header.Set("X-Role", role)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		defer res.Body.Close()
+		buf, _ := ioutil.ReadAll(res.Body)
+		var out struct {
+			Results []map[string]interface{} `json:"results"`
+		}
+		json.NewDecoder(bytes.NewReader(buf)).Decode(&out)
+		if len(out.Results) == 0 {
+			return res.StatusCode, nil
+		}
+		return res.StatusCode, out.Results[0]
+	}
+
+	_, res := do("POST", "", "", `{"name": "a", "password": "hunter2", "secret": "s", "balance": 100, "notes": "n"}`)
+	if res == nil {
+		t.Fatalf("expected a result")
+	}
+	for _, field := range []string{"password", "secret", "notes"} {
+		if _, ok := res[field]; ok {
+			t.Errorf("expected %s to be omitted, got %v", field, res)
+		}
+	}
+	id := res["id"].(string)
+	c, err := s.Collection(&account{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	m, err := c.View(context.Background(), id)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	expected := account{ID: id, Name: "a", Password: "hunter2"}
+	if *m.(*account) != expected {
+		t.Errorf("expected %+v, got %+v", expected, *m.(*account))
+	}
+
+	_, res = do("PUT", id, "admin", `{"notes": "admin notes"}`)
+	if res == nil || res["notes"] != "admin notes" {
+		t.Errorf("expected admin notes, got %v", res)
+	}
+	_, res = do("GET", id, "", "")
+	if _, ok := res["notes"]; ok || res == nil {
+		t.Errorf("expected notes to be omitted, got %v", res)
+	}
+
+	code, _ := do("GET", "?password=hunter2", "", "")
+	if code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %v", code)
+	}
+	code, res = do("GET", "?notes=admin+notes", "admin", "")
+	if code != http.StatusOK || res == nil {
+		t.Errorf("expected admin to query notes, got %v %v", code, res)
+	}
+}
@@ -0,0 +1,214 @@
+package crudley
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Filter is a Query that matches individual Models in memory, rather than
+// executing against a Store. It is used to apply the same predicates as a
+// Query to Models as they change. Limit, Skip and Sort have no effect.
+type Filter struct {
+	eq, ne, gt, lt []kv
+	has            []string
+}
+
+type kv struct {
+	k string
+	v interface{}
+}
+
+// NewFilter builds a Filter from URL query parameters, in the same way
+// UnmarshalGetQuery builds a Query for the Path.Query handler. This runs
+// Authorise against the partial Models as UnmarshalMultiQuery does.
+func NewFilter(ctx context.Context, m Model, params url.Values) (*Filter, error) {
+	r, err := http.NewRequest(http.MethodGet, "/?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	f := &Filter{}
+	return f, UnmarshalGetQuery(r.WithContext(ctx), m, f)
+}
+
+func (f *Filter) Equal(key string, val interface{}) {
+	f.eq = append(f.eq, kv{key, val})
+}
+
+func (f *Filter) NotEqual(key string, val interface{}) {
+	f.ne = append(f.ne, kv{key, val})
+}
+
+func (f *Filter) GreaterThan(key string, val interface{}) {
+	f.gt = append(f.gt, kv{key, val})
+}
+
+func (f *Filter) LessThan(key string, val interface{}) {
+	f.lt = append(f.lt, kv{key, val})
+}
+
+func (f *Filter) Has(key string) {
+	f.has = append(f.has, key)
+}
+
+func (f *Filter) Limit(int) {}
+
+func (f *Filter) Skip(int) {}
+
+func (f *Filter) Sort(string) {}
+
+// Execute always returns ErrorFilterNotExecutable, use Match instead
+func (f *Filter) Execute(ctx context.Context) ([]Model, error) {
+	return nil, ErrorFilterNotExecutable
+}
+
+// Match returns true if m satisfies all of the Filter's predicates. Multiple
+// Equal predicates for the same key match any of their values, as they do for
+// every Store's Query, so a change feed matches the Models a query would return.
+func (f *Filter) Match(m Model) bool {
+	v := reflect.ValueOf(m)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	equals := make(map[string][]interface{})
+	for _, p := range f.eq {
+		equals[p.k] = append(equals[p.k], p.v)
+	}
+	for key, vals := range equals {
+		fv, ok := fieldByJSONName(v, key)
+		if !ok {
+			return false
+		}
+		var matched bool
+		for _, val := range vals {
+			if reflect.DeepEqual(fv.Interface(), val) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, p := range f.ne {
+		fv, ok := fieldByJSONName(v, p.k)
+		if ok && reflect.DeepEqual(fv.Interface(), p.v) {
+			return false
+		}
+	}
+	for _, p := range f.gt {
+		fv, ok := fieldByJSONName(v, p.k)
+		if !ok {
+			return false
+		}
+		if c, ok := compare(fv, p.v); !ok || c <= 0 {
+			return false
+		}
+	}
+	for _, p := range f.lt {
+		fv, ok := fieldByJSONName(v, p.k)
+		if !ok {
+			return false
+		}
+		if c, ok := compare(fv, p.v); !ok || c >= 0 {
+			return false
+		}
+	}
+	for _, key := range f.has {
+		fv, ok := fieldByJSONName(v, key)
+		if !ok || fv.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldByJSONName finds a struct field by the name in its json tag, searching
+// embedded and untagged struct fields in the same way as UnmarshalQuery
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, bool) {
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if tag == name {
+			return v.Field(i), true
+		}
+		if tag == "" && v.Field(i).Kind() == reflect.Struct {
+			if fv, ok := fieldByJSONName(v.Field(i), name); ok {
+				return fv, true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// compare returns -1, 0 or 1 if the field is less than, equal to or greater than
+// val, ok is false if the two can't be compared
+func compare(field reflect.Value, val interface{}) (int, bool) {
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return 0, false
+		}
+		field = field.Elem()
+	}
+	other := reflect.ValueOf(val)
+	for other.Kind() == reflect.Ptr {
+		if other.IsNil() {
+			return 0, false
+		}
+		other = other.Elem()
+	}
+	if field.Type() == timeType && other.Type() == timeType {
+		a, b := field.Interface().(time.Time), other.Interface().(time.Time)
+		switch {
+		case a.Before(b):
+			return -1, true
+		case a.After(b):
+			return 1, true
+		}
+		return 0, true
+	}
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch other.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return compareOrdered(float64(field.Int()), float64(other.Int())), true
+		case reflect.Float32, reflect.Float64:
+			return compareOrdered(float64(field.Int()), other.Float()), true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch other.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return compareOrdered(float64(field.Uint()), float64(other.Uint())), true
+		}
+	case reflect.Float32, reflect.Float64:
+		switch other.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return compareOrdered(field.Float(), other.Float()), true
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return compareOrdered(field.Float(), float64(other.Int())), true
+		}
+	case reflect.String:
+		if other.Kind() == reflect.String {
+			return strings.Compare(field.String(), other.String()), true
+		}
+	}
+	return 0, false
+}
+
+func compareOrdered(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package crudley_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+func TestFilter(t *testing.T) {
+	mdl := &model.TestModel{
+		StringVal: "model1",
+		IntVal:    5,
+		BoolVal:   crudley.TruePtr(),
+		StructVal: model.StructVal{Field: "foo"},
+		Owner:     "foo",
+	}
+	col, err := mem.NewStore().Collection(&model.TestModel{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	err = col.Create(context.Background(), func(id string) (crudley.Model, error) {
+		mdl.ID = id
+		return mdl, nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	for query, expected := range map[string]bool{
+		"":                                   true,
+		"owner=foo":                          true,
+		"owner=bar":                          false,
+		"owner=bar&owner=foo":                true,
+		"int_val_greaterthan=4":              true,
+		"int_val_greaterthan=5":              false,
+		"int_val_lessthan=6&owner=foo":       true,
+		"bool_val=true":                      true,
+		"bool_val=false":                     false,
+		"has=bool_val":                       true,
+		"has=time_val":                       false,
+		"string_val=model1&int_val_after=10": false,
+	} {
+		params, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		f, err := crudley.NewFilter(context.Background(), &model.TestModel{}, params)
+		if err != nil {
+			t.Fatalf("%s: expected nil, got %s", query, err)
+		}
+		if f.Match(mdl) != expected {
+			t.Errorf("%s: expected %v, got %v", query, expected, !expected)
+		}
+
+		// a Query built from the same parameters agrees with the Filter
+		r, err := http.NewRequest("GET", "/?"+query, nil)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		q := col.Query()
+		err = crudley.UnmarshalGetQuery(r, &model.TestModel{}, q)
+		if err != nil {
+			t.Fatalf("%s: expected nil, got %s", query, err)
+		}
+		res, err := q.Execute(context.Background())
+		if err != nil {
+			t.Fatalf("%s: expected nil, got %s", query, err)
+		}
+		if (len(res) == 1) != expected {
+			t.Errorf("%s: expected query match %v, got %v results", query, expected, len(res))
+		}
+	}
+}
@@ -1,15 +1,34 @@
 module github.com/arussellsaw/crudley
 
-go 1.14
+go 1.22
 
 require (
 	cloud.google.com/go/firestore v1.3.0
-	github.com/fatih/structs v1.1.0 // indirect
+	github.com/fatih/structs v1.1.0
 	github.com/google/uuid v1.1.2
-	github.com/gorilla/context v1.1.1
-	github.com/gorilla/mux v1.8.0
-	github.com/justinas/alice v1.2.0 // indirect
-	github.com/lib/pq v1.9.0
+	github.com/gorilla/websocket v1.5.3
 	google.golang.org/api v0.29.0
+	google.golang.org/grpc v1.30.0
 	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	cloud.google.com/go v0.61.0 // indirect
+	github.com/golang/groupcache v0.0.0-20200121045136-8c9f03a8e57e // indirect
+	github.com/golang/protobuf v1.5.0 // indirect
+	github.com/google/go-cmp v0.5.5 // indirect
+	github.com/googleapis/gax-go/v2 v2.0.5 // indirect
+	github.com/jstemmer/go-junit-report v0.9.1 // indirect
+	go.opencensus.io v0.22.4 // indirect
+	golang.org/x/lint v0.0.0-20200302205851-738671d3881b // indirect
+	golang.org/x/mod v0.8.0 // indirect
+	golang.org/x/net v0.19.0 // indirect
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d // indirect
+	golang.org/x/sys v0.15.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	golang.org/x/tools v0.6.0 // indirect
+	google.golang.org/appengine v1.6.6 // indirect
+	google.golang.org/genproto v0.0.0-20200728010541-3dc8dca74b7b // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
 )
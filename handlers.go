@@ -1,130 +1,374 @@
 package crudley
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
-
-	"github.com/gorilla/mux"
+	"strconv"
+	"time"
 )
 
-// ID is the commonly used mux.Var id param.
+// ID is the name of the route parameter holding a Model's ID
 const ID = "id"
 
+const (
+	// includeDeletedParam is the query parameter for including deleted Models
+	// in query results
+	includeDeletedParam = "include_deleted"
+	// asOfParam is the query parameter for retrieving a Model at a point in time
+	asOfParam = "as_of"
+)
+
+// DefaultBatchLimit is the maximum number of operations accepted by the batch
+// endpoint, unless overridden with OptionBatchLimit
+const DefaultBatchLimit = 1000
+
 func NewPath(m Model, s Store, opt ...Option) *Path {
 	p := &Path{
-		Model: m,
-		Store: s,
+		Model:          m,
+		Store:          s,
+		BatchLimit:     DefaultBatchLimit,
+		Idempotency:    NewMemIdempotencyStore(),
+		IdempotencyTTL: DefaultIdempotencyTTL,
 	}
 
 	for _, o := range opt {
 		o(p)
 	}
+	p.schema = ModelSchema(m)
+
+	p.route("GET", "/", p.Query)
+	p.route("GET", "/_openapi.json", p.OpenAPI)
+	p.route("GET", "/_schema", p.Schema)
+	if p.ChangeFeed != nil {
+		p.route("GET", "/_changes", p.Changes)
+		p.route("GET", "/_live", p.Live)
+	}
+	p.route("GET", "/{id}", p.Get)
 
-	r := mux.NewRouter()
-
-	r.Path("/").Methods("GET").HandlerFunc(p.Query)
-	r.Path("/{id}").Methods("GET").HandlerFunc(p.Get)
+	if _, ok := p.Store.(Historian); ok {
+		p.route("GET", "/{id}/_history", p.History)
+		p.route("GET", "/{id}/_history/{rev}", p.History)
+	}
 
 	if !p.ReadOnly {
-		r.Path("/").Methods("POST").HandlerFunc(p.Post)
-		r.Path("/{id}").Methods("PUT").HandlerFunc(p.Put)
-		r.Path("/{id}").Methods("DELETE").HandlerFunc(p.Delete)
+		p.route("POST", "/_batch", p.Batch)
+		p.route("POST", "/", p.Post)
+		p.route("PUT", "/{id}", p.Put)
+		p.route("DELETE", "/{id}", p.Delete)
+		p.route("POST", "/{id}/_restore", p.Restore)
 	}
 
-	p.r = r
+	if p.Router == nil {
+		p.Router = NewServeMuxRouter()
+	}
+	if p.Params == nil {
+		p.Params = PathValue
+	}
+	for _, rt := range p.routes {
+		p.Router.Handle(rt.method, rt.path, rt.handler)
+	}
 
 	return p
 }
 
 type Option func(p *Path)
 
+// route is an endpoint served by a Path
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+}
+
+func (p *Path) route(method, path string, handler http.HandlerFunc) {
+	p.routes = append(p.routes, route{method: method, path: path, handler: handler})
+}
+
 func OptionReadOnly(p *Path) {
 	p.ReadOnly = true
 }
 
+// OptionUpsert makes PUT requests create the Model if it doesn't exist, using
+// the ID from the URL. This requires the Store's Collection to implement IDCreater
+func OptionUpsert(p *Path) {
+	p.Upsert = true
+}
+
+// OptionHardDelete makes DELETE requests remove Models from the Collection,
+// rather than marking them as deleted with Model.Delete
+func OptionHardDelete(p *Path) {
+	p.HardDelete = true
+}
+
+// OptionIDGenerator sets the IDGenerator used for Models created by the Path
+func OptionIDGenerator(g IDGenerator) Option {
+	return func(p *Path) {
+		p.IDGenerator = g
+	}
+}
+
+// OptionBatchLimit sets the maximum number of operations in a batch request
+func OptionBatchLimit(n int) Option {
+	return func(p *Path) {
+		p.BatchLimit = n
+	}
+}
+
 // Path manages building a set of RESTful endpoints for any given Model, using
 // the provided Store for a database backend
 type Path struct {
 	Model Model
 	Store Store
 
-	r *mux.Router
+	routes []route
+	schema *Schema
 
 	c Collection
 
-	ReadOnly bool
-}
+	ReadOnly    bool
+	Upsert      bool
+	HardDelete  bool
+	BatchLimit  int
+	IDGenerator IDGenerator
+
+	Idempotency    IdempotencyStore
+	IdempotencyTTL time.Duration
+
+	Observers  []Observer
+	ChangeFeed *ChangeFeed
+
+	Tenant      TenantResolver
+	TenantField string
+	TenantStore TenantStoreFunc
 
+	Roles      RoleResolver
+	Principal  PrincipalResolver
+	Authoriser ModelAuthoriser
+
+	Router Router
+	Params ParamFunc
+}
 
 func (p *Path) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	p.r.ServeHTTP(w, r)
+	if p.Principal != nil {
+		principal, err := p.Principal(r)
+		if err != nil {
+			res := &Response{}
+			res.AddError(err)
+			res.SetStatusCode(http.StatusUnauthorized)
+			WriteResponse(w, res)
+			return
+		}
+		r = r.WithContext(WithPrincipal(r.Context(), principal))
+	}
+	if p.Tenant != nil {
+		tenant, err := p.Tenant(r)
+		if err == nil && tenant == "" {
+			err = ErrorNoTenant
+		}
+		if err != nil {
+			res := &Response{}
+			res.AddError(err)
+			res.SetStatusCode(http.StatusUnauthorized)
+			WriteResponse(w, res)
+			return
+		}
+		r = r.WithContext(WithTenant(r.Context(), tenant))
+	}
+	if p.Roles != nil {
+		r = r.WithContext(WithRoles(r.Context(), p.Roles(r)))
+	}
+	ctx := r.Context()
+	if p.Authoriser != nil {
+		ctx = context.WithValue(ctx, authoriserKey{}, p.Authoriser)
+	}
+	r = r.WithContext(context.WithValue(ctx, requestKey{}, r))
+	p.Router.ServeHTTP(w, r)
 }
 
 // InitHandler ensures the collection is initialized for the path, and retrieves
-// the response for the request
-func (p *Path) initHandler() (Collection, *Response, error) {
+// the response for the request. On failure the response holds the error, and
+// should be written by the caller.
+func (p *Path) initHandler(ctx context.Context) (Collection, *Response, error) {
 	var (
-		res = &Response{}
+		res = &Response{roles: RolesFromContext(ctx)}
 		err error
 	)
 
-	c, err := p.Store.Collection(p.Model)
+	s, err := p.store(ctx)
+	if err != nil {
+		res.AddError(fmt.Errorf("failed to retrieve Store: %s", err.Error()))
+		res.SetStatusCode(http.StatusInternalServerError)
+		return nil, res, fmt.Errorf("failed to init store")
+	}
+	c, err := p.collection(ctx, s)
 	if err != nil {
 		res.AddError(fmt.Errorf("failed to retrieve Collection: %s", err.Error()))
 		res.SetStatusCode(http.StatusInternalServerError)
-		return nil, nil, fmt.Errorf("failed to init collection")
+		return nil, res, fmt.Errorf("failed to init collection")
 	}
 	return c, res, nil
 }
 
-// Query accepts a partial model and looks up the result
+// Query accepts a partial model and looks up the result. Deleted Models are
+// excluded unless the query parameter include_deleted=true is set, and is
+// permitted by the Model's Authoriser.
 func (p *Path) Query(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	c, res, err := p.initHandler()
+	c, res, err := p.initHandler(ctx)
 	if err != nil {
+		WriteResponse(w, res)
 		return
 	}
 	defer WriteResponse(w, res)
+
+	models, code, err := p.query(ctx, c, r)
+	if err != nil {
+		res.AddError(err)
+		res.SetStatusCode(code)
+		return
+	}
+	res.AddModel(models...)
+}
+
+// query runs the Query described by the request's parameters
+func (p *Path) query(ctx context.Context, c Collection, r *http.Request) ([]Model, int, error) {
 	out := p.Model.New("")
 
-	q := c.Query()
+	var (
+		includeDeleted bool
+		err            error
+	)
+	if v := r.URL.Query().Get(includeDeletedParam); v != "" {
+		includeDeleted, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("failed to parse %s: %s", includeDeletedParam, v)
+		}
+	}
+	if includeDeleted {
+		if err := authorise(ctx, out, Action{Method: http.MethodGet, Op: OpList, Request: r, IncludeDeleted: true, Partial: true}); err != nil {
+			return nil, http.StatusUnauthorized, err
+		}
+	}
+
+	err = checkQueryable(out, r.URL.Query(), RolesFromContext(ctx))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	q := &pagedQuery{Query: c.Query()}
 	err = UnmarshalGetQuery(r, out, q)
 	if err != nil {
-		res.AddError(fmt.Errorf("failed to build Query: %s", err.Error()))
-		res.SetStatusCode(http.StatusBadRequest)
-		return
+		return nil, http.StatusBadRequest, fmt.Errorf("failed to build Query: %s", err.Error())
+	}
+	if qa, ok := p.Authoriser.(ModelQueryAuthoriser); ok {
+		if err := qa.AuthoriseModelQuery(ctx, out, q); err != nil {
+			return nil, http.StatusUnauthorized, err
+		}
+	}
+	if qa, ok := out.(QueryAuthoriser); ok {
+		if err := qa.AuthoriseQuery(ctx, q); err != nil {
+			return nil, http.StatusUnauthorized, err
+		}
 	}
 
-	models, err := q.Execute(ctx)
+	results, err := q.execute(ctx, func(m Model) bool {
+		if m.IsDeleted() && !includeDeleted {
+			return false
+		}
+		return authorise(ctx, m, Action{Method: http.MethodGet, Op: OpList, Request: r}) == nil
+	})
 	if err != nil {
-		res.AddError(fmt.Errorf("unexpected error: %s", err.Error()))
-		res.SetStatusCode(http.StatusInternalServerError)
-		return
+		return nil, http.StatusInternalServerError, fmt.Errorf("unexpected error: %s", err.Error())
 	}
-	for _, m := range models {
-		res.AddModel(m)
+	return results, http.StatusOK, nil
+}
+
+// pagedQuery applies Skip and Limit after results have been filtered, so that
+// filtering doesn't change the size of a page or skip over results
+type pagedQuery struct {
+	Query
+	skip, limit int
+}
+
+func (q *pagedQuery) Skip(n int) {
+	q.skip = n
+}
+
+func (q *pagedQuery) Limit(n int) {
+	q.limit = n
+}
+
+// execute runs the Query, returning the page of results for which keep is true.
+// Limited queries are executed a page at a time until the page is filled.
+func (q *pagedQuery) execute(ctx context.Context, keep func(Model) bool) ([]Model, error) {
+	var (
+		results []Model
+		skipped int
+		offset  int
+	)
+	for {
+		q.Query.Skip(offset)
+		if q.limit > 0 {
+			q.Query.Limit(q.limit)
+		}
+		models, err := q.Query.Execute(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range models {
+			if !keep(m) {
+				continue
+			}
+			if skipped < q.skip {
+				skipped++
+				continue
+			}
+			results = append(results, m)
+			if q.limit > 0 && len(results) == q.limit {
+				return results, nil
+			}
+		}
+		if q.limit == 0 || len(models) < q.limit {
+			return results, nil
+		}
+		offset += len(models)
 	}
 }
 
-// Get is the http handler for the GET method
+// Get is the http handler for the GET method, if the Path's Store is a Historian
+// then the as_of query parameter retrieves the Model as it was at an RFC 3339
+// timestamp
 func (p *Path) Get(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	c, res, err := p.initHandler()
+	c, res, err := p.initHandler(ctx)
 	if err != nil {
+		WriteResponse(w, res)
 		return
 	}
 	defer WriteResponse(w, res)
 
-	vars := mux.Vars(r)
-	id, ok := vars[ID]
-	if !ok {
+	id := p.Params(r, ID)
+	if id == "" {
 		res.AddError(ErrorNoID)
 		res.SetStatusCode(http.StatusBadRequest)
 		return
 	}
 
-	model, err := c.View(ctx, id)
+	var model Model
+	if asOf := r.URL.Query().Get(asOfParam); asOf != "" {
+		var code int
+		model, code, err = p.asOf(ctx, c, id, asOf)
+		if err != nil {
+			res.AddError(err)
+			res.SetStatusCode(code)
+			return
+		}
+	} else {
+		model, err = c.View(ctx, id)
+	}
 	if err != nil {
 		res.AddError(fmt.Errorf("failed to retrieve Model from collection: %s", err.Error()))
 		res.SetStatusCode(http.StatusInternalServerError)
@@ -135,11 +379,10 @@ func (p *Path) Get(w http.ResponseWriter, r *http.Request) {
 		res.SetStatusCode(http.StatusNotFound)
 		return
 	}
-	if a, ok := model.(Authoriser); ok {
-		if err := a.Authorise(ctx, Action{Method: http.MethodGet}); err != nil {
-			res.AddError(err)
-			res.SetStatusCode(http.StatusNotFound)
-		}
+	if err := authorise(ctx, model, Action{Method: http.MethodGet, Op: OpGet, Request: r}); err != nil {
+		res.AddError(err)
+		res.SetStatusCode(http.StatusNotFound)
+		return
 	}
 	if model.IsDeleted() {
 		res.AddError(ErrorModelNotFound)
@@ -150,144 +393,318 @@ func (p *Path) Get(w http.ResponseWriter, r *http.Request) {
 	res.AddModel(model)
 }
 
-// Post saves a Model to the Store
+// Post saves a Model to the Store. Requests with an Idempotency-Key header are
+// only applied once, retries receive the original response.
 func (p *Path) Post(w http.ResponseWriter, r *http.Request) {
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" && p.Idempotency != nil {
+		p.idempotentPost(w, r, key)
+		return
+	}
+	p.post(w, r)
+}
+
+func (p *Path) post(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	c, res, err := p.initHandler()
+	c, res, err := p.initHandler(ctx)
 	if err != nil {
+		WriteResponse(w, res)
 		return
 	}
 	defer WriteResponse(w, res)
 
-	var out Model
-	err = c.Create(ctx, func(id string) (Model, error) {
-		out = p.Model.New(id)
-
-		err := json.NewDecoder(r.Body).Decode(&RestrictedModel{out})
-		if err != nil {
-			return out, err
-		}
-
-		if a, ok := out.(Authoriser); ok {
-			if err := a.Authorise(ctx, Action{Method: http.MethodPost}); err != nil {
-				res.SetStatusCode(http.StatusUnauthorized)
-				return out, err
-			}
-		}
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		res.AddError(ErrorMalformedJSON)
+		res.SetStatusCode(http.StatusBadRequest)
+		return
+	}
 
-		return out, err
-	})
+	out, code, err := p.create(ctx, c, "", buf)
 	if err != nil {
-		res.AddError(fmt.Errorf("failed to create Model: %s", err.Error()))
-		if res.GetStatusCode() == 0 {
-			res.SetStatusCode(http.StatusInternalServerError)
-		}
+		res.AddError(err)
+		res.SetStatusCode(code)
 		return
 	}
 
+	p.emit(ctx, ChangeCreated, out)
 	res.AddModel(out)
 }
 
 // Put handles partial JSON to update a Model
 func (p *Path) Put(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	c, res, err := p.initHandler()
+	c, res, err := p.initHandler(ctx)
 	if err != nil {
+		WriteResponse(w, res)
 		return
 	}
 	defer WriteResponse(w, res)
 
-	vars := mux.Vars(r)
-	id, ok := vars[ID]
-	if !ok {
+	id := p.Params(r, ID)
+	if id == "" {
 		res.AddError(ErrorNoID)
 		res.SetStatusCode(http.StatusBadRequest)
 		return
 	}
 
-	m, err := c.View(ctx, id)
+	buf, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		if _, ok := err.(NotFoundError); ok {
-			res.AddError(ErrorModelNotFound)
-			res.SetStatusCode(http.StatusNotFound)
-			return
-		}
-		res.AddError(fmt.Errorf("failed to retrieve Model from collection: %s", err.Error()))
-		res.SetStatusCode(http.StatusInternalServerError)
+		res.AddError(ErrorMalformedJSON)
+		res.SetStatusCode(http.StatusBadRequest)
 		return
 	}
 
-	if a, ok := m.(Authoriser); ok {
-		if err := a.Authorise(ctx, Action{Method: http.MethodPut}); err != nil {
-			res.AddError(err)
-			res.SetStatusCode(http.StatusUnauthorized)
-			return
-		}
+	m, code, err := p.update(ctx, c, id, buf)
+	res.SetStatusCode(code)
+	if err != nil {
+		res.AddError(err)
+		return
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&RestrictedModel{m})
+	if code == http.StatusCreated {
+		p.emit(ctx, ChangeCreated, m)
+	} else {
+		p.emit(ctx, ChangeUpdated, m)
+	}
+	res.AddModel(m)
+}
+
+// Delete handles deleting the Model specified by the route parameter "id", by default
+// the Model is marked as deleted rather than removed from the Collection
+func (p *Path) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	c, res, err := p.initHandler(ctx)
 	if err != nil {
-		res.AddError(ErrorMalformedJSON)
+		WriteResponse(w, res)
+		return
+	}
+	defer WriteResponse(w, res)
+
+	id := p.Params(r, ID)
+	if id == "" {
+		res.AddError(ErrorNoID)
 		res.SetStatusCode(http.StatusBadRequest)
 		return
 	}
 
-	err = c.Update(ctx, m.PrimaryKey(), m)
+	m, code, err := p.remove(ctx, c, id)
 	if err != nil {
-		res.AddError(fmt.Errorf("failed to update Model: %s", err.Error()))
-		res.SetStatusCode(http.StatusInternalServerError)
+		res.AddError(err)
+		res.SetStatusCode(code)
 		return
 	}
 
+	p.emit(ctx, ChangeDeleted, m)
 	res.AddModel(m)
 }
 
-// Delete handles deleting the Model specified by the mux var "id"
-func (p *Path) Delete(w http.ResponseWriter, r *http.Request) {
+// Restore handles restoring a deleted Model specified by the route parameter "id"
+func (p *Path) Restore(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	c, res, err := p.initHandler()
+	c, res, err := p.initHandler(ctx)
 	if err != nil {
+		WriteResponse(w, res)
 		return
 	}
 	defer WriteResponse(w, res)
 
-	id, ok := mux.Vars(r)[ID]
-	if !ok {
+	id := p.Params(r, ID)
+	if id == "" {
 		res.AddError(ErrorNoID)
 		res.SetStatusCode(http.StatusBadRequest)
 		return
 	}
 
-	m, err := c.View(ctx, id)
+	m, code, err := p.restore(ctx, c, id)
 	if err != nil {
-		if _, ok := err.(NotFoundError); ok {
-			res.AddError(ErrorModelNotFound)
-			return
-		}
-		res.AddError(fmt.Errorf("failed to retrieve Model: %s", err.Error()))
-		res.SetStatusCode(http.StatusInternalServerError)
+		res.AddError(err)
+		res.SetStatusCode(code)
 		return
 	}
 
+	p.emit(ctx, ChangeUpdated, m)
+	res.AddModel(m)
+}
+
+// create decodes a new Model from buf and saves it to the Collection, returning
+// the status code to respond with on failure. If id is empty the Collection
+// generates one, otherwise the Collection must implement IDCreater.
+func (p *Path) create(ctx context.Context, c Collection, id string, buf []byte) (Model, int, error) {
+	if err := p.schema.ValidateJSON(buf, false); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	var (
+		out  Model
+		code int
+	)
+	fn := func(id string) (Model, error) {
+		out = p.Model.New(id)
+
+		err := json.Unmarshal(buf, &RestrictedModel{Model: out, Roles: RolesFromContext(ctx)})
+		if err != nil {
+			return out, err
+		}
+
+		if err := authorise(ctx, out, Action{Method: http.MethodPost, Op: OpCreate}); err != nil {
+			code = http.StatusUnauthorized
+			return out, err
+		}
+
+		return out, err
+	}
+	var err error
+	if id == "" {
+		if p.IDGenerator != nil {
+			ctx = WithIDGenerator(ctx, p.IDGenerator)
+		}
+		err = c.Create(ctx, fn)
+	} else if ic, ok := c.(IDCreater); ok {
+		err = ic.CreateWithID(ctx, id, fn)
+		if _, ok := err.(ConflictError); ok {
+			return nil, http.StatusConflict, err
+		}
+	} else {
+		return nil, http.StatusNotImplemented, ErrorClientIDUnsupported
+	}
+	if err != nil {
+		if code == 0 {
+			code = http.StatusInternalServerError
+		}
+		return nil, code, fmt.Errorf("failed to create Model: %s", err.Error())
+	}
+	return out, http.StatusOK, nil
+}
+
+// update applies the partial JSON in buf to the Model with the given id. If
+// the Path allows upserts and the Model doesn't exist it is created instead,
+// with the status code http.StatusCreated. An id taken by another tenant's Model
+// is not found, as it is for any other request.
+func (p *Path) update(ctx context.Context, c Collection, id string, buf []byte) (Model, int, error) {
+	if err := p.schema.ValidateJSON(buf, true); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	m, err := c.View(ctx, id)
+	if _, ok := err.(NotFoundError); ok {
+		m, err = nil, nil
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to retrieve Model from collection: %s", err.Error())
+	}
 	if m == nil {
-		res.AddError(ErrorModelNotFound)
-		return
+		if !p.Upsert {
+			return nil, http.StatusNotFound, ErrorModelNotFound
+		}
+		m, code, err := p.create(ctx, c, id, buf)
+		if code == http.StatusConflict && p.Tenant != nil {
+			// the id belongs to another tenant's Model, which mustn't be revealed
+			return nil, http.StatusNotFound, ErrorModelNotFound
+		}
+		if err != nil {
+			return nil, code, err
+		}
+		return m, http.StatusCreated, nil
+	}
+	if m.IsDeleted() {
+		return nil, http.StatusNotFound, ErrorModelNotFound
 	}
 
-	if a, ok := m.(Authoriser); ok {
-		if err := a.Authorise(ctx, Action{Method: http.MethodDelete}); err != nil {
-			res.AddError(err)
-			res.SetStatusCode(http.StatusUnauthorized)
-			return
+	if err := authorise(ctx, m, Action{Method: http.MethodPut, Op: OpUpdate}); err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	var prev Model
+	if hasAuthoriser(ctx, m) {
+		prev, err = copyModel(m)
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("failed to copy Model: %s", err.Error())
+		}
+	}
+	err = json.Unmarshal(buf, &RestrictedModel{Model: m, Roles: RolesFromContext(ctx)})
+	if err != nil {
+		return nil, http.StatusBadRequest, ErrorMalformedJSON
+	}
+	if prev != nil {
+		// the update is authorised again with the changes applied
+		changes, err := changedFields(prev, m)
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("failed to compare Models: %s", err.Error())
+		}
+		err = authorise(ctx, m, Action{Method: http.MethodPut, Op: OpUpdate, Previous: prev, Changes: changes})
+		if err != nil {
+			return nil, http.StatusUnauthorized, err
 		}
 	}
 
-	err = c.Delete(ctx, id)
+	err = c.Update(ctx, m.PrimaryKey(), m)
+	if err == ErrorTenantMismatch {
+		return nil, http.StatusForbidden, err
+	}
 	if err != nil {
-		res.AddError(fmt.Errorf("failed to delete Model: %s", err.Error()))
-		res.SetStatusCode(http.StatusInternalServerError)
-		return
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to update Model: %s", err.Error())
 	}
+	return m, http.StatusOK, nil
+}
 
-	res.AddModel(m)
+// remove marks the Model with the given id as deleted, or removes it from the
+// Collection if the Path uses hard deletes
+func (p *Path) remove(ctx context.Context, c Collection, id string) (Model, int, error) {
+	m, err := c.View(ctx, id)
+	if err != nil {
+		if _, ok := err.(NotFoundError); ok {
+			return nil, http.StatusNotFound, ErrorModelNotFound
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to retrieve Model: %s", err.Error())
+	}
+
+	if m == nil || m.IsDeleted() {
+		return nil, http.StatusNotFound, ErrorModelNotFound
+	}
+
+	if err := authorise(ctx, m, Action{Method: http.MethodDelete, Op: OpDelete}); err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	if p.HardDelete {
+		err = c.Delete(ctx, id)
+	} else {
+		m.Delete()
+		err = c.Update(ctx, id, m)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to delete Model: %s", err.Error())
+	}
+	return m, http.StatusOK, nil
+}
+
+// restore reverses a soft delete of the Model with the given id
+func (p *Path) restore(ctx context.Context, c Collection, id string) (Model, int, error) {
+	m, err := c.View(ctx, id)
+	if err != nil {
+		if _, ok := err.(NotFoundError); ok {
+			return nil, http.StatusNotFound, ErrorModelNotFound
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to retrieve Model: %s", err.Error())
+	}
+	if m == nil {
+		return nil, http.StatusNotFound, ErrorModelNotFound
+	}
+
+	rm, ok := m.(Restorer)
+	if !ok {
+		return nil, http.StatusNotImplemented, ErrorRestoreUnsupported
+	}
+
+	if err := authorise(ctx, m, Action{Method: http.MethodPost, Op: OpRestore}); err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	if !m.IsDeleted() {
+		return m, http.StatusOK, nil
+	}
+	rm.Restore()
+	err = c.Update(ctx, id, m)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to restore Model: %s", err.Error())
+	}
+	return m, http.StatusOK, nil
 }
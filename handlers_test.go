@@ -9,9 +9,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
-
-	"github.com/gorilla/mux"
+	"time"
 
 	"github.com/arussellsaw/crudley"
 	"github.com/arussellsaw/crudley/stores/mem"
@@ -20,7 +20,7 @@ import (
 
 var client = http.Client{}
 
-func setUpTestPath() (*mux.Router, *crudley.Path, error) {
+func setUpTestPath() (*http.ServeMux, *crudley.Path, error) {
 	store := mem.NewStore()
 	col, err := store.Collection(&model.TestModel{})
 	if err != nil {
@@ -30,35 +30,35 @@ func setUpTestPath() (*mux.Router, *crudley.Path, error) {
 		&model.TestModel{
 			StringVal: "model1",
 			IntVal:    1,
-			Owner: 	   "foo",
+			Owner:     "foo",
 		},
 		&model.TestModel{
 			StringVal: "model2",
 			IntVal:    2,
 			StructVal: model.StructVal{
-				"foo",
+				Field: "foo",
 			},
-			Owner: 	   "foo",
+			Owner: "foo",
 		},
 		&model.TestModel{
 			StringVal: "model3",
 			IntVal:    3,
-			Owner: 	   "foo",
+			Owner:     "foo",
 		},
 		&model.TestModel{
 			StringVal: "model4",
 			IntVal:    4,
-			Owner: 	   "bar",
+			Owner:     "bar",
 		},
 		&model.TestModel{
 			StringVal: "model5",
 			IntVal:    5,
-			Owner: 	   "bar",
+			Owner:     "bar",
 		},
 		&model.TestModel{
 			StringVal: "model6",
 			IntVal:    6,
-			Owner: 	   "bar",
+			Owner:     "bar",
 		},
 	}
 	for _, mdl := range testModels {
@@ -70,9 +70,9 @@ func setUpTestPath() (*mux.Router, *crudley.Path, error) {
 			return nil, nil, err
 		}
 	}
-	r := mux.NewRouter()
+	r := http.NewServeMux()
 	p := crudley.NewPath(&model.TestModel{}, store)
-	r.PathPrefix("/api/test/").Handler(http.StripPrefix("/api/test", p))
+	r.Handle("/api/test/", http.StripPrefix("/api/test", p))
 
 	return r, p, nil
 }
@@ -135,9 +135,6 @@ func TestGETID(t *testing.T) {
 	if err != nil {
 		t.Errorf("expected nil, got %s", err)
 	}
-	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println(r.URL.String())
-	})
 	s := httptest.NewServer(r)
 	defer s.Close()
 	tmr, err := testHandler("GET", fmt.Sprintf("%s/api/test/%s", s.URL, mID), nil)
@@ -234,6 +231,61 @@ func TestPUT(t *testing.T) {
 	}
 }
 
+func TestPUTUpsert(t *testing.T) {
+	store := mem.NewStore()
+	r := http.NewServeMux()
+	r.Handle("/api/test/", http.StripPrefix("/api/test", crudley.NewPath(&model.TestModel{}, store, crudley.OptionUpsert)))
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	modelBuf := `{"string_val": "upserted", "int_val": 7}`
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/api/test/natural-key", s.URL), bytes.NewBufferString(modelBuf))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("expected 201, got %v", res.StatusCode)
+	}
+
+	modelBuf = `{"string_val": "updated"}`
+	req, err = http.NewRequest("PUT", fmt.Sprintf("%s/api/test/natural-key", s.URL), bytes.NewBufferString(modelBuf))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %v", res.StatusCode)
+	}
+
+	col, err := store.Collection(&model.TestModel{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	mdl, err := col.View(context.Background(), "natural-key")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	tmdl := mdl.(*model.TestModel)
+	if tmdl.ID != "natural-key" {
+		t.Errorf("expected natural-key, got %s", tmdl.ID)
+	}
+	if tmdl.StringVal != "updated" {
+		t.Errorf("expected updated, got %s", tmdl.StringVal)
+	}
+	if tmdl.IntVal != 7 {
+		t.Errorf("expected 7, got %v", tmdl.IntVal)
+	}
+}
+
 func TestDELETE(t *testing.T) {
 	r, path, err := setUpTestPath()
 	if err != nil {
@@ -261,8 +313,187 @@ func TestDELETE(t *testing.T) {
 	if err != nil {
 		t.Errorf("expected nil, got %s", err)
 	}
+	if mdl == nil || !mdl.IsDeleted() {
+		t.Errorf("expected deleted model, got %v", mdl)
+	}
+
+	// deleted models are excluded from queries unless asked for
+	tmr, err := testHandler("GET", fmt.Sprintf("%s/api/test/?string_val=newmodel", s.URL), nil)
+	if err != nil {
+		t.Errorf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	if len(tmr.Results) != 0 {
+		t.Errorf("expected 0, got %v", len(tmr.Results))
+	}
+	tmr, err = testHandler("GET", fmt.Sprintf("%s/api/test/?string_val=newmodel&include_deleted=true", s.URL), nil)
+	if err != nil {
+		t.Errorf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	if len(tmr.Results) != 1 {
+		t.Errorf("expected 1, got %v", len(tmr.Results))
+	}
+	tmr, err = testHandler("GET", fmt.Sprintf("%s/api/test/%s", s.URL, mID), nil)
+	if err != nil {
+		t.Errorf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	if len(tmr.Results) != 0 {
+		t.Errorf("expected 0, got %v", len(tmr.Results))
+	}
+
+	tmr, err = testHandler("POST", fmt.Sprintf("%s/api/test/%s/_restore", s.URL, mID), nil)
+	if err != nil {
+		t.Errorf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	if len(tmr.Results) != 1 || tmr.Results[0].Deleted {
+		t.Errorf("expected restored model, got %s", string(tmr.RawResponse))
+	}
+	mdl, err = col.View(context.Background(), mID)
+	if err != nil {
+		t.Errorf("expected nil, got %s", err)
+	}
+	if mdl == nil || mdl.IsDeleted() {
+		t.Errorf("expected restored model, got %v", mdl)
+	}
+}
+
+func TestDELETEIncludeDeletedUnauthorised(t *testing.T) {
+	model.AuthoriseFunc = func(ctx context.Context, action crudley.Action, m *model.TestModel) error {
+		if action.IncludeDeleted {
+			return fmt.Errorf("unauthorised!")
+		}
+		return nil
+	}
+	defer func() { model.AuthoriseFunc = nil }()
+	r, _, err := setUpTestPath()
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	s := httptest.NewServer(r)
+	defer s.Close()
+	tmr, err := testHandler("GET", fmt.Sprintf("%s/api/test/?include_deleted=true", s.URL), nil)
+	if err != nil {
+		t.Errorf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	if len(tmr.Error) == 0 {
+		t.Errorf("expected some errors, got none")
+	}
+	if len(tmr.Results) != 0 {
+		t.Errorf("expected 0, got %v", len(tmr.Results))
+	}
+}
+
+func TestHardDELETE(t *testing.T) {
+	store := mem.NewStore()
+	col, err := store.Collection(&model.TestModel{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	var mID string
+	err = col.Create(context.Background(), func(id string) (crudley.Model, error) {
+		mID = id
+		return &model.TestModel{ID: id, StringVal: "newmodel"}, nil
+	})
+	if err != nil {
+		t.Errorf("expected nil, got %s", err)
+	}
+	r := http.NewServeMux()
+	r.Handle("/api/test/", http.StripPrefix("/api/test", crudley.NewPath(&model.TestModel{}, store, crudley.OptionHardDelete)))
+	s := httptest.NewServer(r)
+	defer s.Close()
+	_, err = testHandler("DELETE", fmt.Sprintf("%s/api/test/%s", s.URL, mID), nil)
+	if err != nil {
+		t.Errorf("expected nil, got %s", err)
+	}
+	mdl, err := col.View(context.Background(), mID)
+	if err != nil {
+		t.Errorf("expected nil, got %s", err)
+	}
 	if mdl != nil {
-		t.Errorf("expected nil, got %v",mdl)
+		t.Errorf("expected nil, got %v", mdl)
+	}
+}
+
+func TestAuthoriseQueryResults(t *testing.T) {
+	model.AuthoriseFunc = func(ctx context.Context, action crudley.Action, m *model.TestModel) error {
+		// partial models for the query have no ID
+		if m.ID != "" && m.Owner != "foo" {
+			return fmt.Errorf("unauthorised!")
+		}
+		return nil
+	}
+	defer func() { model.AuthoriseFunc = nil }()
+	r, p, err := setUpTestPath()
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	for query, expected := range map[string][]string{
+		"":                      {"model1", "model2", "model3"},
+		"skip=1&limit=2":        {"model2", "model3"},
+		"skip=2&limit=2":        {"model3"},
+		"owner=bar":             nil,
+		"int_val_greaterthan=2": {"model3"},
+	} {
+		tmr, err := testHandler("GET", fmt.Sprintf("%s/api/test/?sort=int_val&%s", s.URL, query), nil)
+		if err != nil {
+			t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+		}
+		var vals []string
+		for _, m := range tmr.Results {
+			vals = append(vals, m.StringVal)
+		}
+		if !reflect.DeepEqual(vals, expected) {
+			t.Errorf("expected %v for %q, got %v", expected, query, vals)
+		}
+	}
+
+	// Get refuses the same Models
+	col, err := p.Store.Collection(&model.TestModel{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	var barID string
+	col.Scan(context.Background(), func(m crudley.Model) error {
+		if m.(*model.TestModel).Owner == "bar" {
+			barID = m.PrimaryKey()
+		}
+		return nil
+	})
+	tmr, err := testHandler("GET", fmt.Sprintf("%s/api/test/%s", s.URL, barID), nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	if len(tmr.Results) != 0 || tmr.Error == "" {
+		t.Errorf("expected an error, got %v", tmr.Results)
+	}
+}
+
+func TestAuthoriseQuery(t *testing.T) {
+	model.AuthoriseQueryFunc = func(ctx context.Context, q crudley.Query) error {
+		q.Equal("owner", "bar")
+		return nil
+	}
+	defer func() { model.AuthoriseQueryFunc = nil }()
+	r, _, err := setUpTestPath()
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	tmr, err := testHandler("GET", fmt.Sprintf("%s/api/test/", s.URL), nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	if len(tmr.Results) != 3 {
+		t.Errorf("expected 3, got %v", len(tmr.Results))
+	}
+	for _, m := range tmr.Results {
+		if m.Owner != "bar" {
+			t.Errorf("expected bar, got %s", m.Owner)
+		}
 	}
 }
 
@@ -278,7 +509,7 @@ func TestAuthoriseGET(t *testing.T) {
 		}
 		return nil
 	}
-	defer func() {model.AuthoriseFunc = nil}()
+	defer func() { model.AuthoriseFunc = nil }()
 	r, _, err := setUpTestPath()
 	if err != nil {
 		t.Fatalf("expected nil, got %s", err)
@@ -319,3 +550,220 @@ func TestAuthoriseGET(t *testing.T) {
 		return
 	}
 }
+
+func TestBatch(t *testing.T) {
+	r, path, err := setUpTestPath()
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	col, err := path.Store.Collection(&model.TestModel{})
+	if err != nil {
+		t.Errorf("expected nil, got %s", err)
+	}
+	var mID string
+	err = col.Create(context.Background(), func(id string) (crudley.Model, error) {
+		mID = id
+		return &model.TestModel{ID: id, StringVal: "newmodel", IntVal: 45}, nil
+	})
+	if err != nil {
+		t.Errorf("expected nil, got %s", err)
+	}
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	batchBuf := fmt.Sprintf(`{"operations": [
+		{"op": "create", "data": {"string_val": "batch1"}},
+		{"op": "update", "id": "%s", "data": {"string_val": "batchupdated"}},
+		{"op": "delete", "id": "missing"}
+	]}`, mID)
+	tmr, err := testHandler("POST", fmt.Sprintf("%s/api/test/_batch", s.URL), bytes.NewBufferString(batchBuf))
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	if len(tmr.Batch) != 3 {
+		t.Fatalf("expected 3, got %v", len(tmr.Batch))
+	}
+	if tmr.Batch[0].Status != http.StatusOK || tmr.Batch[0].Result.StringVal != "batch1" {
+		t.Errorf("expected created batch1, got %+v", tmr.Batch[0])
+	}
+	if tmr.Batch[1].Status != http.StatusOK || tmr.Batch[1].Result.IntVal != 45 {
+		t.Errorf("expected updated model, got %+v", tmr.Batch[1])
+	}
+	if tmr.Batch[2].Status != http.StatusNotFound {
+		t.Errorf("expected 404, got %v", tmr.Batch[2].Status)
+	}
+	mdl, err := col.View(context.Background(), mID)
+	if err != nil {
+		t.Errorf("expected nil, got %s", err)
+	}
+	if mdl.(*model.TestModel).StringVal != "batchupdated" {
+		t.Errorf("expected batchupdated, got %s", mdl.(*model.TestModel).StringVal)
+	}
+
+	// atomic batches are rolled back if any operation fails
+	batchBuf = fmt.Sprintf(`{"atomic": true, "operations": [
+		{"op": "update", "id": "%s", "data": {"string_val": "atomic"}},
+		{"op": "update", "id": "missing", "data": {"string_val": "atomic"}},
+		{"op": "create", "data": {"string_val": "atomic"}}
+	]}`, mID)
+	tmr, err = testHandler("POST", fmt.Sprintf("%s/api/test/_batch", s.URL), bytes.NewBufferString(batchBuf))
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	if len(tmr.Error) == 0 {
+		t.Errorf("expected some errors, got none")
+	}
+	if len(tmr.Batch) != 3 {
+		t.Fatalf("expected 3, got %v", len(tmr.Batch))
+	}
+	for i, status := range []int{http.StatusFailedDependency, http.StatusNotFound, http.StatusFailedDependency} {
+		if tmr.Batch[i].Status != status {
+			t.Errorf("expected %v, got %v", status, tmr.Batch[i].Status)
+		}
+	}
+	mdl, err = col.View(context.Background(), mID)
+	if err != nil {
+		t.Errorf("expected nil, got %s", err)
+	}
+	if mdl.(*model.TestModel).StringVal != "batchupdated" {
+		t.Errorf("expected batchupdated, got %s", mdl.(*model.TestModel).StringVal)
+	}
+	tmr, err = testHandler("GET", fmt.Sprintf("%s/api/test/?string_val=atomic", s.URL), nil)
+	if err != nil {
+		t.Errorf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	if len(tmr.Results) != 0 {
+		t.Errorf("expected 0, got %v", len(tmr.Results))
+	}
+}
+
+func TestPOSTIdempotency(t *testing.T) {
+	for name, idempotency := range map[string]crudley.IdempotencyStore{
+		"mem":   crudley.NewMemIdempotencyStore(),
+		"store": crudley.NewIdempotencyStore(mem.NewStore()),
+	} {
+		store := mem.NewStore()
+		r := http.NewServeMux()
+		p := crudley.NewPath(&model.TestModel{}, store, crudley.OptionIdempotency(idempotency, time.Hour))
+		r.Handle("/api/test/", http.StripPrefix("/api/test", p))
+		s := httptest.NewServer(r)
+
+		post := func(key, body string) (*http.Response, model.TestModelResponse) {
+			tmr := model.TestModelResponse{}
+			req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/test/", s.URL), bytes.NewBufferString(body))
+			if err != nil {
+				t.Fatalf("%s: expected nil, got %s", name, err)
+			}
+			req.Header.Set(crudley.IdempotencyKeyHeader, key)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("%s: expected nil, got %s", name, err)
+			}
+			defer res.Body.Close()
+			err = json.NewDecoder(res.Body).Decode(&tmr)
+			if err != nil {
+				t.Fatalf("%s: expected nil, got %s", name, err)
+			}
+			return res, tmr
+		}
+
+		_, first := post("key-1", `{"string_val": "test1"}`)
+		res, retry := post("key-1", `{"string_val": "test1"}`)
+		if len(first.Results) != 1 || len(retry.Results) != 1 {
+			t.Fatalf("%s: expected 1 result, got %v and %v", name, len(first.Results), len(retry.Results))
+		}
+		if first.Results[0].ID != retry.Results[0].ID {
+			t.Errorf("%s: expected %s, got %s", name, first.Results[0].ID, retry.Results[0].ID)
+		}
+		if res.Header.Get(crudley.IdempotencyReplayedHeader) != "true" {
+			t.Errorf("%s: expected replayed response", name)
+		}
+
+		res, _ = post("key-1", `{"string_val": "different"}`)
+		if res.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected 422, got %v", name, res.StatusCode)
+		}
+
+		_, other := post("key-2", `{"string_val": "test1"}`)
+		if len(other.Results) != 1 || other.Results[0].ID == first.Results[0].ID {
+			t.Errorf("%s: expected a new model for a new key", name)
+		}
+
+		col, err := store.Collection(&model.TestModel{})
+		if err != nil {
+			t.Fatalf("%s: expected nil, got %s", name, err)
+		}
+		var count int
+		col.Scan(context.Background(), func(crudley.Model) error {
+			count++
+			return nil
+		})
+		if count != 2 {
+			t.Errorf("%s: expected 2, got %v", name, count)
+		}
+		s.Close()
+	}
+}
+
+func TestPOSTIdempotencyPrincipals(t *testing.T) {
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore(),
+		crudley.OptionPrincipal(func(r *http.Request) (crudley.Principal, error) {
+			return user(r.Header.Get("X-User")), nil
+		}),
+	)
+	s := httptest.NewServer(http.StripPrefix("/api/test", p))
+	defer s.Close()
+
+	ids := make(map[string]string)
+	for _, u := range []string{"alice", "bob"} {
+		req, err := http.NewRequest("POST", s.URL+"/api/test/", bytes.NewBufferString(`{"string_val": "test1"}`))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		req.Header.Set("X-User", u)
+		req.Header.Set(crudley.IdempotencyKeyHeader, "key-1")
+		tmr, code, err := doRequest(req)
+		if err != nil {
+			t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+		}
+		if code != http.StatusOK || len(tmr.Results) != 1 {
+			t.Fatalf("expected %s's model, got %v %+v", u, code, tmr.Results)
+		}
+		ids[u] = tmr.Results[0].ID
+	}
+	if ids["alice"] == ids["bob"] {
+		t.Errorf("expected bob not to be replayed alice's response, got %s", ids["bob"])
+	}
+}
+
+// failingComplete is an IdempotencyStore that fails to save responses
+type failingComplete struct {
+	crudley.IdempotencyStore
+}
+
+func (failingComplete) Complete(context.Context, *crudley.IdempotencyRecord) error {
+	return fmt.Errorf("store unavailable")
+}
+
+func TestPOSTIdempotencyCompleteFails(t *testing.T) {
+	idempotency := failingComplete{crudley.NewMemIdempotencyStore()}
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore(), crudley.OptionIdempotency(idempotency, time.Hour))
+	s := httptest.NewServer(http.StripPrefix("/api/test", p))
+	defer s.Close()
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("POST", s.URL+"/api/test/", bytes.NewBufferString(`{"string_val": "test1"}`))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		req.Header.Set(crudley.IdempotencyKeyHeader, "key-1")
+		tmr, code, err := doRequest(req)
+		if err != nil {
+			t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+		}
+		// the key is released, so a retry isn't answered in progress
+		if code != http.StatusOK {
+			t.Errorf("expected 200 for attempt %v, got %v %s", i, code, string(tmr.RawResponse))
+		}
+	}
+}
@@ -8,8 +8,6 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
-
-	"github.com/gorilla/context"
 )
 
 // Operators are for setting Query predicates
@@ -71,10 +69,8 @@ func UnmarshalMultiQuery(r *http.Request, m Model) ([]Model, error) {
 		mdls = append(mdls, mdl)
 	}
 	for _, mdl := range mdls {
-		if a, ok := mdl.(Authoriser); ok {
-			if err := a.Authorise(r.Context(), Action{Method: http.MethodGet}); err != nil {
-				return nil, err
-			}
+		if err := authorise(r.Context(), mdl, Action{Method: http.MethodGet, Op: OpList, Request: r, Partial: true}); err != nil {
+			return nil, err
 		}
 	}
 	return mdls, nil
@@ -283,13 +279,6 @@ func setFieldOperators(q Query, mValue reflect.Value, operators map[string]strin
 	}
 }
 
-func clearContextMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next.ServeHTTP(w, r)
-		context.Clear(r)
-	})
-}
-
 // TruePtr is a helper to return a pointer to a true boolean for queriable boolean fields
 func TruePtr() *bool {
 	var b = true
@@ -0,0 +1,444 @@
+package crudley
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Revision operations, recording why a Revision was saved
+const (
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	// RevisionCreate records when a Model was created, it has no Data and isn't
+	// returned by History
+	RevisionCreate = "create"
+)
+
+// Revision is a prior version of a Model, saved when the Model was replaced by
+// an update or delete. Timestamp and Actor record when, and by whom, the
+// version was replaced.
+type Revision struct {
+	ID        string          `json:"id" bson:"_id" firestore:"id"`
+	DocID     string          `json:"doc_id" bson:"doc_id" firestore:"doc_id"`
+	Rev       int             `json:"rev" bson:"rev" firestore:"rev"`
+	Timestamp time.Time       `json:"timestamp" bson:"timestamp" firestore:"timestamp"`
+	Actor     string          `json:"actor,omitempty" bson:"actor,omitempty" firestore:"actor,omitempty"`
+	Op        string          `json:"op" bson:"op" firestore:"op"`
+	Data      json.RawMessage `json:"data" bson:"data" firestore:"data"`
+
+	collection string
+}
+
+// New returns a Revision for the same history collection
+func (r *Revision) New(id string) Model {
+	return &Revision{ID: id, collection: r.collection}
+}
+
+// GetName returns the name of the history collection
+func (r *Revision) GetName() string {
+	return r.collection
+}
+
+// PrimaryKey returns the Revision's ID
+func (r *Revision) PrimaryKey() string {
+	return r.ID
+}
+
+// Delete is a no-op, history can't be deleted
+func (r *Revision) Delete() {}
+
+// IsDeleted always returns false
+func (r *Revision) IsDeleted() bool {
+	return false
+}
+
+// Historian is an optional interface for Stores that keep the history of their
+// Models, Paths with a Historian Store serve the _history endpoints and the
+// as_of query parameter
+type Historian interface {
+	// History returns all of the Revisions for a Model, oldest first
+	History(ctx context.Context, m Model, id string) ([]*Revision, error)
+	// AsOf returns the version of a Model at time t, or nil if it didn't exist
+	AsOf(ctx context.Context, m Model, id string, t time.Time) (Model, error)
+}
+
+type actorKey struct{}
+
+// WithActor returns a context which attributes changes to Models to actor
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set with WithActor, or the ID of the
+// request's Principal
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	if actor == "" {
+		if p := PrincipalFromContext(ctx); p != nil {
+			actor = p.PrincipalID()
+		}
+	}
+	return actor
+}
+
+// OptionHistory wraps the Path's Store with NewHistoryStore
+func OptionHistory(p *Path) {
+	if _, ok := p.Store.(Historian); !ok {
+		p.Store = NewHistoryStore(p.Store)
+	}
+}
+
+// NewHistoryStore wraps s so that the prior version of a Model is saved as a
+// Revision whenever it is updated or deleted. Revisions are saved in s, in a
+// collection named after the Model with a _history suffix.
+func NewHistoryStore(s Store) Store {
+	return &historyStore{Store: s}
+}
+
+type historyStore struct {
+	Store
+}
+
+func (s *historyStore) Collection(m Model) (Collection, error) {
+	c, err := s.Store.Collection(m)
+	if err != nil {
+		return nil, err
+	}
+	h, err := s.Store.Collection(historyModel(m))
+	if err != nil {
+		return nil, err
+	}
+	return &historyCollection{Collection: c, history: h}, nil
+}
+
+// RunInTransaction runs fn in a transaction on the wrapped Store, so changes and
+// their Revisions are saved atomically
+func (s *historyStore) RunInTransaction(ctx context.Context, fn TransactionFunc) error {
+	return RunInTransaction(ctx, s.Store, func(ctx context.Context, tx Store) error {
+		return fn(ctx, &historyStore{Store: tx})
+	})
+}
+
+func (s *historyStore) History(ctx context.Context, m Model, id string) ([]*Revision, error) {
+	h, err := s.Store.Collection(historyModel(m))
+	if err != nil {
+		return nil, err
+	}
+	revs, err := revisions(ctx, h, id)
+	if err != nil {
+		return nil, err
+	}
+	out := revs[:0]
+	for _, rev := range revs {
+		if rev.Op != RevisionCreate {
+			out = append(out, rev)
+		}
+	}
+	return out, nil
+}
+
+// AsOf returns nil if t is before the Model was created. Models created before
+// their Store kept history have no record of it, so their oldest version is
+// returned for any earlier time.
+func (s *historyStore) AsOf(ctx context.Context, m Model, id string, t time.Time) (Model, error) {
+	h, err := s.Store.Collection(historyModel(m))
+	if err != nil {
+		return nil, err
+	}
+	revs, err := revisions(ctx, h, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, rev := range revs {
+		if rev.Op == RevisionCreate {
+			if t.Before(rev.Timestamp) {
+				return nil, nil
+			}
+			continue
+		}
+		// the first version to be replaced after t is the one that was
+		// current at t
+		if rev.Timestamp.After(t) {
+			out := m.New(id)
+			return out, json.Unmarshal(rev.Data, out)
+		}
+	}
+	c, err := s.Store.Collection(m)
+	if err != nil {
+		return nil, err
+	}
+	return c.View(ctx, id)
+}
+
+func historyModel(m Model) *Revision {
+	return &Revision{collection: m.GetName() + "_history"}
+}
+
+func revisions(ctx context.Context, h Collection, id string) ([]*Revision, error) {
+	q := h.Query()
+	q.Equal("doc_id", id)
+	mdls, err := q.Execute(ctx)
+	if err != nil {
+		return nil, err
+	}
+	revs := make([]*Revision, 0, len(mdls))
+	for _, m := range mdls {
+		revs = append(revs, m.(*Revision))
+	}
+	sort.Slice(revs, func(i, j int) bool {
+		return revs[i].Rev < revs[j].Rev
+	})
+	return revs, nil
+}
+
+type historyCollection struct {
+	Collection
+	history Collection
+}
+
+// Update saves the current version of the Model as a Revision before updating it
+func (c *historyCollection) Update(ctx context.Context, id string, m Model) error {
+	prev, err := c.Collection.View(ctx, id)
+	if err != nil {
+		return err
+	}
+	if prev != nil {
+		op := RevisionUpdate
+		switch {
+		case !prev.IsDeleted() && m.IsDeleted():
+			op = RevisionDelete
+		case prev.IsDeleted() && !m.IsDeleted():
+			op = RevisionRestore
+		}
+		err = c.record(ctx, id, op, prev)
+		if err != nil {
+			return err
+		}
+	}
+	return c.Collection.Update(ctx, id, m)
+}
+
+// Delete saves the current version of the Model as a Revision before deleting it
+func (c *historyCollection) Delete(ctx context.Context, id string) error {
+	prev, err := c.Collection.View(ctx, id)
+	if err != nil {
+		return err
+	}
+	if prev != nil {
+		err = c.record(ctx, id, RevisionDelete, prev)
+		if err != nil {
+			return err
+		}
+	}
+	return c.Collection.Delete(ctx, id)
+}
+
+// Create records when the Model was created, so that it isn't found as of an
+// earlier time
+func (c *historyCollection) Create(ctx context.Context, fn CreaterFunc) error {
+	var id string
+	err := c.Collection.Create(ctx, func(newID string) (Model, error) {
+		id = newID
+		return fn(newID)
+	})
+	if err != nil {
+		return err
+	}
+	return c.recordCreate(ctx, id)
+}
+
+// CreateWithID passes through to the wrapped Collection if it is an IDCreater,
+// recording when the Model was created
+func (c *historyCollection) CreateWithID(ctx context.Context, id string, fn CreaterFunc) error {
+	ic, ok := c.Collection.(IDCreater)
+	if !ok {
+		return ErrorClientIDUnsupported
+	}
+	err := ic.CreateWithID(ctx, id, fn)
+	if err != nil {
+		return err
+	}
+	return c.recordCreate(ctx, id)
+}
+
+// recordCreate saves a RevisionCreate, the Revision before a Model's first
+func (c *historyCollection) recordCreate(ctx context.Context, id string) error {
+	rev := &Revision{
+		DocID:     id,
+		Timestamp: time.Now(),
+		Actor:     ActorFromContext(ctx),
+		Op:        RevisionCreate,
+	}
+	fn := func(id string) (Model, error) {
+		rev.ID = id
+		return rev, nil
+	}
+	ic, ok := c.history.(IDCreater)
+	if !ok {
+		return c.history.Create(ctx, fn)
+	}
+	err := ic.CreateWithID(ctx, id+"@0", fn)
+	if _, ok := err.(ConflictError); ok {
+		// the Model was hard deleted and created again
+		rev.ID = id + "@0"
+		return c.history.Update(ctx, rev.ID, rev)
+	}
+	return err
+}
+
+func (c *historyCollection) record(ctx context.Context, id, op string, prev Model) error {
+	revs, err := revisions(ctx, c.history, id)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(prev)
+	if err != nil {
+		return err
+	}
+	rev := &Revision{
+		DocID:     id,
+		Rev:       len(revs) + 1,
+		Timestamp: time.Now(),
+		Actor:     ActorFromContext(ctx),
+		Op:        op,
+		Data:      data,
+	}
+	if len(revs) > 0 {
+		rev.Rev = revs[len(revs)-1].Rev + 1
+	}
+	if ic, ok := c.history.(IDCreater); ok {
+		// a deterministic ID means concurrent writers conflict rather than
+		// saving two Revisions with the same number
+		return ic.CreateWithID(ctx, id+"@"+strconv.Itoa(rev.Rev), func(id string) (Model, error) {
+			rev.ID = id
+			return rev, nil
+		})
+	}
+	return c.history.Create(ctx, func(id string) (Model, error) {
+		rev.ID = id
+		return rev, nil
+	})
+}
+
+// History is the http handler listing the Revisions of the Model specified by
+// the route parameter "id"
+func (p *Path) History(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	c, res, err := p.initHandler(ctx)
+	if err != nil {
+		WriteResponse(w, res)
+		return
+	}
+	defer WriteResponse(w, res)
+
+	id := p.Params(r, ID)
+	if id == "" {
+		res.AddError(ErrorNoID)
+		res.SetStatusCode(http.StatusBadRequest)
+		return
+	}
+	code, err := p.authoriseHistory(ctx, c, id)
+	if err != nil {
+		res.AddError(err)
+		res.SetStatusCode(code)
+		return
+	}
+
+	h, ok := p.historian(ctx)
+	if !ok {
+		res.AddError(ErrorHistoryUnsupported)
+		res.SetStatusCode(http.StatusBadRequest)
+		return
+	}
+	revs, err := h.History(ctx, p.Model, id)
+	if err != nil {
+		res.AddError(fmt.Errorf("failed to retrieve history: %s", err.Error()))
+		res.SetStatusCode(http.StatusInternalServerError)
+		return
+	}
+	// revisions are stored in full, so omit the fields the user can't read
+	hidden := hiddenFields(p.Model, RolesFromContext(ctx))
+	for _, r := range revs {
+		r.Data, err = redactJSON(r.Data, hidden)
+		if err != nil {
+			res.AddError(fmt.Errorf("failed to retrieve history: %s", err.Error()))
+			res.SetStatusCode(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	rev := p.Params(r, "rev")
+	if rev == "" {
+		for _, r := range revs {
+			res.AddModel(r)
+		}
+		return
+	}
+	n, err := strconv.Atoi(rev)
+	if err != nil {
+		res.AddError(fmt.Errorf("invalid revision: %s", rev))
+		res.SetStatusCode(http.StatusBadRequest)
+		return
+	}
+	for _, r := range revs {
+		if r.Rev == n {
+			res.AddModel(r)
+			return
+		}
+	}
+	res.AddError(ErrorRevisionNotFound)
+	res.SetStatusCode(http.StatusNotFound)
+}
+
+// asOf parses the as_of query parameter and retrieves the Model at that time
+func (p *Path) asOf(ctx context.Context, c Collection, id, asOf string) (Model, int, error) {
+	h, ok := p.historian(ctx)
+	if !ok {
+		return nil, http.StatusBadRequest, ErrorHistoryUnsupported
+	}
+	t, err := time.Parse(time.RFC3339Nano, asOf)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("failed to parse %s: %s", asOfParam, asOf)
+	}
+	code, err := p.authoriseHistory(ctx, c, id)
+	if err != nil {
+		return nil, code, err
+	}
+	m, err := h.AsOf(ctx, p.Model, id, t)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to retrieve history: %s", err.Error())
+	}
+	return m, http.StatusOK, nil
+}
+
+// historian returns the request's Store if it keeps history
+func (p *Path) historian(ctx context.Context) (Historian, bool) {
+	s, err := p.store(ctx)
+	if err != nil {
+		return nil, false
+	}
+	h, ok := s.(Historian)
+	return h, ok
+}
+
+// authoriseHistory checks the current version of a Model can be read before
+// allowing access to its history
+func (p *Path) authoriseHistory(ctx context.Context, c Collection, id string) (int, error) {
+	m, err := c.View(ctx, id)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to retrieve Model from collection: %s", err.Error())
+	}
+	if m == nil {
+		return http.StatusNotFound, ErrorModelNotFound
+	}
+	if err := authorise(ctx, m, Action{Method: http.MethodGet, Op: OpGet}); err != nil {
+		return http.StatusNotFound, err
+	}
+	return http.StatusOK, nil
+}
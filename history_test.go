@@ -0,0 +1,180 @@
+package crudley_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+func TestHistoryStore(t *testing.T) {
+	store := crudley.NewHistoryStore(mem.NewStore())
+	col, err := store.Collection(&model.TestModel{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	beforeCreate := time.Now()
+	var mID string
+	err = col.Create(context.Background(), func(id string) (crudley.Model, error) {
+		mID = id
+		return &model.TestModel{ID: id, StringVal: "v1"}, nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	ctx := crudley.WithActor(context.Background(), "alice")
+	err = col.Update(ctx, mID, &model.TestModel{ID: mID, StringVal: "v2"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	between := time.Now()
+	err = col.Update(ctx, mID, &model.TestModel{ID: mID, StringVal: "v3", Deleted: true})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+
+	h := store.(crudley.Historian)
+	revs, err := h.History(context.Background(), &model.TestModel{}, mID)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if len(revs) != 2 {
+		t.Fatalf("expected 2, got %v", len(revs))
+	}
+	for i, tc := range []struct {
+		op, val string
+	}{
+		{crudley.RevisionUpdate, "v1"},
+		{crudley.RevisionDelete, "v2"},
+	} {
+		if revs[i].Rev != i+1 {
+			t.Errorf("expected %v, got %v", i+1, revs[i].Rev)
+		}
+		if revs[i].Op != tc.op {
+			t.Errorf("expected %s, got %s", tc.op, revs[i].Op)
+		}
+		if revs[i].Actor != "alice" {
+			t.Errorf("expected alice, got %s", revs[i].Actor)
+		}
+		var tm model.TestModel
+		err = json.Unmarshal(revs[i].Data, &tm)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		if tm.StringVal != tc.val {
+			t.Errorf("expected %s, got %s", tc.val, tm.StringVal)
+		}
+	}
+
+	m, err := h.AsOf(context.Background(), &model.TestModel{}, mID, beforeCreate)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if m != nil {
+		t.Errorf("expected nil before the model was created, got %+v", m)
+	}
+	m, err = h.AsOf(context.Background(), &model.TestModel{}, mID, between)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if m.(*model.TestModel).StringVal != "v2" {
+		t.Errorf("expected v2, got %s", m.(*model.TestModel).StringVal)
+	}
+	m, err = h.AsOf(context.Background(), &model.TestModel{}, mID, time.Now())
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if m.(*model.TestModel).StringVal != "v3" {
+		t.Errorf("expected v3, got %s", m.(*model.TestModel).StringVal)
+	}
+}
+
+func TestHistoryHandlers(t *testing.T) {
+	r := http.NewServeMux()
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore(), crudley.OptionHistory)
+	r.Handle("/api/test/", http.StripPrefix("/api/test", p))
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	beforeCreate := time.Now()
+	tmr, err := testHandler("POST", fmt.Sprintf("%s/api/test/", s.URL), bytes.NewBufferString(`{"string_val": "v1"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	mID := tmr.Results[0].ID
+	_, err = testHandler("PUT", fmt.Sprintf("%s/api/test/%s", s.URL, mID), bytes.NewBufferString(`{"string_val": "v2"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	between := time.Now()
+	_, err = testHandler("PUT", fmt.Sprintf("%s/api/test/%s", s.URL, mID), bytes.NewBufferString(`{"string_val": "v3"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+
+	var history struct {
+		Results []crudley.Revision `json:"results"`
+	}
+	res, err := http.Get(fmt.Sprintf("%s/api/test/%s/_history", s.URL, mID))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	err = json.NewDecoder(res.Body).Decode(&history)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if len(history.Results) != 2 {
+		t.Fatalf("expected 2, got %v", len(history.Results))
+	}
+
+	res, err = http.Get(fmt.Sprintf("%s/api/test/%s/_history/1", s.URL, mID))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	err = json.NewDecoder(res.Body).Decode(&history)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if len(history.Results) != 1 || history.Results[0].Rev != 1 {
+		t.Fatalf("expected revision 1, got %+v", history.Results)
+	}
+
+	res, err = http.Get(fmt.Sprintf("%s/api/test/%s/_history/3", s.URL, mID))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %v", res.StatusCode)
+	}
+
+	asOf := url.QueryEscape(between.Format(time.RFC3339Nano))
+	tmr, err = testHandler("GET", fmt.Sprintf("%s/api/test/%s?as_of=%s", s.URL, mID, asOf), nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	if len(tmr.Results) != 1 || tmr.Results[0].StringVal != "v2" {
+		t.Errorf("expected v2, got %s", string(tmr.RawResponse))
+	}
+
+	asOf = url.QueryEscape(beforeCreate.Format(time.RFC3339Nano))
+	res, err = http.Get(fmt.Sprintf("%s/api/test/%s?as_of=%s", s.URL, mID, asOf))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 before the model was created, got %v", res.StatusCode)
+	}
+}
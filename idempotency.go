@@ -0,0 +1,311 @@
+package crudley
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arussellsaw/crudley/stores/backend/memdb"
+)
+
+// IdempotencyKeyHeader is the request header that makes a POST request safe to
+// retry. Requests with the same key and body receive the original response
+// instead of creating another Model.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyReplayedHeader is set on responses replayed for an idempotency key
+const IdempotencyReplayedHeader = "Idempotent-Replayed"
+
+// DefaultIdempotencyTTL is how long idempotency keys are remembered for
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// IdempotencyRecord stores the request hash and response for an idempotency key
+type IdempotencyRecord struct {
+	Key         string    `json:"key" bson:"_id" firestore:"key"`
+	RequestHash string    `json:"request_hash" bson:"request_hash" firestore:"request_hash"`
+	Complete    bool      `json:"complete" bson:"complete" firestore:"complete"`
+	StatusCode  int       `json:"status_code" bson:"status_code" firestore:"status_code"`
+	Body        []byte    `json:"body" bson:"body" firestore:"body"`
+	ExpiresAt   time.Time `json:"expires_at" bson:"expires_at" firestore:"expires_at"`
+}
+
+// New returns an empty IdempotencyRecord for the key
+func (i *IdempotencyRecord) New(key string) Model {
+	return &IdempotencyRecord{Key: key}
+}
+
+// GetName returns the collection name used by NewIdempotencyStore
+func (i *IdempotencyRecord) GetName() string {
+	return "idempotency_keys"
+}
+
+// PrimaryKey returns the idempotency key
+func (i *IdempotencyRecord) PrimaryKey() string {
+	return i.Key
+}
+
+// Delete expires the IdempotencyRecord
+func (i *IdempotencyRecord) Delete() {
+	i.ExpiresAt = time.Now()
+}
+
+// IsDeleted returns true once the IdempotencyRecord has expired
+func (i *IdempotencyRecord) IsDeleted() bool {
+	return !i.ExpiresAt.After(time.Now())
+}
+
+// IdempotencyStore persists IdempotencyRecords for a Path
+type IdempotencyStore interface {
+	// Reserve saves rec if there is no unexpired record with the same key,
+	// otherwise it returns the existing record without saving rec
+	Reserve(ctx context.Context, rec *IdempotencyRecord) (*IdempotencyRecord, error)
+	// Complete saves the response for a reserved key
+	Complete(ctx context.Context, rec *IdempotencyRecord) error
+	// Release removes a reservation, so that the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// OptionIdempotency sets the IdempotencyStore and key TTL for POST requests.
+// Paths use an in-memory IdempotencyStore by default, passing a nil store
+// disables idempotency keys.
+func OptionIdempotency(s IdempotencyStore, ttl time.Duration) Option {
+	return func(p *Path) {
+		p.Idempotency = s
+		p.IdempotencyTTL = ttl
+	}
+}
+
+// idempotentPost handles a POST request with an idempotency key, replaying the
+// stored response if the key has been seen before
+func (p *Path) idempotentPost(w http.ResponseWriter, r *http.Request, key string) {
+	ctx := r.Context()
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		res := &Response{}
+		res.AddError(ErrorMalformedJSON)
+		res.SetStatusCode(http.StatusBadRequest)
+		WriteResponse(w, res)
+		return
+	}
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.Path)
+	hash.Write(buf)
+
+	rec := &IdempotencyRecord{
+		Key:         p.Model.GetName() + ":" + idempotencyScope(ctx) + key,
+		RequestHash: hex.EncodeToString(hash.Sum(nil)),
+		ExpiresAt:   time.Now().Add(p.IdempotencyTTL),
+	}
+	existing, err := p.Idempotency.Reserve(ctx, rec)
+	if err != nil {
+		res := &Response{}
+		res.AddError(fmt.Errorf("failed to reserve idempotency key: %s", err.Error()))
+		res.SetStatusCode(http.StatusInternalServerError)
+		WriteResponse(w, res)
+		return
+	}
+	if existing != nil {
+		res := &Response{}
+		switch {
+		case existing.RequestHash != rec.RequestHash:
+			res.AddError(ErrorIdempotencyKeyReused)
+			res.SetStatusCode(http.StatusUnprocessableEntity)
+		case !existing.Complete:
+			res.AddError(ErrorIdempotencyKeyInProgress)
+			res.SetStatusCode(http.StatusConflict)
+		default:
+			w.Header().Add("Content-Type", "application/json")
+			w.Header().Set(IdempotencyReplayedHeader, "true")
+			w.WriteHeader(existing.StatusCode)
+			w.Write(existing.Body)
+			return
+		}
+		WriteResponse(w, res)
+		return
+	}
+
+	rw := &recordingWriter{ResponseWriter: w}
+	r.Body = ioutil.NopCloser(bytes.NewReader(buf))
+	p.post(rw, r)
+
+	if rw.status == 0 || rw.status >= http.StatusInternalServerError {
+		// server errors and empty responses aren't stored, the client should be
+		// able to retry
+		p.releaseIdempotencyKey(ctx, rec)
+		return
+	}
+	rec.Complete = true
+	rec.StatusCode = rw.status
+	rec.Body = rw.body.Bytes()
+	err = p.Idempotency.Complete(ctx, rec)
+	if err != nil {
+		// otherwise retries would be answered in progress until the key expires
+		log.Printf("crudley: failed to complete idempotency key %s: %s", rec.Key, err)
+		p.releaseIdempotencyKey(ctx, rec)
+	}
+}
+
+// releaseIdempotencyKey releases rec's reservation, there is no one to return
+// an error to so it is logged
+func (p *Path) releaseIdempotencyKey(ctx context.Context, rec *IdempotencyRecord) {
+	err := p.Idempotency.Release(ctx, rec.Key)
+	if err != nil {
+		log.Printf("crudley: failed to release idempotency key %s: %s", rec.Key, err)
+	}
+}
+
+// idempotencyScope keeps the idempotency keys of tenants and principals apart,
+// so that no one is replayed a response made for someone else
+func idempotencyScope(ctx context.Context) string {
+	var scope string
+	if tenant := TenantFromContext(ctx); tenant != "" {
+		scope += strconv.Quote(tenant) + ":"
+	}
+	if actor := ActorFromContext(ctx); actor != "" {
+		scope += "@" + strconv.Quote(actor) + ":"
+	}
+	return scope
+}
+
+// recordingWriter passes through to a http.ResponseWriter, keeping a copy of
+// the status code and body
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// NewMemIdempotencyStore returns an in-memory IdempotencyStore, this is the
+// default for a Path
+func NewMemIdempotencyStore() IdempotencyStore {
+	return &memIdempotencyStore{col: memdb.New().Collection("idempotency_keys")}
+}
+
+type memIdempotencyStore struct {
+	sync.Mutex
+	col       *memdb.Collection
+	lastSweep time.Time
+}
+
+func (s *memIdempotencyStore) Reserve(ctx context.Context, rec *IdempotencyRecord) (*IdempotencyRecord, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.sweep()
+	existing := &IdempotencyRecord{}
+	found, err := s.col.Doc(rec.Key, existing)
+	if err != nil {
+		return nil, err
+	}
+	if found && !existing.IsDeleted() {
+		return existing, nil
+	}
+	return nil, s.col.Set(rec.Key, rec)
+}
+
+func (s *memIdempotencyStore) Complete(ctx context.Context, rec *IdempotencyRecord) error {
+	return s.col.Set(rec.Key, rec)
+}
+
+func (s *memIdempotencyStore) Release(ctx context.Context, key string) error {
+	return s.col.Remove(key)
+}
+
+// sweep removes expired records, at most once a minute
+func (s *memIdempotencyStore) sweep() {
+	if time.Since(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = time.Now()
+	for key, buf := range s.col.AllRaw() {
+		rec := &IdempotencyRecord{}
+		if err := json.Unmarshal(buf, rec); err != nil || rec.IsDeleted() {
+			s.col.Remove(key)
+		}
+	}
+}
+
+// NewIdempotencyStore returns an IdempotencyStore that saves IdempotencyRecords
+// as Models in s. The Store's Collection must implement IDCreater.
+func NewIdempotencyStore(s Store) IdempotencyStore {
+	return &storeIdempotencyStore{s: s}
+}
+
+type storeIdempotencyStore struct {
+	s Store
+}
+
+func (s *storeIdempotencyStore) Reserve(ctx context.Context, rec *IdempotencyRecord) (*IdempotencyRecord, error) {
+	c, err := s.s.Collection(rec)
+	if err != nil {
+		return nil, err
+	}
+	ic, ok := c.(IDCreater)
+	if !ok {
+		return nil, ErrorClientIDUnsupported
+	}
+	create := func(id string) (Model, error) {
+		return rec, nil
+	}
+	err = ic.CreateWithID(ctx, rec.Key, create)
+	if _, ok := err.(ConflictError); !ok {
+		return nil, err
+	}
+	existing, err := c.View(ctx, rec.Key)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && !existing.IsDeleted() {
+		return existing.(*IdempotencyRecord), nil
+	}
+	// the existing record has expired, replace it unless another request
+	// beats us to it
+	if existing != nil {
+		err = c.Delete(ctx, rec.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = ic.CreateWithID(ctx, rec.Key, create)
+	if _, ok := err.(ConflictError); ok {
+		return s.Reserve(ctx, rec)
+	}
+	return nil, err
+}
+
+func (s *storeIdempotencyStore) Complete(ctx context.Context, rec *IdempotencyRecord) error {
+	c, err := s.s.Collection(rec)
+	if err != nil {
+		return err
+	}
+	return c.Update(ctx, rec.Key, rec)
+}
+
+func (s *storeIdempotencyStore) Release(ctx context.Context, key string) error {
+	c, err := s.s.Collection(&IdempotencyRecord{})
+	if err != nil {
+		return err
+	}
+	return c.Delete(ctx, key)
+}
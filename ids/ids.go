@@ -0,0 +1,202 @@
+// Package ids contains built in crudley.IDGenerator implementations
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/arussellsaw/crudley"
+)
+
+var (
+	// UUIDv4 generates random UUIDs
+	UUIDv4 crudley.IDGenerator = crudley.IDGeneratorFunc(func() string {
+		return uuid.New().String()
+	})
+	// UUIDv7 generates UUIDs prefixed with a millisecond timestamp, IDs generated
+	// within the same millisecond are monotonically increasing, so they sort in
+	// creation order
+	UUIDv7 crudley.IDGenerator = &uuidv7Generator{}
+	// ULID generates Universally Unique Lexicographically Sortable Identifiers,
+	// IDs generated within the same millisecond are monotonically increasing
+	ULID crudley.IDGenerator = &ulidGenerator{}
+	// KSUID generates K-Sortable Unique IDentifiers
+	KSUID crudley.IDGenerator = crudley.IDGeneratorFunc(newKSUID)
+)
+
+// Prefixed prepends prefix and an underscore to the IDs from g, eg incident_123
+func Prefixed(prefix string, g crudley.IDGenerator) crudley.IDGenerator {
+	return crudley.IDGeneratorFunc(func() string {
+		return prefix + "_" + g.GenerateID()
+	})
+}
+
+type uuidv7Generator struct {
+	sync.Mutex
+	lastMillis uint64
+	seq        uint16
+}
+
+// maxUUIDv7Seq is the largest value of the 12 bit counter in rand_a
+const maxUUIDv7Seq = 0xfff
+
+func (g *uuidv7Generator) GenerateID() string {
+	g.Lock()
+	defer g.Unlock()
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ms <= g.lastMillis {
+		// rand_a is a counter, as described by RFC 9562, so IDs from the same
+		// millisecond sort in the order they were generated. If it runs out
+		// the timestamp is advanced instead.
+		g.seq++
+		if g.seq > maxUUIDv7Seq {
+			g.lastMillis++
+			g.seq = 0
+		}
+	} else {
+		g.lastMillis = ms
+		var b [2]byte
+		randomBytes(b[:])
+		// start in the lower half of the counter's range, leaving room to count
+		g.seq = binary.BigEndian.Uint16(b[:]) & (maxUUIDv7Seq >> 1)
+	}
+	var u uuid.UUID
+	putMillis(u[:6], time.UnixMilli(int64(g.lastMillis)))
+	u[6] = 0x70 | byte(g.seq>>8) // version 7
+	u[7] = byte(g.seq)
+	randomBytes(u[8:])
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return u.String()
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type ulidGenerator struct {
+	sync.Mutex
+	lastMillis uint64
+	last       [16]byte
+}
+
+func (g *ulidGenerator) GenerateID() string {
+	g.Lock()
+	defer g.Unlock()
+	now := time.Now()
+	ms := uint64(now.UnixNano() / int64(time.Millisecond))
+	if ms == g.lastMillis {
+		// increment the random component so IDs from the same millisecond
+		// still sort in the order they were generated
+		for i := 15; i >= 6; i-- {
+			g.last[i]++
+			if g.last[i] != 0 {
+				break
+			}
+		}
+	} else {
+		g.lastMillis = ms
+		putMillis(g.last[:6], now)
+		randomBytes(g.last[6:])
+	}
+	return encode(g.last[:], crockford, 26)
+}
+
+// ksuidEpoch is the KSUID epoch, 2014-05-13T16:53:20Z
+const ksuidEpoch = 1400000000
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func newKSUID() string {
+	var b [20]byte
+	binary.BigEndian.PutUint32(b[:4], uint32(time.Now().Unix()-ksuidEpoch))
+	randomBytes(b[4:])
+	return encode(b[:], base62, 27)
+}
+
+// twitterEpoch is the default Snowflake epoch, 2010-11-04T01:42:54.657Z
+var twitterEpoch = time.Unix(0, 1288834974657*int64(time.Millisecond))
+
+// NewSnowflake returns a generator of 63 bit snowflake IDs made up of a
+// millisecond timestamp, the node number and a per-millisecond sequence. IDs are
+// formatted as zero padded decimals so they sort as strings. node must be
+// unique for each process generating IDs, between 0 and 1023.
+func NewSnowflake(node int64) (crudley.IDGenerator, error) {
+	if node < 0 || node > maxNode {
+		return nil, fmt.Errorf("snowflake node must be between 0 and %v", maxNode)
+	}
+	return &snowflake{epoch: twitterEpoch, node: node}, nil
+}
+
+const (
+	nodeBits = 10
+	seqBits  = 12
+	maxNode  = 1<<nodeBits - 1
+	maxSeq   = 1<<seqBits - 1
+)
+
+type snowflake struct {
+	sync.Mutex
+	epoch      time.Time
+	node       int64
+	lastMillis int64
+	seq        int64
+}
+
+func (s *snowflake) GenerateID() string {
+	s.Lock()
+	defer s.Unlock()
+	ms := int64(time.Since(s.epoch) / time.Millisecond)
+	if ms < s.lastMillis {
+		// the clock went backwards, keep using the last timestamp
+		ms = s.lastMillis
+	}
+	if ms == s.lastMillis {
+		s.seq = (s.seq + 1) & maxSeq
+		if s.seq == 0 {
+			// sequence exhausted for this millisecond, wait for the next
+			for ms <= s.lastMillis {
+				time.Sleep(time.Millisecond / 10)
+				ms = int64(time.Since(s.epoch) / time.Millisecond)
+			}
+		}
+	} else {
+		s.seq = 0
+	}
+	s.lastMillis = ms
+	id := ms<<(nodeBits+seqBits) | s.node<<seqBits | s.seq
+	return fmt.Sprintf("%019d", id)
+}
+
+func putMillis(b []byte, t time.Time) {
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+func randomBytes(b []byte) {
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(fmt.Sprintf("ids: failed to read random bytes: %s", err))
+	}
+}
+
+// encode formats b as a fixed width big-endian number using the given alphabet
+func encode(b []byte, alphabet string, width int) string {
+	var (
+		n    = new(big.Int).SetBytes(b)
+		base = big.NewInt(int64(len(alphabet)))
+		mod  = new(big.Int)
+		out  = make([]byte, width)
+	)
+	for i := width - 1; i >= 0; i-- {
+		n.DivMod(n, base, mod)
+		out[i] = alphabet[mod.Int64()]
+	}
+	return string(out)
+}
@@ -0,0 +1,67 @@
+package ids
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+)
+
+func TestFormats(t *testing.T) {
+	snowflake, err := NewSnowflake(12)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	for name, tc := range map[string]struct {
+		gen     crudley.IDGenerator
+		pattern string
+	}{
+		"uuidv4":    {UUIDv4, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		"uuidv7":    {UUIDv7, `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		"ulid":      {ULID, `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+		"ksuid":     {KSUID, `^[0-9A-Za-z]{27}$`},
+		"snowflake": {snowflake, `^[0-9]{19}$`},
+		"prefixed":  {Prefixed("incident", snowflake), `^incident_[0-9]{19}$`},
+	} {
+		id := tc.gen.GenerateID()
+		if !regexp.MustCompile(tc.pattern).MatchString(id) {
+			t.Errorf("%s: expected %s to match %s", name, id, tc.pattern)
+		}
+	}
+}
+
+func TestSortable(t *testing.T) {
+	snowflake, err := NewSnowflake(0)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	for name, gen := range map[string]crudley.IDGenerator{
+		"uuidv7":    UUIDv7,
+		"ulid":      ULID,
+		"snowflake": snowflake,
+	} {
+		var generated []string
+		for i := 0; i < 10000; i++ {
+			generated = append(generated, gen.GenerateID())
+		}
+		if !sort.StringsAreSorted(generated) {
+			t.Errorf("%s: expected ids to be sorted", name)
+		}
+		seen := make(map[string]bool)
+		for _, id := range generated {
+			if seen[id] {
+				t.Fatalf("%s: duplicate id %s", name, id)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+func TestNewSnowflake(t *testing.T) {
+	_, err := NewSnowflake(1024)
+	if err == nil || !strings.Contains(err.Error(), "between 0 and 1023") {
+		t.Errorf("expected node range error, got %v", err)
+	}
+}
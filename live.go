@@ -0,0 +1,209 @@
+package crudley
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Live query message types
+const (
+	LiveInit   = "init"
+	LiveEnter  = "enter"
+	LiveChange = "change"
+	LiveLeave  = "leave"
+	LiveError  = "error"
+)
+
+// livePing is how often live query connections are pinged
+const livePing = 30 * time.Second
+
+// LiveMessage is sent to live query subscribers. The init message contains the
+// initial Results, after which enter, change and leave messages describe Models
+// entering, changing within or leaving the result set. Index is the Model's
+// position in the new result set, or for leave messages the old one.
+type LiveMessage struct {
+	Type    string  `json:"type"`
+	Seq     uint64  `json:"seq,omitempty"`
+	ID      string  `json:"id,omitempty"`
+	Index   int     `json:"index"`
+	Data    Model   `json:"data,omitempty"`
+	Results []Model `json:"results,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// Live is the http handler for live query subscriptions over a WebSocket. The
+// query parameters are the same as for Query, subscribers receive the initial
+// result set and then diffs as changes from the Path's ChangeFeed affect it.
+func (p *Path) Live(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	c, res, err := p.initHandler(ctx)
+	if err != nil {
+		WriteResponse(w, res)
+		return
+	}
+	filter, err := NewFilter(ctx, p.Model, r.URL.Query())
+	if err != nil {
+		res := &Response{}
+		res.AddError(err)
+		res.SetStatusCode(http.StatusBadRequest)
+		WriteResponse(w, res)
+		return
+	}
+
+	// subscribe before running the initial query so no changes are missed
+	_, events, cancel, err := p.ChangeFeed.Subscribe(math.MaxUint64)
+	if err != nil {
+		res := &Response{}
+		res.AddError(err)
+		res.SetStatusCode(http.StatusInternalServerError)
+		WriteResponse(w, res)
+		return
+	}
+	defer cancel()
+
+	results, code, err := p.liveQuery(ctx, c, r)
+	if err != nil {
+		res := &Response{}
+		res.AddError(err)
+		res.SetStatusCode(code)
+		WriteResponse(w, res)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// the read loop handles control messages and notices when the client goes
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	go func() {
+		defer stop()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	err = conn.WriteJSON(LiveMessage{Type: LiveInit, Results: results})
+	if err != nil {
+		return
+	}
+	current, err := snapshot(results)
+	if err != nil {
+		return
+	}
+
+	ping := time.NewTicker(livePing)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(livePing)); err != nil {
+				return
+			}
+		case ev, ok := <-events:
+			if !ok {
+				conn.WriteJSON(LiveMessage{Type: LiveError, Error: "subscription fell behind, resubscribe"})
+				return
+			}
+			// the ChangeFeed may be shared with Paths for other Models
+			if ev.Model != p.Model.GetName() {
+				continue
+			}
+			if _, inResults := current.index[ev.ID]; !inResults && !filter.Match(ev.Data) {
+				continue
+			}
+			results, _, err := p.liveQuery(ctx, c, r)
+			if err != nil {
+				conn.WriteJSON(LiveMessage{Type: LiveError, Error: err.Error()})
+				return
+			}
+			next, err := snapshot(results)
+			if err != nil {
+				return
+			}
+			for _, msg := range current.diff(next) {
+				msg.Seq = ev.Seq
+				if err := conn.WriteJSON(msg); err != nil {
+					return
+				}
+			}
+			current = next
+		}
+	}
+}
+
+// liveQuery runs the subscriber's query, omitting the fields they can't read
+func (p *Path) liveQuery(ctx context.Context, c Collection, r *http.Request) ([]Model, int, error) {
+	models, code, err := p.query(ctx, c, r.WithContext(ctx))
+	if err != nil {
+		return nil, code, err
+	}
+	roles := RolesFromContext(ctx)
+	for i, m := range models {
+		models[i] = redact(m, roles)
+	}
+	return models, http.StatusOK, nil
+}
+
+// liveResults is a result set, with the serialized Models used to detect changes
+type liveResults struct {
+	models []Model
+	index  map[string]int
+	bufs   map[string][]byte
+}
+
+func snapshot(models []Model) (liveResults, error) {
+	lr := liveResults{
+		models: models,
+		index:  make(map[string]int, len(models)),
+		bufs:   make(map[string][]byte, len(models)),
+	}
+	for i, m := range models {
+		buf, err := json.Marshal(m)
+		if err != nil {
+			return lr, err
+		}
+		lr.index[m.PrimaryKey()] = i
+		lr.bufs[m.PrimaryKey()] = buf
+	}
+	return lr, nil
+}
+
+// diff returns the messages that transform r into next
+func (r liveResults) diff(next liveResults) []LiveMessage {
+	var msgs []LiveMessage
+	for _, m := range r.models {
+		if _, ok := next.index[m.PrimaryKey()]; !ok {
+			msgs = append(msgs, LiveMessage{Type: LiveLeave, ID: m.PrimaryKey(), Index: r.index[m.PrimaryKey()]})
+		}
+	}
+	for i, m := range next.models {
+		id := m.PrimaryKey()
+		prev, ok := r.index[id]
+		switch {
+		case !ok:
+			msgs = append(msgs, LiveMessage{Type: LiveEnter, ID: id, Index: i, Data: m})
+		case prev != i || !bytes.Equal(r.bufs[id], next.bufs[id]):
+			msgs = append(msgs, LiveMessage{Type: LiveChange, ID: id, Index: i, Data: m})
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,123 @@
+package crudley_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+type liveMessage struct {
+	Type    string             `json:"type"`
+	Seq     uint64             `json:"seq"`
+	ID      string             `json:"id"`
+	Index   int                `json:"index"`
+	Data    model.TestModel    `json:"data"`
+	Results []*model.TestModel `json:"results"`
+}
+
+func TestLive(t *testing.T) {
+	r := http.NewServeMux()
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore(), crudley.OptionChangeFeed(crudley.NewChangeFeed(crudley.DefaultChangeFeedSize)))
+	r.Handle("/api/test/", http.StripPrefix("/api/test", p))
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	tmr, err := testHandler("POST", fmt.Sprintf("%s/api/test/", s.URL), bytes.NewBufferString(`{"string_val": "first", "owner": "foo"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	firstID := tmr.Results[0].ID
+
+	wsURL := "ws" + strings.TrimPrefix(s.URL, "http") + "/api/test/_live?owner=foo&sort=string_val"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	defer conn.Close()
+
+	var msg liveMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if msg.Type != crudley.LiveInit || len(msg.Results) != 1 || msg.Results[0].ID != firstID {
+		t.Fatalf("expected init with %s, got %+v", firstID, msg)
+	}
+
+	// not matched by the subscription, so nothing is sent
+	_, err = testHandler("POST", fmt.Sprintf("%s/api/test/", s.URL), bytes.NewBufferString(`{"string_val": "ignored", "owner": "bar"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	tmr, err = testHandler("POST", fmt.Sprintf("%s/api/test/", s.URL), bytes.NewBufferString(`{"string_val": "another", "owner": "foo"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	anotherID := tmr.Results[0].ID
+
+	msgs := make([]liveMessage, 2)
+	for i := range msgs {
+		if err := conn.ReadJSON(&msgs[i]); err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+	}
+	if msgs[0].Type != crudley.LiveEnter || msgs[0].ID != anotherID || msgs[0].Index != 0 || msgs[0].Seq != 3 {
+		t.Errorf("expected enter for %s at 0, got %+v", anotherID, msgs[0])
+	}
+	if msgs[1].Type != crudley.LiveChange || msgs[1].ID != firstID || msgs[1].Index != 1 {
+		t.Errorf("expected change for %s at 1, got %+v", firstID, msgs[1])
+	}
+
+	_, err = testHandler("PUT", fmt.Sprintf("%s/api/test/%s", s.URL, firstID), bytes.NewBufferString(`{"owner": "bar"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	msg = liveMessage{}
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if msg.Type != crudley.LiveLeave || msg.ID != firstID || msg.Index != 1 {
+		t.Errorf("expected leave for %s at 1, got %+v", firstID, msg)
+	}
+}
+
+// errorStore is a Store whose Collections can't be retrieved
+type errorStore struct{}
+
+func (errorStore) Collection(crudley.Model) (crudley.Collection, error) {
+	return nil, fmt.Errorf("store unavailable")
+}
+
+func TestLiveErrors(t *testing.T) {
+	feed := crudley.OptionChangeFeed(crudley.NewChangeFeed(crudley.DefaultChangeFeedSize))
+	for _, test := range []struct {
+		store crudley.Store
+		query string
+		code  int
+	}{
+		{errorStore{}, "", http.StatusInternalServerError},
+		{mem.NewStore(), "?int_val=one", http.StatusBadRequest},
+	} {
+		s := httptest.NewServer(crudley.NewPath(&model.TestModel{}, test.store, feed))
+		res, err := http.Get(s.URL + "/_live" + test.query)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		var tmr model.TestModelResponse
+		json.NewDecoder(res.Body).Decode(&tmr)
+		res.Body.Close()
+		s.Close()
+		if res.StatusCode != test.code || tmr.Error == "" {
+			t.Errorf("expected %d with an error for %q, got %d %q", test.code, test.query, res.StatusCode, tmr.Error)
+		}
+	}
+}
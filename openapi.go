@@ -0,0 +1,305 @@
+package crudley
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification that documents are
+// generated for
+const OpenAPIVersion = "3.1.0"
+
+// OpenAPIDocument is an OpenAPI document describing the endpoints of Paths
+type OpenAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       OpenAPIInfo                `json:"info"`
+	Servers    []OpenAPIServer            `json:"servers,omitempty"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components OpenAPIComponents          `json:"components"`
+}
+
+// OpenAPIInfo is the metadata of an API
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIServer is a URL an API is served from
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+// OpenAPIPathItem is the operations of a path, by lower case http method
+type OpenAPIPathItem map[string]*OpenAPIOperation
+
+// OpenAPIOperation describes an endpoint
+type OpenAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter is a path, query or header parameter of an operation
+type OpenAPIParameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// OpenAPIRequestBody is the body of a request, by content type
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required,omitempty"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse is a response of an operation
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType is the schema of a request or response body
+type OpenAPIMediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// OpenAPIComponents holds the schemas referred to by operations
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+const openAPIPath = "/_openapi.json"
+
+// OpenAPI returns an OpenAPI document describing paths, which are keyed by the
+// prefix they are served under, e.g. "/api/users"
+func OpenAPI(info OpenAPIInfo, paths map[string]*Path) *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI: OpenAPIVersion,
+		Info:    info,
+		Paths:   make(map[string]OpenAPIPathItem),
+		Components: OpenAPIComponents{Schemas: map[string]*Schema{
+			"Error": {
+				Type:       SchemaType{"object"},
+				Properties: map[string]*Schema{"error": {Type: SchemaType{"string"}}},
+			},
+		}},
+	}
+	for prefix, p := range paths {
+		p.describe(doc, strings.TrimSuffix(prefix, "/"))
+	}
+	return doc
+}
+
+// OpenAPI is the http handler serving the OpenAPI document of the Path, with the
+// prefix it is served under as the server URL
+func (p *Path) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc := OpenAPI(OpenAPIInfo{Title: p.Model.GetName(), Version: "1.0.0"}, map[string]*Path{"": p})
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		doc.Servers = []OpenAPIServer{{URL: strings.TrimSuffix(u.Path, openAPIPath)}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+func schemaRef(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func jsonContent(s *Schema) map[string]OpenAPIMediaType {
+	return map[string]OpenAPIMediaType{"application/json": {Schema: s}}
+}
+
+func errorResponse(description string) OpenAPIResponse {
+	return OpenAPIResponse{Description: description, Content: jsonContent(schemaRef("Error"))}
+}
+
+// describe adds the Path's schemas and routes to doc
+func (p *Path) describe(doc *OpenAPIDocument, prefix string) {
+	name := p.Model.GetName()
+	schemas := doc.Components.Schemas
+	schemas[name] = ModelSchema(p.Model)
+	schemas[name].Schema = ""
+	schemas[name+"Response"] = envelopeSchema(schemaRef(name))
+	if _, ok := p.Store.(Historian); ok {
+		schemas["Revision"] = typeSchema(revisionType, nil)
+		schemas["RevisionResponse"] = envelopeSchema(schemaRef("Revision"))
+	}
+	if !p.ReadOnly {
+		schemas["BatchRequest"] = typeSchema(batchRequestType, nil)
+		schemas["BatchResponse"] = &Schema{
+			Type: SchemaType{"object"},
+			Properties: map[string]*Schema{
+				"batch": {Type: SchemaType{"array"}, Items: typeSchema(batchResultType, nil)},
+				"error": {Type: SchemaType{"string"}},
+			},
+		}
+	}
+
+	for _, rt := range p.routes {
+		op := p.operation(rt, name)
+		if op == nil {
+			continue
+		}
+		path := prefix + rt.path
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(OpenAPIPathItem)
+		}
+		doc.Paths[path][strings.ToLower(rt.method)] = op
+	}
+}
+
+func envelopeSchema(item *Schema) *Schema {
+	return &Schema{
+		Type: SchemaType{"object"},
+		Properties: map[string]*Schema{
+			"results": {Type: SchemaType{"array"}, Items: item},
+			"error":   {Type: SchemaType{"string"}},
+		},
+	}
+}
+
+var (
+	idParameter = OpenAPIParameter{Name: ID, In: "path", Required: true, Schema: &Schema{Type: SchemaType{"string"}}}
+
+	revisionType     = reflect.TypeOf(Revision{})
+	batchRequestType = reflect.TypeOf(BatchRequest{})
+	batchResultType  = reflect.TypeOf(BatchResult{})
+)
+
+// operation describes a route, or returns nil for routes that aren't part of
+// the API
+func (p *Path) operation(rt route, name string) *OpenAPIOperation {
+	op := &OpenAPIOperation{
+		Tags: []string{name},
+		Responses: map[string]OpenAPIResponse{
+			"200": {Description: "OK", Content: jsonContent(schemaRef(name + "Response"))},
+			"401": errorResponse("Unauthorized"),
+		},
+	}
+	body := &OpenAPIRequestBody{Required: true, Content: jsonContent(schemaRef(name))}
+	switch rt.method + " " + rt.path {
+	case "GET /":
+		op.OperationID, op.Summary = "list", "Query "+name
+		op.Parameters = p.queryParameters(true)
+		op.Responses["400"] = errorResponse("Invalid query")
+	case "GET /_changes":
+		op.OperationID, op.Summary = "changes", "Stream changes to "+name+" as Server-Sent Events"
+		op.Parameters = append([]OpenAPIParameter{
+			{Name: "since", In: "query", Description: "sequence number to resume from", Schema: &Schema{Type: SchemaType{"integer"}}},
+			{Name: "Last-Event-ID", In: "header", Description: "sequence number to resume from", Schema: &Schema{Type: SchemaType{"integer"}}},
+		}, p.queryParameters(false)...)
+		op.Responses["200"] = OpenAPIResponse{Description: "OK", Content: map[string]OpenAPIMediaType{"text/event-stream": {Schema: &Schema{Type: SchemaType{"string"}}}}}
+		op.Responses["400"] = errorResponse("Invalid query")
+	case "GET /_live":
+		op.OperationID, op.Summary = "live", "Subscribe to a live query of "+name+" over a WebSocket"
+		op.Parameters = p.queryParameters(true)
+		delete(op.Responses, "200")
+		op.Responses["101"] = OpenAPIResponse{Description: "Switching Protocols"}
+	case "GET /{id}":
+		op.OperationID, op.Summary = "get", "Get a "+name
+		op.Parameters = []OpenAPIParameter{idParameter}
+		if _, ok := p.Store.(Historian); ok {
+			op.Parameters = append(op.Parameters, OpenAPIParameter{Name: asOfParam, In: "query", Description: "get the Model as it was at a time", Schema: &Schema{Type: SchemaType{"string"}, Format: "date-time"}})
+		}
+		op.Responses["404"] = errorResponse("Not Found")
+	case "GET /{id}/_history", "GET /{id}/_history/{rev}":
+		op.OperationID, op.Summary = "history", "List the revisions of a "+name
+		op.Parameters = []OpenAPIParameter{idParameter}
+		if strings.HasSuffix(rt.path, "{rev}") {
+			op.OperationID, op.Summary = "revision", "Get a revision of a "+name
+			op.Parameters = append(op.Parameters, OpenAPIParameter{Name: "rev", In: "path", Required: true, Schema: &Schema{Type: SchemaType{"integer"}}})
+		}
+		op.Responses["200"] = OpenAPIResponse{Description: "OK", Content: jsonContent(schemaRef("RevisionResponse"))}
+		op.Responses["404"] = errorResponse("Not Found")
+	case "POST /_batch":
+		op.OperationID, op.Summary = "batch", "Apply several operations to "+name
+		op.RequestBody = &OpenAPIRequestBody{Required: true, Content: jsonContent(schemaRef("BatchRequest"))}
+		op.Responses["200"] = OpenAPIResponse{Description: "OK", Content: jsonContent(schemaRef("BatchResponse"))}
+		op.Responses["400"] = errorResponse("Invalid batch")
+	case "POST /":
+		op.OperationID, op.Summary = "create", "Create a "+name
+		op.RequestBody = body
+		op.Parameters = []OpenAPIParameter{{Name: IdempotencyKeyHeader, In: "header", Description: "apply the request at most once", Schema: &Schema{Type: SchemaType{"string"}}}}
+		op.Responses["400"] = errorResponse("Invalid body")
+		op.Responses["409"] = errorResponse("Idempotency-Key conflict")
+	case "PUT /{id}":
+		op.OperationID, op.Summary = "update", "Update a "+name+" with the fields of the body"
+		op.RequestBody = body
+		op.Parameters = []OpenAPIParameter{idParameter}
+		if p.Upsert {
+			op.Responses["201"] = OpenAPIResponse{Description: "Created", Content: jsonContent(schemaRef(name + "Response"))}
+		}
+		op.Responses["400"] = errorResponse("Invalid body")
+		op.Responses["403"] = errorResponse("Forbidden")
+		op.Responses["404"] = errorResponse("Not Found")
+	case "DELETE /{id}":
+		op.OperationID, op.Summary = "delete", "Delete a "+name
+		op.Parameters = []OpenAPIParameter{idParameter}
+		op.Responses["404"] = errorResponse("Not Found")
+	case "POST /{id}/_restore":
+		op.OperationID, op.Summary = "restore", "Restore a deleted "+name
+		op.Parameters = []OpenAPIParameter{idParameter}
+		op.Responses["404"] = errorResponse("Not Found")
+		op.Responses["501"] = errorResponse("Restore unsupported")
+	default:
+		return nil
+	}
+	op.OperationID = name + "." + op.OperationID
+	return op
+}
+
+// queryParameters returns the parameters filtering the Path's Models, and if
+// modifiers is set the parameters that sort and paginate them
+func (p *Path) queryParameters(modifiers bool) []OpenAPIParameter {
+	var params []OpenAPIParameter
+	props := ModelSchema(p.Model).Properties
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := props[name]
+		if s.WriteOnly || len(s.Type) == 0 {
+			continue
+		}
+		param := &Schema{Type: s.Type[:1], Format: s.Format}
+		switch s.Type[0] {
+		case "object", "array":
+			continue
+		case "boolean":
+			params = append(params, OpenAPIParameter{Name: name, In: "query", Schema: param})
+			continue
+		}
+		less, greater := "_lessthan", "_greaterthan"
+		if s.Format == "date-time" {
+			less, greater = "_before", "_after"
+		}
+		params = append(params,
+			OpenAPIParameter{Name: name, In: "query", Schema: param},
+			OpenAPIParameter{Name: name + less, In: "query", Description: fmt.Sprintf("%s is less than", name), Schema: param},
+			OpenAPIParameter{Name: name + greater, In: "query", Description: fmt.Sprintf("%s is greater than", name), Schema: param},
+		)
+	}
+	if !modifiers {
+		return params
+	}
+	return append(params,
+		OpenAPIParameter{Name: "has", In: "query", Description: "field that must be set", Schema: &Schema{Type: SchemaType{"string"}}},
+		OpenAPIParameter{Name: "sort", In: "query", Description: "field to sort by, prefixed with - for descending order", Schema: &Schema{Type: SchemaType{"string"}}},
+		OpenAPIParameter{Name: "skip", In: "query", Description: "number of results to skip", Schema: &Schema{Type: SchemaType{"integer"}}},
+		OpenAPIParameter{Name: "limit", In: "query", Description: "maximum number of results", Schema: &Schema{Type: SchemaType{"integer"}}},
+		OpenAPIParameter{Name: includeDeletedParam, In: "query", Description: "include deleted Models", Schema: &Schema{Type: SchemaType{"boolean"}}},
+	)
+}
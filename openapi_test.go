@@ -0,0 +1,97 @@
+package crudley_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+func TestOpenAPI(t *testing.T) {
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore())
+	s := httptest.NewServer(http.StripPrefix("/api/test", p))
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "/api/test/_openapi.json")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	defer res.Body.Close()
+	var doc crudley.OpenAPIDocument
+	err = json.NewDecoder(res.Body).Decode(&doc)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if doc.OpenAPI != crudley.OpenAPIVersion {
+		t.Errorf("expected %s, got %s", crudley.OpenAPIVersion, doc.OpenAPI)
+	}
+	if len(doc.Servers) != 1 || doc.Servers[0].URL != "/api/test" {
+		t.Errorf("expected server /api/test, got %+v", doc.Servers)
+	}
+	for path, methods := range map[string][]string{
+		"/":              {"get", "post"},
+		"/{id}":          {"get", "put", "delete"},
+		"/_batch":        {"post"},
+		"/{id}/_restore": {"post"},
+	} {
+		for _, method := range methods {
+			if doc.Paths[path][method] == nil {
+				t.Errorf("expected %s %s, got %v", method, path, doc.Paths[path])
+			}
+		}
+	}
+	if _, ok := doc.Paths["/_openapi.json"]; ok {
+		t.Errorf("expected the document not to describe itself")
+	}
+
+	params := make(map[string]bool)
+	for _, param := range doc.Paths["/"]["get"].Parameters {
+		params[param.Name] = true
+	}
+	for _, name := range []string{"int_val", "int_val_lessthan", "time_val_after", "bool_val", "sort", "limit", "skip"} {
+		if !params[name] {
+			t.Errorf("expected parameter %s, got %v", name, params)
+		}
+	}
+	if params["struct_val"] {
+		t.Errorf("expected no struct_val parameter")
+	}
+
+	schema := doc.Components.Schemas["testmodel"]
+	if schema == nil {
+		t.Fatalf("expected testmodel schema, got %v", doc.Components.Schemas)
+	}
+	if id := schema.Properties["id"]; id == nil || !id.ReadOnly {
+		t.Errorf("expected read only id, got %+v", id)
+	}
+	if tv := schema.Properties["time_val"]; tv == nil || tv.Format != "date-time" {
+		t.Errorf("expected date-time, got %+v", tv)
+	}
+}
+
+func TestOpenAPIPaths(t *testing.T) {
+	doc := crudley.OpenAPI(crudley.OpenAPIInfo{Title: "test", Version: "1"}, map[string]*crudley.Path{
+		"/api/test/":     crudley.NewPath(&model.TestModel{}, mem.NewStore(), crudley.OptionReadOnly),
+		"/api/accounts/": crudley.NewPath(&account{}, mem.NewStore()),
+	})
+	if doc.Paths["/api/test/"]["get"] == nil || doc.Paths["/api/test/"]["post"] != nil {
+		t.Errorf("expected a read only test path, got %v", doc.Paths["/api/test/"])
+	}
+	if op := doc.Paths["/api/accounts/{id}"]["put"]; op == nil || op.OperationID != "accounts.update" {
+		t.Errorf("expected accounts.update, got %+v", op)
+	}
+	accounts := doc.Components.Schemas["accounts"]
+	if accounts == nil {
+		t.Fatalf("expected accounts schema")
+	}
+	if _, ok := accounts.Properties["secret"]; ok {
+		t.Errorf("expected private field to be omitted")
+	}
+	if p := accounts.Properties["password"]; p == nil || !p.WriteOnly {
+		t.Errorf("expected write only password, got %+v", p)
+	}
+}
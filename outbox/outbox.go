@@ -0,0 +1,204 @@
+// Package outbox implements the transactional outbox pattern for crudley. The
+// Store returned by New saves an Entry alongside every change in the same
+// transaction, and a Relay publishes the Entries to a Publisher, so a change is
+// never saved without its event being published at least once.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/ids"
+)
+
+// Entry is a change waiting to be published by a Relay. Data is the Model
+// without the fields no role can read, and Tenant is the tenant the change was
+// made for, if any. Seq is a copy of the
+// ID, stored under the same field name by every Store so the Relay can sort on
+// it, the mongo Store keeps the ID as _id.
+type Entry struct {
+	ID        string          `json:"id" bson:"_id" firestore:"id"`
+	Seq       string          `json:"seq" bson:"seq" firestore:"seq"`
+	Tenant    string          `json:"tenant,omitempty" bson:"tenant,omitempty" firestore:"tenant,omitempty"`
+	Type      string          `json:"type" bson:"type" firestore:"type"`
+	Model     string          `json:"model" bson:"model" firestore:"model"`
+	ModelID   string          `json:"model_id" bson:"model_id" firestore:"model_id"`
+	Time      time.Time       `json:"time" bson:"time" firestore:"time"`
+	Data      json.RawMessage `json:"data" bson:"data" firestore:"data"`
+	Attempts  int             `json:"attempts" bson:"attempts" firestore:"attempts"`
+	LastError string          `json:"last_error" bson:"last_error" firestore:"last_error"`
+	Deleted   bool            `json:"deleted" bson:"deleted" firestore:"deleted"`
+}
+
+// New returns an empty Entry with the ID
+func (e *Entry) New(id string) crudley.Model {
+	return &Entry{ID: id}
+}
+
+// GetName returns the collection name Entries are stored in
+func (e *Entry) GetName() string {
+	return "outbox"
+}
+
+// PrimaryKey returns the Entry's ID
+func (e *Entry) PrimaryKey() string {
+	return e.ID
+}
+
+// Delete marks the Entry as deleted
+func (e *Entry) Delete() {
+	e.Deleted = true
+}
+
+// IsDeleted returns true if the Entry has been deleted
+func (e *Entry) IsDeleted() bool {
+	return e.Deleted
+}
+
+// New wraps s so that every Create, Update and Delete also saves an Entry in the
+// same transaction. s must implement crudley.Transactor.
+func New(s crudley.Store) (crudley.Store, error) {
+	if _, ok := s.(crudley.Transactor); !ok {
+		return nil, crudley.ErrorTransactionsUnsupported
+	}
+	return &store{Store: s}, nil
+}
+
+type store struct {
+	crudley.Store
+}
+
+func (s *store) Collection(m crudley.Model) (crudley.Collection, error) {
+	c, err := s.Store.Collection(m)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := m.(*Entry); ok {
+		// changes to the outbox itself aren't recorded
+		return c, nil
+	}
+	return &collection{Collection: c, s: s.Store, model: m}, nil
+}
+
+// RunInTransaction runs fn in a transaction on the wrapped Store, saving Entries
+// for the changes made in it
+func (s *store) RunInTransaction(ctx context.Context, fn crudley.TransactionFunc) error {
+	return crudley.RunInTransaction(ctx, s.Store, func(ctx context.Context, tx crudley.Store) error {
+		return fn(ctx, &store{Store: tx})
+	})
+}
+
+type collection struct {
+	crudley.Collection
+	s     crudley.Store
+	model crudley.Model
+}
+
+// tx runs fn with the Model's Collection and the outbox Collection in a
+// transaction. Stores already in a transaction run fn within it.
+func (c *collection) tx(ctx context.Context, fn func(ctx context.Context, col, outbox crudley.Collection) error) error {
+	return crudley.RunInTransaction(ctx, c.s, func(ctx context.Context, tx crudley.Store) error {
+		col, err := tx.Collection(c.model)
+		if err != nil {
+			return err
+		}
+		outbox, err := tx.Collection(&Entry{})
+		if err != nil {
+			return err
+		}
+		return fn(ctx, col, outbox)
+	})
+}
+
+func (c *collection) Create(ctx context.Context, fn crudley.CreaterFunc) error {
+	return c.tx(ctx, func(ctx context.Context, col, outbox crudley.Collection) error {
+		var m crudley.Model
+		err := col.Create(ctx, func(id string) (crudley.Model, error) {
+			var err error
+			m, err = fn(id)
+			return m, err
+		})
+		if err != nil {
+			return err
+		}
+		return c.record(ctx, outbox, crudley.ChangeCreated, m.PrimaryKey(), m)
+	})
+}
+
+// CreateWithID passes through to the wrapped Collection if it is an IDCreater
+func (c *collection) CreateWithID(ctx context.Context, id string, fn crudley.CreaterFunc) error {
+	return c.tx(ctx, func(ctx context.Context, col, outbox crudley.Collection) error {
+		ic, ok := col.(crudley.IDCreater)
+		if !ok {
+			return crudley.ErrorClientIDUnsupported
+		}
+		var m crudley.Model
+		err := ic.CreateWithID(ctx, id, func(id string) (crudley.Model, error) {
+			var err error
+			m, err = fn(id)
+			return m, err
+		})
+		if err != nil {
+			return err
+		}
+		return c.record(ctx, outbox, crudley.ChangeCreated, id, m)
+	})
+}
+
+func (c *collection) Update(ctx context.Context, id string, m crudley.Model) error {
+	return c.tx(ctx, func(ctx context.Context, col, outbox crudley.Collection) error {
+		prev, err := col.View(ctx, id)
+		if err != nil {
+			return err
+		}
+		typ := crudley.ChangeUpdated
+		if prev != nil && !prev.IsDeleted() && m.IsDeleted() {
+			typ = crudley.ChangeDeleted
+		}
+		err = col.Update(ctx, id, m)
+		if err != nil {
+			return err
+		}
+		return c.record(ctx, outbox, typ, id, m)
+	})
+}
+
+func (c *collection) Delete(ctx context.Context, id string) error {
+	return c.tx(ctx, func(ctx context.Context, col, outbox crudley.Collection) error {
+		prev, err := col.View(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = col.Delete(ctx, id)
+		if err != nil {
+			return err
+		}
+		return c.record(ctx, outbox, crudley.ChangeDeleted, id, prev)
+	})
+}
+
+// record saves an Entry for a change to m in outbox
+func (c *collection) record(ctx context.Context, outbox crudley.Collection, typ, id string, m crudley.Model) error {
+	data, err := json.Marshal(crudley.Redact(m, nil))
+	if err != nil {
+		return err
+	}
+	e := &Entry{
+		Tenant:  crudley.TenantFromContext(ctx),
+		Type:    typ,
+		Model:   c.model.GetName(),
+		ModelID: id,
+		Time:    time.Now(),
+		Data:    data,
+	}
+	// Entry IDs sort in the order they were created, which is the order the
+	// Relay publishes them in
+	ctx = crudley.WithIDGenerator(ctx, ids.ULID)
+	return outbox.Create(ctx, func(id string) (crudley.Model, error) {
+		e.ID = id
+		e.Seq = id
+		return e, nil
+	})
+}
@@ -0,0 +1,236 @@
+package outbox_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/outbox"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+func TestOutbox(t *testing.T) {
+	s, err := outbox.New(mem.NewStore())
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	p := crudley.NewPath(&model.TestModel{}, s)
+	api := httptest.NewServer(http.StripPrefix("/api/test", p))
+	defer api.Close()
+
+	res, err := http.Post(api.URL+"/api/test/", "application/json", bytes.NewBufferString(`{"string_val": "foo"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	var tmr model.TestModelResponse
+	err = json.NewDecoder(res.Body).Decode(&tmr)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	id := tmr.Results[0].ID
+	for _, method := range []string{"PUT", "DELETE"} {
+		req, err := http.NewRequest(method, fmt.Sprintf("%s/api/test/%s", api.URL, id), bytes.NewBufferString(`{"int_val": 1}`))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		res.Body.Close()
+	}
+
+	// a failed transaction saves neither the Model nor an Entry
+	failed := errors.New("failed")
+	err = crudley.RunInTransaction(context.Background(), s, func(ctx context.Context, tx crudley.Store) error {
+		c, err := tx.Collection(&model.TestModel{})
+		if err != nil {
+			return err
+		}
+		err = c.Create(ctx, func(id string) (crudley.Model, error) {
+			return &model.TestModel{ID: id}, nil
+		})
+		if err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("expected %s, got %v", failed, err)
+	}
+
+	ch := make(outbox.ChannelPublisher, 10)
+	r := outbox.NewRelay(s, ch)
+	n, err := r.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3, got %v", n)
+	}
+	for _, subject := range []string{"testmodel.created", "testmodel.updated", "testmodel.deleted"} {
+		msg := <-ch
+		if msg.Subject != subject {
+			t.Errorf("expected %s, got %s", subject, msg.Subject)
+		}
+		var e outbox.Entry
+		err := json.Unmarshal(msg.Data, &e)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		if e.ModelID != id || e.ID != msg.ID {
+			t.Errorf("expected entry for %s, got %+v", id, e)
+		}
+	}
+	n, err = r.Flush(context.Background())
+	if err != nil || n != 0 {
+		t.Errorf("expected empty outbox, got %v, %v", n, err)
+	}
+}
+
+func TestOutboxUnsupported(t *testing.T) {
+	_, err := outbox.New(struct{ crudley.Store }{mem.NewStore()})
+	if err != crudley.ErrorTransactionsUnsupported {
+		t.Errorf("expected %s, got %v", crudley.ErrorTransactionsUnsupported, err)
+	}
+}
+
+type account struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Password string `json:"password" rest:"writeonly"`
+	Secret   string `json:"secret" rest:"private"`
+	Deleted  bool   `json:"deleted"`
+}
+
+func (a *account) New(id string) crudley.Model { return &account{ID: id} }
+func (a *account) GetName() string             { return "accounts" }
+func (a *account) PrimaryKey() string          { return a.ID }
+func (a *account) Delete()                     { a.Deleted = true }
+func (a *account) IsDeleted() bool             { return a.Deleted }
+
+func TestOutboxRedacts(t *testing.T) {
+	s, err := outbox.New(mem.NewStore())
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	c, err := s.Collection(&account{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	ctx := crudley.WithTenant(context.Background(), "acme")
+	err = c.Create(ctx, func(id string) (crudley.Model, error) {
+		return &account{ID: id, Name: "alice", Password: "hunter2", Secret: "s"}, nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+
+	ch := make(outbox.ChannelPublisher, 1)
+	_, err = outbox.NewRelay(s, ch).Flush(context.Background())
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	var e struct {
+		Tenant string                 `json:"tenant"`
+		Data   map[string]interface{} `json:"data"`
+	}
+	err = json.Unmarshal((<-ch).Data, &e)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if e.Tenant != "acme" {
+		t.Errorf("expected acme, got %s", e.Tenant)
+	}
+	if e.Data["name"] != "alice" {
+		t.Errorf("expected alice, got %v", e.Data)
+	}
+	for _, field := range []string{"password", "secret"} {
+		if _, ok := e.Data[field]; ok {
+			t.Errorf("expected %s to be redacted, got %v", field, e.Data)
+		}
+	}
+}
+
+type natsConn map[string][]byte
+
+func (n natsConn) Publish(subject string, data []byte) error {
+	n[subject] = data
+	return nil
+}
+
+func TestRelayRetry(t *testing.T) {
+	s, err := outbox.New(mem.NewStore())
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	c, err := s.Collection(&model.TestModel{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	err = c.Create(context.Background(), func(id string) (crudley.Model, error) {
+		return &model.TestModel{ID: id}, nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+
+	var fail = true
+	var received []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, r.Header.Get("X-Outbox-Subject"))
+		w.Write(body)
+	}))
+	defer hook.Close()
+	r := outbox.NewRelay(s, &outbox.HTTPPublisher{URL: hook.URL})
+
+	n, err := r.Flush(context.Background())
+	if err == nil || n != 0 {
+		t.Fatalf("expected error, got %v, %v", n, err)
+	}
+	entries, err := s.Collection(&outbox.Entry{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	var attempts []int
+	entries.Scan(context.Background(), func(m crudley.Model) error {
+		attempts = append(attempts, m.(*outbox.Entry).Attempts)
+		return nil
+	})
+	if len(attempts) != 1 || attempts[0] != 1 {
+		t.Errorf("expected 1 entry with 1 attempt, got %v", attempts)
+	}
+
+	fail = false
+	n, err = r.Flush(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1, got %v, %v", n, err)
+	}
+	if len(received) != 1 || received[0] != "testmodel.created" {
+		t.Errorf("expected testmodel.created, got %v", received)
+	}
+
+	nc := natsConn{}
+	np := &outbox.NATSPublisher{Conn: nc, Prefix: "crudley."}
+	err = np.Publish(context.Background(), outbox.Message{ID: "1", Subject: "testmodel.created", Data: []byte("{}")})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if _, ok := nc["crudley.testmodel.created"]; !ok {
+		t.Errorf("expected crudley.testmodel.created, got %v", nc)
+	}
+}
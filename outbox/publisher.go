@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Message is an Entry ready to be published. Delivery is at least once, so
+// consumers should use ID to discard duplicates.
+type Message struct {
+	ID string
+	// Subject is "<model>.<type>", e.g. "incidents.created"
+	Subject string
+	// Data is the JSON encoded Entry, without Attempts and LastError
+	Data []byte
+}
+
+// Publisher sends Messages to a broker or consumer. A Message is removed from
+// the outbox once Publish returns nil, otherwise it is retried.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface
+type PublisherFunc func(ctx context.Context, msg Message) error
+
+// Publish calls f
+func (f PublisherFunc) Publish(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// ChannelPublisher sends Messages to a channel, for consumers in the same process
+type ChannelPublisher chan Message
+
+// Publish blocks until the Message is received or ctx is done
+func (c ChannelPublisher) Publish(ctx context.Context, msg Message) error {
+	select {
+	case c <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HTTPPublisher POSTs Messages to URL. The Message ID is sent in the
+// Idempotency-Key header and the subject in the X-Outbox-Subject header.
+type HTTPPublisher struct {
+	URL    string
+	Client *http.Client
+}
+
+// Publish returns an error unless the response has a 2xx status
+func (h *HTTPPublisher) Publish(ctx context.Context, msg Message) error {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(msg.Data))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", msg.ID)
+	req.Header.Set("X-Outbox-Subject", msg.Subject)
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// NATSConn is the subset of a NATS client connection used by NATSPublisher,
+// which *nats.Conn satisfies
+type NATSConn interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATSPublisher publishes Messages to a NATS compatible broker, on the Message's
+// subject with Prefix prepended
+type NATSPublisher struct {
+	Conn   NATSConn
+	Prefix string
+}
+
+// Publish publishes the Message's Data
+func (n *NATSPublisher) Publish(ctx context.Context, msg Message) error {
+	return n.Conn.Publish(n.Prefix+msg.Subject, msg.Data)
+}
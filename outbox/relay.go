@@ -0,0 +1,130 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/arussellsaw/crudley"
+)
+
+// Defaults for a Relay
+const (
+	DefaultInterval  = time.Second
+	DefaultBatchSize = 100
+)
+
+// Option configures a Relay
+type Option func(r *Relay)
+
+// OptionInterval sets how often the Relay polls for Entries when the outbox is
+// empty, or after Publish fails
+func OptionInterval(d time.Duration) Option {
+	return func(r *Relay) {
+		r.Interval = d
+	}
+}
+
+// OptionBatchSize sets how many Entries the Relay reads at a time
+func OptionBatchSize(n int) Option {
+	return func(r *Relay) {
+		r.BatchSize = n
+	}
+}
+
+// NewRelay returns a Relay publishing the Entries saved in s to p
+func NewRelay(s crudley.Store, p Publisher, opts ...Option) *Relay {
+	r := &Relay{
+		Store:     s,
+		Publisher: p,
+		Interval:  DefaultInterval,
+		BatchSize: DefaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Relay publishes Entries in the order they were saved, removing them from the
+// outbox once they have been published. An Entry that fails to publish is
+// retried before any later ones, so a Publisher that keeps failing holds up the
+// outbox. Running more than one Relay for a Store can publish Entries more than
+// once, or out of order.
+type Relay struct {
+	Store     crudley.Store
+	Publisher Publisher
+	Interval  time.Duration
+	BatchSize int
+}
+
+// Run publishes Entries until ctx is done, it should be run in its own goroutine
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		n, err := r.Flush(ctx)
+		if err == nil && n == r.BatchSize {
+			// there may be more waiting
+			continue
+		}
+		t := time.NewTimer(r.Interval)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Flush publishes up to BatchSize Entries, returning how many were published. It
+// stops at the first Entry that fails to publish, recording the error on it.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	c, err := r.Store.Collection(&Entry{})
+	if err != nil {
+		return 0, err
+	}
+	q := c.Query()
+	q.Sort("seq")
+	q.Limit(r.BatchSize)
+	entries, err := q.Execute(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i, m := range entries {
+		e := m.(*Entry)
+		err = r.publish(ctx, e)
+		if err != nil {
+			e.Attempts++
+			e.LastError = err.Error()
+			c.Update(ctx, e.ID, e)
+			return i, err
+		}
+		// if this fails the Entry is published again, which is allowed by at
+		// least once delivery
+		err = c.Delete(ctx, e.ID)
+		if err != nil {
+			return i + 1, err
+		}
+	}
+	return len(entries), nil
+}
+
+func (r *Relay) publish(ctx context.Context, e *Entry) error {
+	data, err := json.Marshal(struct {
+		ID      string          `json:"id"`
+		Tenant  string          `json:"tenant,omitempty"`
+		Type    string          `json:"type"`
+		Model   string          `json:"model"`
+		ModelID string          `json:"model_id"`
+		Time    time.Time       `json:"time"`
+		Data    json.RawMessage `json:"data"`
+	}{e.ID, e.Tenant, e.Type, e.Model, e.ModelID, e.Time, e.Data})
+	if err != nil {
+		return err
+	}
+	return r.Publisher.Publish(ctx, Message{
+		ID:      e.ID,
+		Subject: e.Model + "." + e.Type,
+		Data:    data,
+	})
+}
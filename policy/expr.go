@@ -0,0 +1,646 @@
+package policy
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/arussellsaw/crudley"
+)
+
+// node is a parsed expression
+type node interface {
+	eval(e *env) (interface{}, error)
+}
+
+type andNode struct{ l, r node }
+
+type orNode struct{ l, r node }
+
+type notNode struct{ x node }
+
+type cmpNode struct {
+	op   string
+	l, r node
+}
+
+type litNode struct{ v interface{} }
+
+type listNode struct{ items []node }
+
+// identNode is a dotted name, e.g. principal.id or owner
+type identNode struct{ path []string }
+
+// Roots of identifiers that don't refer to the Model's fields
+const (
+	rootPrincipal = "principal"
+	rootAction    = "action"
+	rootModel     = "model"
+	rootPrevious  = "previous"
+)
+
+// modelField returns the path of the Model field the identifier refers to
+func (n identNode) modelField() ([]string, bool) {
+	switch n.path[0] {
+	case rootPrincipal, rootAction, rootPrevious:
+		return nil, false
+	case rootModel:
+		return n.path[1:], len(n.path) > 1
+	}
+	return n.path, true
+}
+
+// env is what expressions are evaluated against
+type env struct {
+	m      crudley.Model
+	action crudley.Action
+	roles  []string
+}
+
+func (n andNode) eval(e *env) (interface{}, error) {
+	l, err := evalBool(n.l, e)
+	if err != nil || !l {
+		return false, err
+	}
+	return evalBool(n.r, e)
+}
+
+func (n orNode) eval(e *env) (interface{}, error) {
+	l, err := evalBool(n.l, e)
+	if err != nil || l {
+		return l, err
+	}
+	return evalBool(n.r, e)
+}
+
+func (n notNode) eval(e *env) (interface{}, error) {
+	x, err := evalBool(n.x, e)
+	return !x, err
+}
+
+func (n litNode) eval(e *env) (interface{}, error) {
+	return n.v, nil
+}
+
+func (n listNode) eval(e *env) (interface{}, error) {
+	out := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		v, err := item.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (n identNode) eval(e *env) (interface{}, error) {
+	switch n.path[0] {
+	case rootPrincipal:
+		return principalValue(e, n.path[1:])
+	case rootAction:
+		return actionValue(e, n.path[1:])
+	case rootPrevious:
+		if e.action.Previous == nil {
+			return nil, nil
+		}
+		return fieldValue(e.action.Previous, n.path[1:])
+	}
+	path, _ := n.modelField()
+	return fieldValue(e.m, path)
+}
+
+func (n cmpNode) eval(e *env) (interface{}, error) {
+	l, err := n.l.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.r.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	l, r = normalise(l), normalise(r)
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "in":
+		for _, v := range listValues(r) {
+			if equal(l, normalise(v)) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	c, ok := compare(l, r)
+	if !ok {
+		return false, nil
+	}
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+func evalBool(n node, e *env) (bool, error) {
+	v, err := n.eval(e)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok && v != nil {
+		return false, fmt.Errorf("expected a boolean, got %v", v)
+	}
+	return b, nil
+}
+
+// evalPartial evaluates n for a Partial Action, known is false if the result
+// depends on the Model, the previous Model or the changes, which aren't known
+func evalPartial(n node, e *env) (result, known bool, err error) {
+	switch n := n.(type) {
+	case andNode:
+		l, lk, err := evalPartial(n.l, e)
+		if err != nil || (lk && !l) {
+			return false, true, err
+		}
+		r, rk, err := evalPartial(n.r, e)
+		if err != nil || (rk && !r) {
+			return false, true, err
+		}
+		return true, lk && rk, nil
+	case orNode:
+		l, lk, err := evalPartial(n.l, e)
+		if err != nil || (lk && l) {
+			return l, true, err
+		}
+		r, rk, err := evalPartial(n.r, e)
+		if err != nil || (rk && r) {
+			return r, true, err
+		}
+		return false, lk && rk, nil
+	case notNode:
+		x, known, err := evalPartial(n.x, e)
+		return !x, known, err
+	}
+	if dependsOnModel(n) {
+		return false, false, nil
+	}
+	b, err := evalBool(n, e)
+	return b, true, err
+}
+
+// dependsOnModel returns true if n refers to the Model's fields, the previous
+// Model's fields or action.changes
+func dependsOnModel(n node) bool {
+	switch n := n.(type) {
+	case identNode:
+		if _, ok := n.modelField(); ok {
+			return true
+		}
+		switch n.path[0] {
+		case rootPrevious:
+			return true
+		case rootAction:
+			return len(n.path) > 1 && n.path[1] == "changes"
+		}
+		return false
+	case andNode:
+		return dependsOnModel(n.l) || dependsOnModel(n.r)
+	case orNode:
+		return dependsOnModel(n.l) || dependsOnModel(n.r)
+	case notNode:
+		return dependsOnModel(n.x)
+	case cmpNode:
+		return dependsOnModel(n.l) || dependsOnModel(n.r)
+	case listNode:
+		for _, item := range n.items {
+			if dependsOnModel(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func principalValue(e *env, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("principal needs a field, e.g. principal.id")
+	}
+	switch path[0] {
+	case "id":
+		if e.action.Principal == nil {
+			return nil, nil
+		}
+		return e.action.Principal.PrincipalID(), nil
+	case "roles":
+		return e.roles, nil
+	}
+	if e.action.Principal == nil {
+		return nil, nil
+	}
+	return fieldValue(e.action.Principal, path)
+}
+
+func actionValue(e *env, path []string) (interface{}, error) {
+	if len(path) != 1 {
+		return nil, fmt.Errorf("action needs a field, e.g. action.op")
+	}
+	switch path[0] {
+	case "op":
+		return e.action.Op, nil
+	case "method":
+		return e.action.Method, nil
+	case "changes":
+		return e.action.Changes, nil
+	case "include_deleted":
+		return e.action.IncludeDeleted, nil
+	}
+	return nil, fmt.Errorf("unknown field action.%s", path[0])
+}
+
+// fieldValue returns the value of the field of v identified by its json path
+func fieldValue(v interface{}, path []string) (interface{}, error) {
+	f, ok := field(reflect.ValueOf(v), path)
+	if !ok {
+		return nil, fmt.Errorf("%T has no field %s", v, strings.Join(path, "."))
+	}
+	for f.Kind() == reflect.Ptr || f.Kind() == reflect.Interface {
+		if f.IsNil() {
+			return nil, nil
+		}
+		f = f.Elem()
+	}
+	return f.Interface(), nil
+}
+
+func field(v reflect.Value, path []string) (reflect.Value, bool) {
+	for _, name := range path {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v = reflect.Zero(v.Type().Elem())
+				continue
+			}
+			v = v.Elem()
+		}
+		f, ok := fieldByJSONName(v, name)
+		if !ok {
+			return reflect.Value{}, false
+		}
+		v = f
+	}
+	return v, true
+}
+
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, bool) {
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == name || (tag == "" && f.Name == name) {
+			return v.Field(i), true
+		}
+		if tag == "" && f.Anonymous && v.Field(i).Kind() == reflect.Struct {
+			if fv, ok := fieldByJSONName(v.Field(i), name); ok {
+				return fv, true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// normalise converts numbers to float64 so they can be compared
+func normalise(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	}
+	return v
+}
+
+func listValues(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil
+	}
+	out := make([]interface{}, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out
+}
+
+func equal(l, r interface{}) bool {
+	if c, ok := compare(l, r); ok {
+		return c == 0
+	}
+	return reflect.DeepEqual(l, r)
+}
+
+// compare returns -1, 0 or 1 if l is less than, equal to or greater than r, ok
+// is false if they can't be compared
+func compare(l, r interface{}) (int, bool) {
+	switch lv := l.(type) {
+	case float64:
+		rv, ok := r.(float64)
+		if !ok {
+			return 0, false
+		}
+		return cmp(lv < rv, lv > rv), true
+	case string:
+		if rt, ok := r.(time.Time); ok {
+			c, ok := compare(rt, l)
+			return -c, ok
+		}
+		rv, ok := r.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(lv, rv), true
+	case time.Time:
+		rv, ok := r.(time.Time)
+		if s, isString := r.(string); isString {
+			t, err := time.Parse(time.RFC3339, s)
+			rv, ok = t, err == nil
+		}
+		if !ok {
+			return 0, false
+		}
+		return cmp(lv.Before(rv), lv.After(rv)), true
+	}
+	return 0, false
+}
+
+func cmp(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// parse parses a where expression, e.g. owner == principal.id && !archived
+func parse(s string) (node, error) {
+	toks, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.toks) {
+		return nil, fmt.Errorf("unexpected %s", p.toks[p.pos].text)
+	}
+	return n, nil
+}
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","}
+
+func tokenize(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && rune(s[j]) != c {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string %s", s[i:])
+			}
+			text := s[i+1 : j]
+			if c == '"' {
+				unquoted, err := strconv.Unquote(s[i : j+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid string %s", s[i:j+1])
+				}
+				text = unquoted
+			}
+			toks = append(toks, token{kind: tokString, text: text})
+			i = j + 1
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(s) && unicode.IsDigit(rune(s[i+1]))):
+			j := i + 1
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{kind: tokNumber, text: s[i:j]})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_' || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: s[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q", c)
+			}
+			toks = append(toks, token{kind: tokOp, text: op})
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.toks) {
+		return token{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+// accept consumes the next token if it is one of the operators or keywords
+func (p *parser) accept(texts ...string) (string, bool) {
+	t, ok := p.peek()
+	if !ok || t.kind == tokString || t.kind == tokNumber {
+		return "", false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		return fmt.Errorf("expected %s", text)
+	}
+	return nil
+}
+
+func (p *parser) or() (node, error) {
+	n, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return n, nil
+		}
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		n = orNode{n, r}
+	}
+}
+
+func (p *parser) and() (node, error) {
+	n, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return n, nil
+		}
+		r, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		n = andNode{n, r}
+	}
+}
+
+func (p *parser) not() (node, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	}
+	if _, ok := p.accept("("); ok {
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	l, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "in")
+	if !ok {
+		return l, nil
+	}
+	r, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return cmpNode{op: op, l: l, r: r}, nil
+}
+
+func (p *parser) operand() (node, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	switch t.kind {
+	case tokString:
+		return litNode{t.text}, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", t.text)
+		}
+		return litNode{f}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return litNode{true}, nil
+		case "false":
+			return litNode{false}, nil
+		case "null", "nil":
+			return litNode{nil}, nil
+		}
+		return identNode{path: strings.Split(t.text, ".")}, nil
+	}
+	if t.text == "[" {
+		var list listNode
+		for {
+			if _, ok := p.accept("]"); ok {
+				return list, nil
+			}
+			if len(list.items) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			item, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			list.items = append(list.items, item)
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s", t.text)
+}
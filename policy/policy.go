@@ -0,0 +1,366 @@
+// Package policy authorises crudley Actions with declarative rules, rather than
+// an Authorise method on every Model. A Policy is a list of rules per Model,
+// each allowing some roles to perform some operations, optionally only where an
+// expression holds:
+//
+//	testmodel:
+//	  - anyone may get, list where owner == principal.id
+//	  - role=editor may create, update where owner == principal.id && !archived
+//	  - roles: [admin]
+//	    allow: ["*"]
+//
+// Expressions compare the Model's fields, by their json names, with literals and
+// the principal.id, principal.roles, action.op, action.method, action.changes and
+// previous.<field> of the request, using ==, !=, <, <=, >, >=, in, && (and),
+// || (or) and ! (not).
+//
+// A Policy is set on a Path with crudley.OptionAuthoriser, and adds predicates to
+// list queries so the Store only returns Models the rules could allow.
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/arussellsaw/crudley"
+)
+
+// AnyModel is the Model name of rules that apply to every Model
+const AnyModel = "*"
+
+// AnyOp allows a rule every operation
+const AnyOp = "*"
+
+// ErrorForbidden is returned when no rule allows an Action
+var ErrorForbidden = errors.New("forbidden by policy")
+
+// RolePrincipal is a Principal with roles, which are used as well as the roles
+// set on the request with crudley.WithRoles
+type RolePrincipal interface {
+	crudley.Principal
+	PrincipalRoles() []string
+}
+
+// Rule allows the principals with any of Roles, or anyone if there are none, to
+// perform the Allow operations where the expression Where holds
+type Rule struct {
+	Roles []string `yaml:"roles"`
+	Allow []string `yaml:"allow"`
+	Where string   `yaml:"where"`
+
+	expr node
+}
+
+var ruleRegexp = regexp.MustCompile(`^(?:(anyone)|roles?=(\S+))?\s*may\s+(.+?)(?:\s+where\s+(.+))?$`)
+
+// ParseRule parses a rule written as a sentence, e.g.
+// "role=editor may update, delete where owner == principal.id". Several roles
+// are separated by |, and rules for anyone start "anyone may".
+func ParseRule(s string) (*Rule, error) {
+	match := ruleRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return nil, fmt.Errorf("invalid rule %q", s)
+	}
+	r := &Rule{Where: match[4]}
+	if match[2] != "" {
+		r.Roles = strings.Split(match[2], "|")
+	}
+	for _, op := range strings.Split(match[3], ",") {
+		r.Allow = append(r.Allow, strings.TrimSpace(op))
+	}
+	return r, r.compile()
+}
+
+func (r *Rule) compile() error {
+	if len(r.Allow) == 0 {
+		return fmt.Errorf("rule allows no operations")
+	}
+	if r.Where == "" {
+		return nil
+	}
+	expr, err := parse(r.Where)
+	if err != nil {
+		return fmt.Errorf("invalid where %q: %s", r.Where, err)
+	}
+	r.expr = expr
+	return nil
+}
+
+// UnmarshalYAML reads a rule written either as a sentence or as a map of roles,
+// allow and where
+func (r *Rule) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		parsed, err := ParseRule(n.Value)
+		if err != nil {
+			return err
+		}
+		*r = *parsed
+		return nil
+	}
+	type rule Rule
+	err := n.Decode((*rule)(r))
+	if err != nil {
+		return err
+	}
+	return r.compile()
+}
+
+func (r *Rule) matches(op string, roles []string) bool {
+	allowed := false
+	for _, a := range r.Allow {
+		if a == op || a == AnyOp {
+			allowed = true
+		}
+	}
+	if !allowed || len(r.Roles) == 0 {
+		return allowed
+	}
+	for _, want := range r.Roles {
+		for _, role := range roles {
+			if want == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Policy is the Rules for each Model, by name. Models without rules can't be
+// accessed at all.
+type Policy struct {
+	rules map[string][]*Rule
+}
+
+// New returns an empty Policy
+func New() *Policy {
+	return &Policy{rules: make(map[string][]*Rule)}
+}
+
+// Parse parses a YAML policy, a map of Model names to lists of rules
+func Parse(buf []byte) (*Policy, error) {
+	p := New()
+	err := yaml.Unmarshal(buf, &p.rules)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Load reads a YAML policy from a file
+func Load(filename string) (*Policy, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(buf)
+}
+
+// Add adds rules, written as sentences, for the named Model
+func (p *Policy) Add(model string, rules ...string) error {
+	for _, s := range rules {
+		r, err := ParseRule(s)
+		if err != nil {
+			return err
+		}
+		p.rules[model] = append(p.rules[model], r)
+	}
+	return nil
+}
+
+// matching returns the rules that allow op on m for roles
+func (p *Policy) matching(m crudley.Model, op string, roles []string) []*Rule {
+	var out []*Rule
+	for _, name := range []string{m.GetName(), AnyModel} {
+		for _, r := range p.rules[name] {
+			if r.matches(op, roles) {
+				out = append(out, r)
+			}
+		}
+	}
+	return out
+}
+
+func roles(ctx context.Context, principal crudley.Principal) []string {
+	roles := crudley.RolesFromContext(ctx)
+	if rp, ok := principal.(RolePrincipal); ok {
+		roles = append(append([]string{}, roles...), rp.PrincipalRoles()...)
+	}
+	return roles
+}
+
+// Authorise returns ErrorForbidden unless a rule allows the Action on m. The
+// Model of a Partial Action isn't known, so it is only a pre-check: the parts of
+// a rule's expression that refer to the Model, the previous Model or the changes
+// are assumed to hold, and the Path authorises each Model again in full.
+func (p *Policy) Authorise(ctx context.Context, m crudley.Model, action crudley.Action) error {
+	e := &env{m: m, action: action, roles: roles(ctx, action.Principal)}
+	for _, r := range p.matching(m, action.Op, e.roles) {
+		if r.expr == nil {
+			return nil
+		}
+		var (
+			ok  bool
+			err error
+		)
+		if action.Partial {
+			var known bool
+			ok, known, err = evalPartial(r.expr, e)
+			ok = ok || !known
+		} else {
+			ok, err = evalBool(r.expr, e)
+		}
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+	return ErrorForbidden
+}
+
+// AuthoriseModel implements crudley.ModelAuthoriser
+func (p *Policy) AuthoriseModel(ctx context.Context, m crudley.Model, action crudley.Action) error {
+	return p.Authorise(ctx, m, action)
+}
+
+// AuthoriseModelQuery implements crudley.ModelQueryAuthoriser, adding the
+// comparisons of the rule allowing lists to q. Comparisons that can't be
+// expressed as predicates, or rules combined with others, are left to the
+// Path, which filters the results with Authorise.
+func (p *Policy) AuthoriseModelQuery(ctx context.Context, m crudley.Model, q crudley.Query) error {
+	action := crudley.Action{Method: http.MethodGet, Op: crudley.OpList, Principal: crudley.PrincipalFromContext(ctx)}
+	e := &env{m: m, action: action, roles: roles(ctx, action.Principal)}
+	rules := p.matching(m, action.Op, e.roles)
+	if len(rules) == 0 {
+		return ErrorForbidden
+	}
+	if len(rules) > 1 || rules[0].expr == nil {
+		return nil
+	}
+	return predicates(rules[0].expr, e, q)
+}
+
+// predicates adds the comparisons of n that all allowed Models satisfy to q
+func predicates(n node, e *env, q crudley.Query) error {
+	switch n := n.(type) {
+	case andNode:
+		err := predicates(n.l, e, q)
+		if err != nil {
+			return err
+		}
+		return predicates(n.r, e, q)
+	case cmpNode:
+		op, f, other := n.op, n.l, n.r
+		if _, ok := f.(identNode); !ok || references(other) {
+			op, f, other = flip(op), n.r, n.l
+		}
+		ident, ok := f.(identNode)
+		if !ok || references(other) {
+			return nil
+		}
+		path, ok := ident.modelField()
+		if !ok || len(path) != 1 {
+			return nil
+		}
+		fv, ok := field(reflect.ValueOf(e.m), path)
+		if !ok {
+			return nil
+		}
+		v, err := other.eval(e)
+		if err != nil {
+			return err
+		}
+		v, ok = convert(v, fv.Type())
+		if !ok {
+			return nil
+		}
+		switch op {
+		case "==":
+			q.Equal(path[0], v)
+		case "!=":
+			q.NotEqual(path[0], v)
+		case "<":
+			q.LessThan(path[0], v)
+		case ">":
+			q.GreaterThan(path[0], v)
+		}
+	}
+	return nil
+}
+
+// references returns true if n refers to the Model's fields
+func references(n node) bool {
+	switch n := n.(type) {
+	case identNode:
+		_, ok := n.modelField()
+		return ok
+	case litNode:
+		return false
+	}
+	return true
+}
+
+func flip(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case ">":
+		return "<"
+	case "<=":
+		return ">="
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// convert converts v to the type of a Model field, ok is false if it can't be
+// converted exactly
+func convert(v interface{}, t reflect.Type) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	if t == timeType {
+		switch tv := v.(type) {
+		case time.Time:
+			return tv, true
+		case string:
+			parsed, err := time.Parse(time.RFC3339, tv)
+			return parsed, err == nil
+		}
+		return nil, false
+	}
+	rv := reflect.ValueOf(normalise(v))
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f, ok := rv.Interface().(float64)
+		if !ok || f != float64(int64(f)) {
+			return nil, false
+		}
+		return rv.Convert(t).Interface(), true
+	case reflect.Float32, reflect.Float64:
+		if rv.Kind() != reflect.Float64 {
+			return nil, false
+		}
+		return rv.Convert(t).Interface(), true
+	case reflect.String, reflect.Bool:
+		if rv.Kind() != t.Kind() {
+			return nil, false
+		}
+		return rv.Convert(t).Interface(), true
+	}
+	return nil, false
+}
@@ -0,0 +1,306 @@
+package policy_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/policy"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+type user string
+
+func (u user) PrincipalID() string { return string(u) }
+
+const testPolicy = `
+testmodel:
+  - anyone may get, list where owner == principal.id
+  - anyone may create where owner == principal.id
+  - role=editor may update where owner == principal.id && int_val < 10 && !("owner" in action.changes)
+  - roles: [admin]
+    allow: ["*"]
+`
+
+func TestAuthorise(t *testing.T) {
+	p, err := policy.Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	ctx := context.Background()
+	m := &model.TestModel{ID: "1", Owner: "alice", IntVal: 5}
+	for _, test := range []struct {
+		action   crudley.Action
+		roles    []string
+		expected error
+	}{
+		{crudley.Action{Op: crudley.OpGet, Principal: user("alice")}, nil, nil},
+		{crudley.Action{Op: crudley.OpGet, Principal: user("bob")}, nil, policy.ErrorForbidden},
+		{crudley.Action{Op: crudley.OpGet}, nil, policy.ErrorForbidden},
+		{crudley.Action{Op: crudley.OpList, Principal: user("bob"), Partial: true}, nil, nil},
+		{crudley.Action{Op: crudley.OpUpdate, Principal: user("alice")}, nil, policy.ErrorForbidden},
+		{crudley.Action{Op: crudley.OpUpdate, Principal: user("alice")}, []string{"editor"}, nil},
+		{crudley.Action{Op: crudley.OpUpdate, Principal: user("alice"), Changes: []string{"owner"}}, []string{"editor"}, policy.ErrorForbidden},
+		{crudley.Action{Op: crudley.OpDelete, Principal: user("bob")}, []string{"admin"}, nil},
+	} {
+		err := p.Authorise(crudley.WithRoles(ctx, test.roles), m, test.action)
+		if err != test.expected {
+			t.Errorf("expected %v for %+v %v, got %v", test.expected, test.action, test.roles, err)
+		}
+	}
+}
+
+func TestAuthorisePartial(t *testing.T) {
+	p := policy.New()
+	err := p.Add("testmodel",
+		"anyone may list where !action.include_deleted && owner == principal.id",
+		"role=auditor may list where owner == principal.id || principal.id == \"root\"",
+	)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	ctx := context.Background()
+	for _, test := range []struct {
+		action   crudley.Action
+		roles    []string
+		expected error
+	}{
+		{crudley.Action{Op: crudley.OpList, Principal: user("alice"), Partial: true}, nil, nil},
+		{crudley.Action{Op: crudley.OpList, Principal: user("alice"), Partial: true, IncludeDeleted: true}, nil, policy.ErrorForbidden},
+		{crudley.Action{Op: crudley.OpList, Principal: user("alice"), Partial: true, IncludeDeleted: true}, []string{"auditor"}, nil},
+		{crudley.Action{Op: crudley.OpList, Principal: user("root"), Partial: true, IncludeDeleted: true}, []string{"auditor"}, nil},
+	} {
+		err := p.Authorise(crudley.WithRoles(ctx, test.roles), &model.TestModel{}, test.action)
+		if err != test.expected {
+			t.Errorf("expected %v for %+v %v, got %v", test.expected, test.action, test.roles, err)
+		}
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	r, err := policy.ParseRule("role=editor|admin may update, delete where owner == principal.id")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	expected := policy.Rule{Roles: []string{"editor", "admin"}, Allow: []string{"update", "delete"}, Where: "owner == principal.id"}
+	if !reflect.DeepEqual(r.Roles, expected.Roles) || !reflect.DeepEqual(r.Allow, expected.Allow) || r.Where != expected.Where {
+		t.Errorf("expected %+v, got %+v", expected, r)
+	}
+	for _, rule := range []string{"editors update", "anyone may get where owner ==", "anyone may get where (a == 1"} {
+		if _, err := policy.ParseRule(rule); err == nil {
+			t.Errorf("expected an error for %q", rule)
+		}
+	}
+}
+
+type query struct {
+	crudley.Query
+	predicates []string
+}
+
+func (q *query) Equal(key string, val interface{}) {
+	q.predicates = append(q.predicates, fmt.Sprintf("%s == %#v", key, val))
+}
+
+func (q *query) LessThan(key string, val interface{}) {
+	q.predicates = append(q.predicates, fmt.Sprintf("%s < %#v", key, val))
+}
+
+func (q *query) GreaterThan(key string, val interface{}) {
+	q.predicates = append(q.predicates, fmt.Sprintf("%s > %#v", key, val))
+}
+
+func TestAuthoriseModelQuery(t *testing.T) {
+	p := policy.New()
+	err := p.Add("testmodel",
+		"anyone may list where owner == principal.id && 3 > int_val && int_val <= 2.5 && int_val > 1.5",
+		"role=auditor may list",
+	)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	ctx := crudley.WithPrincipal(context.Background(), user("alice"))
+
+	q := &query{}
+	err = p.AuthoriseModelQuery(ctx, &model.TestModel{}, q)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	expected := []string{`owner == "alice"`, `int_val < 3`}
+	if !reflect.DeepEqual(q.predicates, expected) {
+		t.Errorf("expected %v, got %v", expected, q.predicates)
+	}
+
+	q = &query{}
+	err = p.AuthoriseModelQuery(crudley.WithRoles(ctx, []string{"auditor"}), &model.TestModel{}, q)
+	if err != nil || len(q.predicates) != 0 {
+		t.Errorf("expected no predicates, got %v, %v", q.predicates, err)
+	}
+
+	p = policy.New()
+	err = p.AuthoriseModelQuery(ctx, &model.TestModel{}, &query{})
+	if err != policy.ErrorForbidden {
+		t.Errorf("expected %s, got %v", policy.ErrorForbidden, err)
+	}
+}
+
+func TestPolicyPath(t *testing.T) {
+	pol, err := policy.Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore(),
+		crudley.OptionAuthoriser(pol),
+		crudley.OptionPrincipal(func(r *http.Request) (crudley.Principal, error) {
+			return user(r.Header.Get("X-User")), nil
+		}),
+		crudley.OptionRoles(func(r *http.Request) []string {
+			return r.Header["X-Role"]
+		}),
+	)
+	api := httptest.NewServer(http.StripPrefix("/api/test", p))
+	defer api.Close()
+
+	do := func(method, path, u, role, body string) (int, []*model.TestModel) {
+		req, err := http.NewRequest(method, api.URL+"/api/test/"+path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		req.Header.Set("X-User", u)
+		if role != "" {
+			req.Header.Set("X-Role", role)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		defer res.Body.Close()
+		var tmr model.TestModelResponse
+		json.NewDecoder(res.Body).Decode(&tmr)
+		return res.StatusCode, tmr.Results
+	}
+
+	code, _ := do("POST", "", "alice", "", `{"owner": "bob"}`)
+	if code == http.StatusOK {
+		t.Errorf("expected alice not to create bob's model")
+	}
+	var ids = map[string]string{}
+	for _, u := range []string{"alice", "bob"} {
+		code, res := do("POST", "", u, "", fmt.Sprintf(`{"owner": %q}`, u))
+		if code != http.StatusOK || len(res) != 1 {
+			t.Fatalf("expected %s's model, got %v %v", u, code, res)
+		}
+		ids[u] = res[0].ID
+	}
+
+	code, res := do("GET", "", "alice", "", "")
+	if code != http.StatusOK || len(res) != 1 || res[0].Owner != "alice" {
+		t.Errorf("expected only alice's model, got %v %+v", code, res)
+	}
+	code, res = do("GET", "", "carol", "admin", "")
+	if code != http.StatusOK || len(res) != 2 {
+		t.Errorf("expected both models for admin, got %v %+v", code, res)
+	}
+	code, _ = do("GET", ids["bob"], "alice", "", "")
+	if code != http.StatusNotFound {
+		t.Errorf("expected 404, got %v", code)
+	}
+
+	code, _ = do("PUT", ids["alice"], "alice", "", `{"int_val": 1}`)
+	if code == http.StatusOK {
+		t.Errorf("expected alice to need the editor role")
+	}
+	code, res = do("PUT", ids["alice"], "alice", "editor", `{"int_val": 1}`)
+	if code != http.StatusOK || len(res) != 1 || res[0].IntVal != 1 {
+		t.Errorf("expected update, got %v %+v", code, res)
+	}
+	code, _ = do("PUT", ids["alice"], "alice", "editor", `{"owner": "bob"}`)
+	if code == http.StatusOK {
+		t.Errorf("expected alice not to change the owner")
+	}
+}
+
+// note is a Model without an Authorise method, so it is only authorised by the
+// Path's Policy
+type note struct {
+	ID      string `json:"id" rest:"immutable"`
+	Owner   string `json:"owner"`
+	Text    string `json:"text"`
+	Deleted bool   `json:"deleted"`
+}
+
+func (n *note) New(id string) crudley.Model { return &note{ID: id} }
+func (n *note) PrimaryKey() string          { return n.ID }
+func (n *note) GetName() string             { return "note" }
+func (n *note) Delete()                     { n.Deleted = true }
+func (n *note) IsDeleted() bool             { return n.Deleted }
+
+func TestPolicyPathChanges(t *testing.T) {
+	pol := policy.New()
+	err := pol.Add("note",
+		"anyone may create, get where owner == principal.id",
+		"role=user may update where owner == principal.id && !(\"owner\" in action.changes) && previous.text != \"locked\"",
+	)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	p := crudley.NewPath(&note{}, mem.NewStore(),
+		crudley.OptionAuthoriser(pol),
+		crudley.OptionPrincipal(func(r *http.Request) (crudley.Principal, error) {
+			return user(r.Header.Get("X-User")), nil
+		}),
+		crudley.OptionRoles(func(r *http.Request) []string {
+			return []string{"user"}
+		}),
+	)
+	api := httptest.NewServer(p)
+	defer api.Close()
+
+	do := func(method, path, body string) (int, []note) {
+		req, err := http.NewRequest(method, api.URL+"/"+path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		req.Header.Set("X-User", "alice")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		defer res.Body.Close()
+		var out struct {
+			Results []note `json:"results"`
+		}
+		json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out.Results
+	}
+
+	code, res := do("POST", "", `{"owner": "alice"}`)
+	if code != http.StatusOK || len(res) != 1 {
+		t.Fatalf("expected alice's note, got %v %v", code, res)
+	}
+	id := res[0].ID
+
+	code, _ = do("PUT", id, `{"owner": "bob"}`)
+	if code != http.StatusUnauthorized {
+		t.Errorf("expected alice not to change the owner, got %v", code)
+	}
+	code, _ = do("PUT", id, `{"text": "locked"}`)
+	if code != http.StatusOK {
+		t.Errorf("expected update, got %v", code)
+	}
+	code, _ = do("PUT", id, `{"text": "unlocked"}`)
+	if code != http.StatusUnauthorized {
+		t.Errorf("expected a locked note not to be updated, got %v", code)
+	}
+	code, res = do("GET", id, "")
+	if code != http.StatusOK || len(res) != 1 || res[0].Owner != "alice" || res[0].Text != "locked" {
+		t.Errorf("expected alice's locked note, got %v %+v", code, res)
+	}
+}
@@ -0,0 +1,121 @@
+package crudley
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+// Principal is the authenticated user making a request
+type Principal interface {
+	PrincipalID() string
+}
+
+// PrincipalResolver extracts the Principal from a request, requests for which it
+// returns an error are rejected
+type PrincipalResolver func(r *http.Request) (Principal, error)
+
+type principalKey struct{}
+
+// WithPrincipal returns a context for requests made by p
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the Principal set with WithPrincipal, or nil
+func PrincipalFromContext(ctx context.Context) Principal {
+	p, _ := ctx.Value(principalKey{}).(Principal)
+	return p
+}
+
+// OptionPrincipal sets the PrincipalResolver for the Path, the Principal is
+// available to Authorisers in Action.Principal and with PrincipalFromContext
+func OptionPrincipal(fn PrincipalResolver) Option {
+	return func(p *Path) {
+		p.Principal = fn
+	}
+}
+
+// OptionAuthoriser authorises every Action on the Path's Models with a, as well
+// as with the Models' own Authorisers
+func OptionAuthoriser(a ModelAuthoriser) Option {
+	return func(p *Path) {
+		p.Authoriser = a
+	}
+}
+
+type requestKey struct{}
+
+type authoriserKey struct{}
+
+// authorise runs the Path's ModelAuthoriser and the Model's Authoriser, filling
+// in the Action's Request and Principal from ctx
+func authorise(ctx context.Context, m Model, a Action) error {
+	if a.Request == nil {
+		a.Request, _ = ctx.Value(requestKey{}).(*http.Request)
+	}
+	a.Principal = PrincipalFromContext(ctx)
+	if ma, ok := ctx.Value(authoriserKey{}).(ModelAuthoriser); ok {
+		if err := ma.AuthoriseModel(ctx, m, a); err != nil {
+			return err
+		}
+	}
+	if az, ok := m.(Authoriser); ok {
+		return az.Authorise(ctx, a)
+	}
+	return nil
+}
+
+// hasAuthoriser reports whether authorise would run any Authoriser for m, so
+// that callers can skip building Actions nothing will check
+func hasAuthoriser(ctx context.Context, m Model) bool {
+	if _, ok := ctx.Value(authoriserKey{}).(ModelAuthoriser); ok {
+		return true
+	}
+	_, ok := m.(Authoriser)
+	return ok
+}
+
+// copyModel returns a deep copy of m made by serializing it
+func copyModel(m Model) (Model, error) {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	out := m.New(m.PrimaryKey())
+	return out, json.Unmarshal(buf, out)
+}
+
+// changedFields returns the json names of the top level fields that differ
+// between a and b
+func changedFields(a, b Model) ([]string, error) {
+	var am, bm map[string]interface{}
+	for _, v := range []struct {
+		m   Model
+		out *map[string]interface{}
+	}{{a, &am}, {b, &bm}} {
+		buf, err := json.Marshal(v.m)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(buf, v.out)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var changes []string
+	for k, v := range bm {
+		if !reflect.DeepEqual(am[k], v) {
+			changes = append(changes, k)
+		}
+	}
+	for k := range am {
+		if _, ok := bm[k]; !ok {
+			changes = append(changes, k)
+		}
+	}
+	sort.Strings(changes)
+	return changes, nil
+}
@@ -0,0 +1,98 @@
+package crudley_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+type user string
+
+func (u user) PrincipalID() string { return string(u) }
+
+func TestActionPrincipal(t *testing.T) {
+	var actions []crudley.Action
+	model.AuthoriseFunc = func(ctx context.Context, action crudley.Action, m *model.TestModel) error {
+		// skip the partial models built from query parameters
+		if m.ID != "" || action.Op != crudley.OpList {
+			actions = append(actions, action)
+		}
+		return nil
+	}
+	defer func() { model.AuthoriseFunc = nil }()
+
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore(), crudley.OptionPrincipal(func(r *http.Request) (crudley.Principal, error) {
+		u := r.Header.Get("X-User")
+		if u == "" {
+			return nil, errors.New("no user")
+		}
+		return user(u), nil
+	}))
+	s := httptest.NewServer(http.StripPrefix("/api/test", p))
+	defer s.Close()
+
+	do := func(method, path, body string) model.TestModelResponse {
+		req, err := http.NewRequest(method, s.URL+"/api/test/"+path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		req.Header.Set("X-User", "alice")
+		tmr, _, err := doRequest(req)
+		if err != nil {
+			t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+		}
+		return tmr
+	}
+
+	res, err := http.Get(s.URL + "/api/test/")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %v", res.StatusCode)
+	}
+
+	tmr := do("POST", "", `{"string_val": "foo", "int_val": 1}`)
+	id := tmr.Results[0].ID
+	do("GET", "", "")
+	do("GET", id, "")
+	do("PUT", id, `{"string_val": "bar", "int_val": 1}`)
+	do("DELETE", id, "")
+	do("POST", id+"/_restore", "")
+	do("POST", "_batch", fmt.Sprintf(`{"operations": [{"op": "delete", "id": "%s"}]}`, id))
+
+	var ops []string
+	for _, a := range actions {
+		ops = append(ops, a.Op)
+		if a.Principal == nil || a.Principal.PrincipalID() != "alice" {
+			t.Errorf("expected alice for %s, got %v", a.Op, a.Principal)
+		}
+	}
+	expected := []string{
+		crudley.OpCreate, crudley.OpList, crudley.OpGet, crudley.OpUpdate, crudley.OpUpdate,
+		crudley.OpDelete, crudley.OpRestore, crudley.OpBatch, crudley.OpDelete,
+	}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Fatalf("expected %v, got %v", expected, ops)
+	}
+	if actions[2].Request == nil || actions[2].Request.Method != http.MethodGet {
+		t.Errorf("expected the GET request, got %v", actions[2].Request)
+	}
+	update := actions[4]
+	if !reflect.DeepEqual(update.Changes, []string{"string_val"}) {
+		t.Errorf("expected string_val to change, got %v", update.Changes)
+	}
+	if prev, ok := update.Previous.(*model.TestModel); !ok || prev.StringVal != "foo" {
+		t.Errorf("expected previous foo, got %v", update.Previous)
+	}
+}
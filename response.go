@@ -7,9 +7,11 @@ import (
 
 // Response is the container for all output of the REST handlers
 type Response struct {
-	Results  []Model `json:"results,omitempty"`
-	Error   string `json:"error,omitempty"`
-	code int
+	Results []Model       `json:"results,omitempty"`
+	Batch   []BatchResult `json:"batch,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	code    int
+	roles   []string
 }
 
 // SetStatusCode sets the http status code for the request
@@ -30,6 +32,11 @@ func (r *Response) AddModel(models ...Model) {
 	r.Results = append(r.Results, models...)
 }
 
+// AddBatchResult adds the outcome of batch operations to the Response
+func (r *Response) AddBatchResult(results ...BatchResult) {
+	r.Batch = append(r.Batch, results...)
+}
+
 // AddError adds errors to the response
 func (r *Response) AddError(errors ...error) {
 	for _, err := range errors {
@@ -42,8 +49,20 @@ func (r *Response) AddError(errors ...error) {
 
 // ResponseMiddleware handles writing the api response format to the http.ResponseWriter
 func WriteResponse(w http.ResponseWriter, res *Response) {
+	// fields the user can't read are omitted from the output
+	out := *res
+	out.Results = make([]Model, len(res.Results))
+	for i, m := range res.Results {
+		out.Results[i] = redact(m, res.roles)
+	}
+	out.Batch = make([]BatchResult, len(res.Batch))
+	for i, b := range res.Batch {
+		b.Result = redact(b.Result, res.roles)
+		out.Batch[i] = b
+	}
+
 	// output response
-	buf, err := json.Marshal(res)
+	buf, err := json.Marshal(&out)
 	if err != nil {
 		http.Error(w, "could not output response: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,68 @@
+package crudley
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Router serves the routes of a Path. Route patterns are paths with parameters
+// in braces, such as /{id}/_history/{rev}, which handlers read with the Path's
+// ParamFunc. The routers subpackages adapt other routers to Router.
+type Router interface {
+	http.Handler
+	// Handle routes requests with the method and a path matching the pattern
+	// to h
+	Handle(method, pattern string, h http.Handler)
+}
+
+// ParamFunc returns the named parameter of the route matching the request, or
+// "" if it is not set
+type ParamFunc func(r *http.Request, name string) string
+
+// PathValue is the default ParamFunc, returning the parameters set by a
+// ServeMux or by other routers calling http.Request.SetPathValue
+func PathValue(r *http.Request, name string) string {
+	return r.PathValue(name)
+}
+
+// OptionRouter serves the Path's routes with r rather than a ServeMuxRouter
+func OptionRouter(r Router) Option {
+	return func(p *Path) {
+		p.Router = r
+	}
+}
+
+// OptionParams sets the function reading route parameters, such as the ID, from
+// requests. Setting it to the function of the router the Path's handlers are
+// served by, such as chi.URLParam, allows them to be used as that router's
+// handlers directly.
+func OptionParams(fn ParamFunc) Option {
+	return func(p *Path) {
+		p.Params = fn
+	}
+}
+
+// ServeMuxRouter is the default Router, an http.ServeMux using method and
+// wildcard patterns
+type ServeMuxRouter struct {
+	mux *http.ServeMux
+}
+
+// NewServeMuxRouter returns an empty ServeMuxRouter
+func NewServeMuxRouter() *ServeMuxRouter {
+	return &ServeMuxRouter{mux: http.NewServeMux()}
+}
+
+// Handle registers h for the method and pattern, patterns ending in a slash
+// match only that path rather than all paths beneath it
+func (r *ServeMuxRouter) Handle(method, pattern string, h http.Handler) {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "{$}"
+	}
+	r.mux.Handle(method+" "+pattern, h)
+}
+
+// ServeHTTP implements http.Handler
+func (r *ServeMuxRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.ServeHTTP(w, req)
+}
@@ -0,0 +1,12 @@
+package crudley_test
+
+import (
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/testutil/router"
+)
+
+func TestServeMuxRouter(t *testing.T) {
+	router.TestRouter(crudley.OptionRouter(crudley.NewServeMuxRouter()), t)
+}
@@ -0,0 +1,48 @@
+// Package chirouter serves crudley Paths with a chi Router:
+//
+//	p := crudley.NewPath(&Incident{}, s, chirouter.OptionRouter)
+//
+// Paths using Param can have their handlers routed by chi directly:
+//
+//	p := crudley.NewPath(&Incident{}, s, crudley.OptionParams(chirouter.Param))
+//	r.Get("/incidents/{id}", p.Get)
+package chirouter
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/arussellsaw/crudley"
+)
+
+// Router is a crudley.Router backed by a chi.Mux
+type Router struct {
+	r *chi.Mux
+}
+
+// NewRouter returns an empty Router
+func NewRouter() *Router {
+	return &Router{r: chi.NewRouter()}
+}
+
+// Handle registers h for the method and pattern
+func (r *Router) Handle(method, pattern string, h http.Handler) {
+	r.r.Method(method, pattern, h)
+}
+
+// ServeHTTP implements http.Handler
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.r.ServeHTTP(w, req)
+}
+
+// Param is a crudley.ParamFunc returning chi.URLParam
+func Param(r *http.Request, name string) string {
+	return chi.URLParam(r, name)
+}
+
+// OptionRouter serves a Path's routes with a Router
+func OptionRouter(p *crudley.Path) {
+	crudley.OptionRouter(NewRouter())(p)
+	crudley.OptionParams(Param)(p)
+}
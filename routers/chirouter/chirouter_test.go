@@ -0,0 +1,40 @@
+package chirouter_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/client"
+	"github.com/arussellsaw/crudley/routers/chirouter"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+	"github.com/arussellsaw/crudley/testutil/router"
+)
+
+func TestRouter(t *testing.T) {
+	router.TestRouter(chirouter.OptionRouter, t)
+}
+
+func TestHandlers(t *testing.T) {
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore(), crudley.OptionParams(chirouter.Param))
+	r := chi.NewRouter()
+	r.Post("/tests/", p.Post)
+	r.Get("/tests/{id}", p.Get)
+	s := httptest.NewServer(r)
+	defer s.Close()
+	ctx := context.Background()
+	tests := client.NewCollection[*model.TestModel](client.New(s.URL), "/tests")
+
+	m, err := tests.Create(ctx, &model.TestModel{StringVal: "chi"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	got, err := tests.Get(ctx, m.ID)
+	if err != nil || got.StringVal != "chi" {
+		t.Errorf("expected chi, got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,14 @@
+module github.com/arussellsaw/crudley/routers/chirouter
+
+go 1.22
+
+require (
+	github.com/arussellsaw/crudley v0.0.0-20261018195425-34b8988ec0f1
+	github.com/go-chi/chi/v5 v5.0.12
+)
+
+require (
+	github.com/fatih/structs v1.1.0 // indirect
+	github.com/google/uuid v1.1.2 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
+)
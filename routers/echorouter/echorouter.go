@@ -0,0 +1,72 @@
+// Package echorouter serves crudley Paths with an echo Router:
+//
+//	p := crudley.NewPath(&Incident{}, s, echorouter.OptionRouter)
+//
+// Path handlers can be routed by echo directly with Handler, which sets the
+// route's parameters on the request for crudley.PathValue:
+//
+//	e.GET("/incidents/:id", echorouter.Handler(http.HandlerFunc(p.Get)))
+package echorouter
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/arussellsaw/crudley"
+)
+
+// Router is a crudley.Router backed by an echo.Echo
+type Router struct {
+	e *echo.Echo
+}
+
+// NewRouter returns an empty Router
+func NewRouter() *Router {
+	return &Router{e: echo.New()}
+}
+
+// Handle registers h for the method and pattern
+func (r *Router) Handle(method, pattern string, h http.Handler) {
+	r.e.Add(method, Pattern(pattern), Handler(h))
+}
+
+// ServeHTTP implements http.Handler
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.e.ServeHTTP(w, req)
+}
+
+// Pattern converts a crudley route pattern to echo's syntax, so /{id} becomes
+// /:id
+func Pattern(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			segments[i] = ":" + s[1:len(s)-1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Handler adapts h to an echo.HandlerFunc, setting the route's parameters on
+// the request so that they are returned by crudley.PathValue
+func Handler(h http.Handler) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		values := c.ParamValues()
+		for i, name := range c.ParamNames() {
+			if i < len(values) {
+				req.SetPathValue(name, values[i])
+			}
+		}
+		h.ServeHTTP(c.Response(), req)
+		return nil
+	}
+}
+
+// OptionRouter serves a Path's routes with a Router
+func OptionRouter(p *crudley.Path) {
+	crudley.OptionRouter(NewRouter())(p)
+	crudley.OptionParams(crudley.PathValue)(p)
+}
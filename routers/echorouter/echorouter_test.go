@@ -0,0 +1,47 @@
+package echorouter_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/client"
+	"github.com/arussellsaw/crudley/routers/echorouter"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+	"github.com/arussellsaw/crudley/testutil/router"
+)
+
+func TestRouter(t *testing.T) {
+	router.TestRouter(echorouter.OptionRouter, t)
+}
+
+func TestHandlers(t *testing.T) {
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore())
+	r := echo.New()
+	r.POST("/tests/", echorouter.Handler(http.HandlerFunc(p.Post)))
+	r.GET("/tests/:id", echorouter.Handler(http.HandlerFunc(p.Get)))
+	s := httptest.NewServer(r)
+	defer s.Close()
+	ctx := context.Background()
+	tests := client.NewCollection[*model.TestModel](client.New(s.URL), "/tests")
+
+	m, err := tests.Create(ctx, &model.TestModel{StringVal: "echo"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	got, err := tests.Get(ctx, m.ID)
+	if err != nil || got.StringVal != "echo" {
+		t.Errorf("expected echo, got %+v, %v", got, err)
+	}
+}
+
+func TestPattern(t *testing.T) {
+	if p := echorouter.Pattern("/{id}/_history/{rev}"); p != "/:id/_history/:rev" {
+		t.Errorf("expected /:id/_history/:rev, got %s", p)
+	}
+}
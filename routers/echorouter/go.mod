@@ -0,0 +1,23 @@
+module github.com/arussellsaw/crudley/routers/echorouter
+
+go 1.22
+
+require (
+	github.com/arussellsaw/crudley v0.0.0-20261018195425-34b8988ec0f1
+	github.com/labstack/echo/v4 v4.11.4
+)
+
+require (
+	github.com/fatih/structs v1.1.0 // indirect
+	github.com/google/uuid v1.1.2 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/labstack/gommon v0.4.2 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasttemplate v1.2.2 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/net v0.19.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+)
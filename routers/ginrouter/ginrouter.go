@@ -0,0 +1,70 @@
+// Package ginrouter serves crudley Paths with a gin Engine:
+//
+//	p := crudley.NewPath(&Incident{}, s, ginrouter.OptionRouter)
+//
+// Path handlers can be routed by gin directly with Handler, which sets the
+// route's parameters on the request for crudley.PathValue:
+//
+//	r.GET("/incidents/:id", ginrouter.Handler(http.HandlerFunc(p.Get)))
+package ginrouter
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/arussellsaw/crudley"
+)
+
+// Router is a crudley.Router backed by a gin.Engine
+type Router struct {
+	e *gin.Engine
+}
+
+// NewRouter returns an empty Router, which responds 405 to requests for a
+// route with a different method
+func NewRouter() *Router {
+	e := gin.New()
+	e.HandleMethodNotAllowed = true
+	return &Router{e: e}
+}
+
+// Handle registers h for the method and pattern
+func (r *Router) Handle(method, pattern string, h http.Handler) {
+	r.e.Handle(method, Pattern(pattern), Handler(h))
+}
+
+// ServeHTTP implements http.Handler
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.e.ServeHTTP(w, req)
+}
+
+// Pattern converts a crudley route pattern to gin's syntax, so /{id} becomes
+// /:id
+func Pattern(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			segments[i] = ":" + s[1:len(s)-1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Handler adapts h to a gin.HandlerFunc, setting the route's parameters on the
+// request so that they are returned by crudley.PathValue
+func Handler(h http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, p := range c.Params {
+			c.Request.SetPathValue(p.Key, p.Value)
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// OptionRouter serves a Path's routes with a Router
+func OptionRouter(p *crudley.Path) {
+	crudley.OptionRouter(NewRouter())(p)
+	crudley.OptionParams(crudley.PathValue)(p)
+}
@@ -0,0 +1,49 @@
+package ginrouter_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/client"
+	"github.com/arussellsaw/crudley/routers/ginrouter"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+	"github.com/arussellsaw/crudley/testutil/router"
+)
+
+func TestRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router.TestRouter(ginrouter.OptionRouter, t)
+}
+
+func TestHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore())
+	r := gin.New()
+	r.POST("/tests/", ginrouter.Handler(http.HandlerFunc(p.Post)))
+	r.GET("/tests/:id", ginrouter.Handler(http.HandlerFunc(p.Get)))
+	s := httptest.NewServer(r)
+	defer s.Close()
+	ctx := context.Background()
+	tests := client.NewCollection[*model.TestModel](client.New(s.URL), "/tests")
+
+	m, err := tests.Create(ctx, &model.TestModel{StringVal: "gin"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	got, err := tests.Get(ctx, m.ID)
+	if err != nil || got.StringVal != "gin" {
+		t.Errorf("expected gin, got %+v, %v", got, err)
+	}
+}
+
+func TestPattern(t *testing.T) {
+	if p := ginrouter.Pattern("/{id}/_history/{rev}"); p != "/:id/_history/:rev" {
+		t.Errorf("expected /:id/_history/:rev, got %s", p)
+	}
+}
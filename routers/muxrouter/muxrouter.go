@@ -0,0 +1,53 @@
+// Package muxrouter serves crudley Paths with a gorilla/mux Router:
+//
+//	p := crudley.NewPath(&Incident{}, s, muxrouter.OptionRouter)
+package muxrouter
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/arussellsaw/crudley"
+)
+
+// Router is a crudley.Router backed by a mux.Router
+type Router struct {
+	r *mux.Router
+}
+
+// NewRouter returns an empty Router
+func NewRouter() *Router {
+	return &Router{r: mux.NewRouter()}
+}
+
+// Handle registers h for the method and pattern
+func (r *Router) Handle(method, pattern string, h http.Handler) {
+	r.r.Path(pattern).Methods(method).Handler(h)
+}
+
+// ServeHTTP implements http.Handler
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.r.ServeHTTP(w, req)
+}
+
+// Param is a crudley.ParamFunc returning mux.Vars
+func Param(r *http.Request, name string) string {
+	return mux.Vars(r)[name]
+}
+
+// OptionRouter serves a Path's routes with a Router
+func OptionRouter(p *crudley.Path) {
+	crudley.OptionRouter(NewRouter())(p)
+	crudley.OptionParams(Param)(p)
+}
+
+// MountAPI serves the API from r under the API's prefix
+func MountAPI(r *mux.Router, a *crudley.API) {
+	root := strings.TrimSuffix(a.Prefix, "/")
+	if root != "" {
+		r.Path(root).Handler(a)
+	}
+	r.PathPrefix(root + "/").Handler(a)
+}
@@ -0,0 +1,58 @@
+package muxrouter_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/routers/muxrouter"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+	"github.com/arussellsaw/crudley/testutil/router"
+)
+
+func TestRouter(t *testing.T) {
+	router.TestRouter(muxrouter.OptionRouter, t)
+}
+
+func TestMountAPI(t *testing.T) {
+	api := crudley.NewAPI("/api/")
+	api.Register(&model.TestModel{}, mem.NewStore())
+	r := mux.NewRouter()
+	muxrouter.MountAPI(r, api)
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	res, err := http.Post(s.URL+"/api/testmodel/", "application/json", strings.NewReader(`{"string_val": "mounted"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	var out model.TestModelResponse
+	json.NewDecoder(res.Body).Decode(&out)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || len(out.Results) != 1 {
+		t.Fatalf("expected 200, got %v %s", res.StatusCode, out.Error)
+	}
+
+	for path, code := range map[string]int{
+		"/api":                                http.StatusOK,
+		"/api/":                               http.StatusOK,
+		"/api/testmodel/" + out.Results[0].ID: http.StatusOK,
+		"/api/unknown/":                       http.StatusNotFound,
+		"/other/":                             http.StatusNotFound,
+	} {
+		res, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != code {
+			t.Errorf("expected %v for %s, got %v", code, path, res.StatusCode)
+		}
+	}
+}
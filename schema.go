@@ -0,0 +1,454 @@
+package crudley
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// SchemaDialect is the JSON Schema draft that schemas are generated for, which
+// is also the dialect used by OpenAPI 3.1
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// SchemaType is the type, or types, of a Schema
+type SchemaType []string
+
+// MarshalJSON encodes a single type as a string, and several as a list
+func (t SchemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON decodes a type from either a string or a list
+func (t *SchemaType) UnmarshalJSON(buf []byte) error {
+	var s string
+	if err := json.Unmarshal(buf, &s); err == nil {
+		*t = SchemaType{s}
+		return nil
+	}
+	return json.Unmarshal(buf, (*[]string)(t))
+}
+
+// Schema is a JSON Schema
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 SchemaType         `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+	WriteOnly            bool               `json:"writeOnly,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+
+	// pattern is Pattern compiled by ModelSchema
+	pattern *regexp.Regexp
+}
+
+// Constraints on the values of fields, set with the validate struct tag, which
+// appear in the Model's Schema and are checked for request bodies. Several can be
+// combined, separated by commas, e.g. validate:"required,max=64".
+const (
+	structTagValidate = "validate"
+	// validateRequired fields must be set when a Model is created
+	validateRequired = "required"
+	// validateMin is the minimum of a number, or length of a string or list
+	validateMin = "min="
+	// validateMax is the maximum of a number, or length of a string or list
+	validateMax = "max="
+	// validatePattern is a regular expression strings must match, and so can't
+	// contain commas
+	validatePattern = "pattern="
+	// validateEnum is the allowed values, separated by |
+	validateEnum = "enum="
+	// validateFormat is the format of a string, formats checked are date-time,
+	// email, uri and uuid
+	validateFormat = "format="
+)
+
+// ModelSchema returns the JSON Schema of m's type, using the names of its json
+// tags. Fields tagged immutable or readonly are readOnly, writeonly fields are
+// writeOnly and private fields are left out. It panics if a validate tag has an
+// invalid pattern, so a Model with one fails in NewPath rather than on requests.
+func ModelSchema(m Model) *Schema {
+	t, _ := structType(m)
+	s := typeSchema(t, nil)
+	s.Schema = SchemaDialect
+	s.Title = m.GetName()
+	return s
+}
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	marshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// typeSchema returns the schema of values of t, seen is the struct types being
+// described, so recursive types end with an empty schema
+func typeSchema(t reflect.Type, seen []reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+	s := &Schema{}
+	switch {
+	case t == timeType:
+		s.Type, s.Format = SchemaType{"string"}, "date-time"
+	case t == rawMessageType, t.Implements(marshalerType), reflect.PtrTo(t).Implements(marshalerType):
+		// the encoding is up to the type
+		return s
+	}
+	if s.Type == nil {
+		switch t.Kind() {
+		case reflect.String:
+			s.Type = SchemaType{"string"}
+		case reflect.Bool:
+			s.Type = SchemaType{"boolean"}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			s.Type = SchemaType{"integer"}
+		case reflect.Float32, reflect.Float64:
+			s.Type = SchemaType{"number"}
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 {
+				s.Type, s.Format = SchemaType{"string"}, "byte"
+				break
+			}
+			s.Type, s.Items = SchemaType{"array"}, typeSchema(t.Elem(), seen)
+			nullable = nullable || t.Kind() == reflect.Slice
+		case reflect.Map:
+			s.Type, s.AdditionalProperties = SchemaType{"object"}, typeSchema(t.Elem(), seen)
+			nullable = true
+		case reflect.Struct:
+			for _, st := range seen {
+				if st == t {
+					return &Schema{}
+				}
+			}
+			s.Type, s.Properties = SchemaType{"object"}, make(map[string]*Schema)
+			structSchema(t, s, append(seen, t))
+		default:
+			// interfaces can hold anything
+			return s
+		}
+	}
+	if nullable {
+		s.Type = append(s.Type, "null")
+	}
+	return s
+}
+
+func structSchema(t reflect.Type, s *Schema, seen []reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			// embedded structs are flattened by encoding/json
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				structSchema(ft, s, seen)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		perm, _ := parseFieldPerm(f.Tag.Get(structTagRest))
+		if !perm.readable && !perm.writable {
+			continue
+		}
+		fs := typeSchema(f.Type, seen)
+		fs.ReadOnly, fs.WriteOnly = !perm.writable, !perm.readable
+		if constrain(fs, f.Tag.Get(structTagValidate)) && perm.writable {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fs
+	}
+}
+
+// constrain adds the constraints of a validate tag to s, returning true if the
+// field is required
+func constrain(s *Schema, tag string) bool {
+	required := false
+	if tag == "" {
+		return required
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		switch {
+		case opt == validateRequired:
+			required = true
+		case strings.HasPrefix(opt, validateMin), strings.HasPrefix(opt, validateMax):
+			n, err := strconv.ParseFloat(opt[4:], 64)
+			if err != nil {
+				continue
+			}
+			i := int(n)
+			isMin := strings.HasPrefix(opt, validateMin)
+			switch {
+			case s.is("string") && isMin:
+				s.MinLength = &i
+			case s.is("string"):
+				s.MaxLength = &i
+			case s.is("array") && isMin:
+				s.MinItems = &i
+			case s.is("array"):
+				s.MaxItems = &i
+			case isMin:
+				s.Minimum = &n
+			default:
+				s.Maximum = &n
+			}
+		case strings.HasPrefix(opt, validatePattern):
+			s.Pattern = strings.TrimPrefix(opt, validatePattern)
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				panic(fmt.Sprintf("crudley: invalid validate pattern %q: %s", s.Pattern, err))
+			}
+			s.pattern = re
+		case strings.HasPrefix(opt, validateEnum):
+			for _, v := range strings.Split(strings.TrimPrefix(opt, validateEnum), "|") {
+				if s.is("integer") || s.is("number") {
+					if n, err := strconv.ParseFloat(v, 64); err == nil {
+						s.Enum = append(s.Enum, n)
+						continue
+					}
+				}
+				s.Enum = append(s.Enum, v)
+			}
+		case strings.HasPrefix(opt, validateFormat):
+			s.Format = strings.TrimPrefix(opt, validateFormat)
+		}
+	}
+	return required
+}
+
+// Schema is the http handler serving the JSON Schema of the Path's Model
+func (p *Path) Schema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	json.NewEncoder(w).Encode(p.schema)
+}
+
+func (s *Schema) is(typ string) bool {
+	for _, t := range s.Type {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidationError lists the ways a value doesn't match a Schema
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return ErrorValidationFailed.Error() + ": " + strings.Join(e, ", ")
+}
+
+// ValidateJSON checks the JSON in buf against the Schema. If partial is set the
+// Required properties may be missing, as they are for updates.
+func (s *Schema) ValidateJSON(buf []byte, partial bool) error {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return ErrorMalformedJSON
+	}
+	var errs ValidationError
+	s.validate("", v, partial, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// patternCache holds the patterns of Schemas not made by ModelSchema, such as
+// unmarshalled ones
+var patternCache sync.Map
+
+// compiledPattern returns the Schema's Pattern compiled, Schemas not made by
+// ModelSchema have theirs compiled when it is first used
+func (s *Schema) compiledPattern() (*regexp.Regexp, error) {
+	if s.pattern != nil {
+		return s.pattern, nil
+	}
+	if re, ok := patternCache.Load(s.Pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(s.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(s.Pattern, re)
+	return re, nil
+}
+
+func (s *Schema) validate(path string, v interface{}, partial bool, errs *ValidationError) {
+	fail := func(format string, args ...interface{}) {
+		name := path
+		if name == "" {
+			name = "body"
+		}
+		*errs = append(*errs, name+" "+fmt.Sprintf(format, args...))
+	}
+	typ := jsonType(v)
+	if len(s.Type) > 0 && !s.is(typ) && !(typ == "integer" && s.is("number")) {
+		fail("must be %s", strings.Join(s.Type, " or "))
+		return
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+			}
+		}
+		if !found {
+			fail("must be one of %v", s.Enum)
+		}
+	}
+	switch v := v.(type) {
+	case json.Number:
+		n, _ := v.Float64()
+		if s.Minimum != nil && n < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			fail("must be at most %v", *s.Maximum)
+		}
+	case string:
+		l := utf8.RuneCountInString(v)
+		if s.MinLength != nil && l < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && l > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			re, err := s.compiledPattern()
+			if err != nil {
+				fail("has an invalid pattern %s", s.Pattern)
+				return
+			}
+			if !re.MatchString(v) {
+				fail("must match %s", s.Pattern)
+			}
+		}
+		if !validFormat(s.Format, v) {
+			fail("must be a valid %s", s.Format)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, partial, errs)
+			}
+		}
+	case map[string]interface{}:
+		if !partial {
+			for _, name := range s.Required {
+				if _, ok := v[name]; !ok {
+					*errs = append(*errs, joinPath(path, name)+" is required")
+				}
+			}
+		}
+		for name, item := range v {
+			if ps, ok := s.Properties[name]; ok {
+				ps.validate(joinPath(path, name), item, partial, errs)
+			} else if s.AdditionalProperties != nil {
+				s.AdditionalProperties.validate(joinPath(path, name), item, partial, errs)
+			}
+		}
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if isInteger(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func isInteger(v interface{}) bool {
+	n, ok := v.(json.Number)
+	if !ok {
+		return false
+	}
+	f, err := n.Float64()
+	return err == nil && f == math.Trunc(f)
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func validFormat(format, v string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, v)
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(v)
+		return err == nil && addr.Address == v
+	case "uri":
+		u, err := url.Parse(v)
+		return err == nil && u.Scheme != ""
+	case "uuid":
+		return uuidRegexp.MatchString(v)
+	}
+	return true
+}
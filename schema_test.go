@@ -0,0 +1,155 @@
+package crudley_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/stores/mem"
+)
+
+type product struct {
+	ID      string   `json:"id" rest:"immutable"`
+	Name    string   `json:"name" validate:"required,min=1,max=16"`
+	SKU     string   `json:"sku" validate:"pattern=^[A-Z]{3}-[0-9]+$"`
+	Price   float64  `json:"price" validate:"min=0"`
+	Status  string   `json:"status" validate:"enum=draft|live"`
+	Contact string   `json:"contact" validate:"format=email"`
+	Tags    []string `json:"tags" validate:"max=2"`
+	Deleted bool     `json:"deleted"`
+}
+
+func (p *product) New(id string) crudley.Model { return &product{ID: id} }
+func (p *product) GetName() string             { return "products" }
+func (p *product) PrimaryKey() string          { return p.ID }
+func (p *product) Delete()                     { p.Deleted = true }
+func (p *product) IsDeleted() bool             { return p.Deleted }
+
+func TestModelSchema(t *testing.T) {
+	s := crudley.ModelSchema(&product{})
+	if s.Schema != crudley.SchemaDialect || s.Title != "products" {
+		t.Errorf("expected products schema, got %+v", s)
+	}
+	if len(s.Required) != 1 || s.Required[0] != "name" {
+		t.Errorf("expected name to be required, got %v", s.Required)
+	}
+	name := s.Properties["name"]
+	if name.MinLength == nil || *name.MinLength != 1 || name.MaxLength == nil || *name.MaxLength != 16 {
+		t.Errorf("expected name length 1-16, got %+v", name)
+	}
+	if price := s.Properties["price"]; price.Minimum == nil || *price.Minimum != 0 {
+		t.Errorf("expected price minimum 0, got %+v", price)
+	}
+	if tags := s.Properties["tags"]; tags.MaxItems == nil || *tags.MaxItems != 2 {
+		t.Errorf("expected at most 2 tags, got %+v", tags)
+	}
+
+	for body, valid := range map[string]bool{
+		`{"name": "a", "sku": "ABC-1", "price": 1.5, "status": "live", "contact": "a@example.com", "tags": ["x"]}`: true,
+		`{"name": "a", "price": null}`:         false,
+		`{"price": 1}`:                         false,
+		`{"name": ""}`:                         false,
+		`{"name": "a", "sku": "abc"}`:          false,
+		`{"name": "a", "price": -1}`:           false,
+		`{"name": "a", "status": "archived"}`:  false,
+		`{"name": "a", "contact": "nobody"}`:   false,
+		`{"name": "a", "tags": ["x", "y", 1]}`: false,
+		`{"name": 1}`:                          false,
+	} {
+		err := s.ValidateJSON([]byte(body), false)
+		if valid && err != nil {
+			t.Errorf("expected %s to be valid, got %s", body, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("expected %s to be invalid", body)
+		}
+	}
+	if err := s.ValidateJSON([]byte(`{"price": 1}`), true); err != nil {
+		t.Errorf("expected a partial body to be valid, got %s", err)
+	}
+}
+
+func TestValidateBody(t *testing.T) {
+	p := crudley.NewPath(&product{}, mem.NewStore())
+	s := httptest.NewServer(http.StripPrefix("/api/products", p))
+	defer s.Close()
+	URL := s.URL + "/api/products/"
+
+	do := func(method, url, body string) (int, string, string) {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		defer res.Body.Close()
+		var out struct {
+			Results []product `json:"results"`
+			Error   string    `json:"error"`
+		}
+		json.NewDecoder(res.Body).Decode(&out)
+		id := ""
+		if len(out.Results) > 0 {
+			id = out.Results[0].ID
+		}
+		return res.StatusCode, id, out.Error
+	}
+
+	code, _, msg := do("POST", URL, `{"price": -1}`)
+	if code != http.StatusBadRequest || !strings.Contains(msg, "name is required") || !strings.Contains(msg, "price must be at least 0") {
+		t.Errorf("expected 400, got %v %s", code, msg)
+	}
+	code, id, msg := do("POST", URL, `{"name": "widget"}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %v %s", code, msg)
+	}
+	code, _, msg = do("PUT", URL+id, `{"price": 2}`)
+	if code != http.StatusOK {
+		t.Errorf("expected 200, got %v %s", code, msg)
+	}
+	code, _, msg = do("PUT", URL+id, `{"status": "archived"}`)
+	if code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %v %s", code, msg)
+	}
+
+	res, err := http.Get(URL + "_schema")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	defer res.Body.Close()
+	var schema crudley.Schema
+	err = json.NewDecoder(res.Body).Decode(&schema)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if schema.Schema != crudley.SchemaDialect || schema.Properties["status"] == nil || len(schema.Properties["status"].Enum) != 2 {
+		t.Errorf("expected products schema, got %+v", schema)
+	}
+}
+
+type badPattern struct {
+	ID      string `json:"id"`
+	Code    string `json:"code" validate:"pattern=^[A-Z+$"`
+	Deleted bool   `json:"deleted"`
+}
+
+func (b *badPattern) New(id string) crudley.Model { return &badPattern{ID: id} }
+func (b *badPattern) GetName() string             { return "bad" }
+func (b *badPattern) PrimaryKey() string          { return b.ID }
+func (b *badPattern) Delete()                     { b.Deleted = true }
+func (b *badPattern) IsDeleted() bool             { return b.Deleted }
+
+func TestInvalidPattern(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected NewPath to panic for an invalid pattern")
+		}
+	}()
+	crudley.NewPath(&badPattern{}, mem.NewStore())
+}
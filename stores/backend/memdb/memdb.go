@@ -2,13 +2,24 @@ package memdb
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 )
 
+// ErrExists is returned by Insert when a document with the ID already exists
+var ErrExists = errors.New("memdb: document exists")
+
+// ErrConflict is returned by Txn.Commit when a document read or written by the
+// transaction was modified by someone else before the transaction committed
+var ErrConflict = errors.New("memdb: transaction conflict")
+
 type Memdb struct {
 	sync.Mutex
 	store map[string]*Collection
+
+	// txMu serialises transactions, so only one Txn is open at a time
+	txMu sync.Mutex
 }
 
 func New() *Memdb {
@@ -22,14 +33,19 @@ func (m *Memdb) Collection(id string) *Collection {
 	defer m.Unlock()
 	_, ok := m.store[id]
 	if !ok {
-		m.store[id] = &Collection{store: make(map[string][]byte)}
+		m.store[id] = &Collection{
+			store:   make(map[string][]byte),
+			version: make(map[string]uint64),
+		}
 	}
 	return m.store[id]
 }
 
 type Collection struct {
 	sync.Mutex
-	store map[string][]byte
+	store   map[string][]byte
+	version map[string]uint64
+	seq     uint64
 }
 
 func (c *Collection) Doc(id string, out interface{}) (bool, error) {
@@ -51,20 +67,38 @@ func (c *Collection) DocRaw(id string) ([]byte, bool, error) {
 }
 
 func (c *Collection) AllRaw() map[string][]byte {
-	if c.store != nil {
-		return c.store
+	c.Lock()
+	defer c.Unlock()
+	out := make(map[string][]byte, len(c.store))
+	for id, doc := range c.store {
+		out[id] = doc
 	}
-	return make(map[string][]byte)
+	return out
 }
 
 func (c *Collection) Set(id string, doc interface{}) error {
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
 	c.Lock()
 	defer c.Unlock()
+	c.set(id, buf)
+	return nil
+}
+
+// Insert is like Set, but returns ErrExists rather than overwriting a document
+func (c *Collection) Insert(id string, doc interface{}) error {
 	buf, err := json.Marshal(doc)
 	if err != nil {
 		return err
 	}
-	c.store[id] = buf
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.store[id]; ok {
+		return ErrExists
+	}
+	c.set(id, buf)
 	return nil
 }
 
@@ -72,8 +106,173 @@ func (c *Collection) Remove(id string) error {
 	c.Lock()
 	defer c.Unlock()
 	if _, ok := c.store[id]; ok {
-		delete(c.store, id)
+		c.remove(id)
 		return nil
 	}
 	return fmt.Errorf("key not found")
 }
+
+// set and remove must be called with the Collection locked
+func (c *Collection) set(id string, buf []byte) {
+	c.seq++
+	c.store[id] = buf
+	c.version[id] = c.seq
+}
+
+func (c *Collection) remove(id string) {
+	c.seq++
+	delete(c.store, id)
+	delete(c.version, id)
+}
+
+// Begin opens a new transaction on the Memdb. Transactions are lock based, only
+// one may be open at a time, and Begin blocks until any open transaction has
+// been committed or rolled back. Writes made outside of a transaction are still
+// permitted, and cause Commit to return ErrConflict if they touch a document
+// the transaction has read.
+func (m *Memdb) Begin() *Txn {
+	m.txMu.Lock()
+	return &Txn{
+		db:     m,
+		reads:  make(map[*Collection]map[string]uint64),
+		writes: make(map[*Collection]map[string][]byte),
+		scans:  make(map[*Collection]uint64),
+		cols:   make(map[*Collection]bool),
+	}
+}
+
+// Txn buffers reads and writes against a Memdb until it is committed
+type Txn struct {
+	db     *Memdb
+	done   bool
+	reads  map[*Collection]map[string]uint64
+	writes map[*Collection]map[string][]byte
+	scans  map[*Collection]uint64
+	cols   map[*Collection]bool
+}
+
+func (t *Txn) Doc(c *Collection, id string, out interface{}) (bool, error) {
+	buf, found := t.DocRaw(c, id)
+	if !found {
+		return false, nil
+	}
+	return true, json.Unmarshal(buf, out)
+}
+
+func (t *Txn) DocRaw(c *Collection, id string) ([]byte, bool) {
+	if buf, ok := t.writes[c][id]; ok {
+		return buf, buf != nil
+	}
+	t.cols[c] = true
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := t.reads[c]; !ok {
+		t.reads[c] = make(map[string]uint64)
+	}
+	if _, ok := t.reads[c][id]; !ok {
+		t.reads[c][id] = c.version[id]
+	}
+	doc, ok := c.store[id]
+	return doc, ok
+}
+
+func (t *Txn) AllRaw(c *Collection) map[string][]byte {
+	t.cols[c] = true
+	c.Lock()
+	if _, ok := t.scans[c]; !ok {
+		t.scans[c] = c.seq
+	}
+	out := make(map[string][]byte, len(c.store))
+	for id, doc := range c.store {
+		out[id] = doc
+	}
+	c.Unlock()
+	for id, buf := range t.writes[c] {
+		if buf == nil {
+			delete(out, id)
+			continue
+		}
+		out[id] = buf
+	}
+	return out
+}
+
+func (t *Txn) Set(c *Collection, id string, doc interface{}) error {
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	t.write(c, id, buf)
+	return nil
+}
+
+func (t *Txn) Insert(c *Collection, id string, doc interface{}) error {
+	if _, found := t.DocRaw(c, id); found {
+		return ErrExists
+	}
+	return t.Set(c, id, doc)
+}
+
+func (t *Txn) Remove(c *Collection, id string) error {
+	if _, found := t.DocRaw(c, id); !found {
+		return fmt.Errorf("key not found")
+	}
+	t.write(c, id, nil)
+	return nil
+}
+
+func (t *Txn) write(c *Collection, id string, buf []byte) {
+	t.cols[c] = true
+	if _, ok := t.writes[c]; !ok {
+		t.writes[c] = make(map[string][]byte)
+	}
+	t.writes[c][id] = buf
+}
+
+// Commit applies all buffered writes, or returns ErrConflict if anything the
+// transaction depends on has changed since it was read. The Txn is closed
+// afterwards either way.
+func (t *Txn) Commit() error {
+	if t.done {
+		return fmt.Errorf("memdb: transaction already closed")
+	}
+	defer t.Rollback()
+
+	// transactions are serialised by txMu, and non-transactional writes only
+	// ever hold a single Collection lock, so locking all of them can't deadlock
+	for c := range t.cols {
+		c.Lock()
+		defer c.Unlock()
+	}
+	for c, seq := range t.scans {
+		if c.seq != seq {
+			return ErrConflict
+		}
+	}
+	for c, reads := range t.reads {
+		for id, v := range reads {
+			if c.version[id] != v {
+				return ErrConflict
+			}
+		}
+	}
+	for c, writes := range t.writes {
+		for id, buf := range writes {
+			if buf == nil {
+				c.remove(id)
+				continue
+			}
+			c.set(id, buf)
+		}
+	}
+	return nil
+}
+
+// Rollback discards the transaction, it is safe to call after Commit
+func (t *Txn) Rollback() {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.db.txMu.Unlock()
+}
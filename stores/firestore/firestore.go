@@ -5,8 +5,10 @@ import (
 	"context"
 	"errors"
 	"github.com/arussellsaw/crudley"
-	"github.com/google/uuid"
+	"github.com/arussellsaw/crudley/ids"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"strings"
 	"time"
 )
@@ -29,22 +31,54 @@ type Store struct {
 	c *firestore.Client
 	// TODO: pass this per method
 	ctx context.Context
+	tx  *firestore.Transaction
 }
 
 func (s *Store) Collection(m crudley.Model) (crudley.Collection, error) {
 	return &Collection{
 		col:   s.c.Collection(m.GetName()),
 		Model: m,
+		tx:    s.tx,
 	}, nil
 }
 
+// RunInTransaction implements crudley.Transactor using firestore transactions,
+// which are retried by the client on contention. Firestore requires that all
+// reads in a transaction happen before any writes. Documents created with
+// CreateWithID that already exist are only reported when the transaction
+// commits, as a crudley.ConflictError.
+func (s *Store) RunInTransaction(ctx context.Context, fn crudley.TransactionFunc) error {
+	if s.tx != nil {
+		return fn(ctx, s)
+	}
+	err := s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		return fn(ctx, &Store{c: s.c, ctx: ctx, tx: tx})
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return crudley.ConflictError(status.Convert(err).Message())
+	}
+	return err
+}
+
 type Collection struct {
 	col   *firestore.CollectionRef
 	Model crudley.Model
+	tx    *firestore.Transaction
 }
 
 func (c *Collection) View(ctx context.Context, id string) (crudley.Model, error) {
-	ds, err := c.col.Doc(id).Get(ctx)
+	var (
+		ds  *firestore.DocumentSnapshot
+		err error
+	)
+	if c.tx != nil {
+		ds, err = c.tx.Get(c.col.Doc(id))
+	} else {
+		ds, err = c.col.Doc(id).Get(ctx)
+	}
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -60,17 +94,26 @@ func (c *Collection) Update(ctx context.Context, id string, m crudley.Model) err
 	// TODO: right now this overwrites all fields so updates must contain
 	// the whole model to not blank fields. i think i can iterate over non-empty
 	// struct fields using fatih/structs to only update non-zero fields, but i'll do that later
+	if c.tx != nil {
+		return c.tx.Set(c.col.Doc(id), m)
+	}
 	_, err := c.col.Doc(id).Set(ctx, m)
 	return err
 }
 
 func (c *Collection) Delete(ctx context.Context, id string) error {
+	if c.tx != nil {
+		return c.tx.Delete(c.col.Doc(id))
+	}
 	_, err := c.col.Doc(id).Delete(ctx)
 	return err
 }
 
 func (c *Collection) Scan(ctx context.Context, fn crudley.ScannerFunc) error {
 	iter := c.col.Documents(ctx)
+	if c.tx != nil {
+		iter = c.tx.Documents(c.col)
+	}
 	for {
 		doc, err := iter.Next()
 		if err == iterator.Done {
@@ -93,15 +136,37 @@ func (c *Collection) Scan(ctx context.Context, fn crudley.ScannerFunc) error {
 }
 
 func (c *Collection) Create(ctx context.Context, fn crudley.CreaterFunc) error {
-	id := uuid.New().String()
+	id := crudley.GenerateID(ctx, c.Model, ids.UUIDv4)
 	m, err := fn(id)
 	if err != nil {
 		return err
 	}
+	if c.tx != nil {
+		return c.tx.Create(c.col.Doc(id), m)
+	}
 	_, err = c.col.Doc(id).Set(ctx, m)
 	return err
 }
 
+// CreateWithID implements crudley.IDCreater, returning a crudley.ConflictError
+// if a document with the id already exists
+func (c *Collection) CreateWithID(ctx context.Context, id string, fn crudley.CreaterFunc) error {
+	m, err := fn(id)
+	if err != nil {
+		return err
+	}
+	if c.tx != nil {
+		// inside a transaction conflicts are only reported when it commits, by
+		// RunInTransaction
+		return c.tx.Create(c.col.Doc(id), m)
+	}
+	_, err = c.col.Doc(id).Create(ctx, m)
+	if status.Code(err) == codes.AlreadyExists {
+		return crudley.ConflictError("Model " + id + " already exists")
+	}
+	return err
+}
+
 func (c *Collection) Search(ctx context.Context, m crudley.Model, fn crudley.ScannerFunc) (int, error) {
 	return 0, errors.New("not implemented")
 }
@@ -111,6 +176,8 @@ func (c *Collection) Query() crudley.Query {
 		col:   c.col,
 		Model: c.Model,
 		q:     c.col.Query,
+		tx:    c.tx,
+		eq:    make(map[string][]interface{}),
 	}
 }
 
@@ -118,10 +185,20 @@ type Query struct {
 	col   *firestore.CollectionRef
 	Model crudley.Model
 	q     firestore.Query
+	tx    *firestore.Transaction
+
+	// eq holds the values of the Equal predicates on each field, in eqKeys order
+	eq     map[string][]interface{}
+	eqKeys []string
 }
 
+// Equal predicates on the same field match any of their values, with an in
+// filter, which firestore limits to 10 values
 func (q *Query) Equal(key string, val interface{}) {
-	q.q = q.q.Where(key, "==", val)
+	if _, ok := q.eq[key]; !ok {
+		q.eqKeys = append(q.eqKeys, key)
+	}
+	q.eq[key] = append(q.eq[key], val)
 }
 
 func (q *Query) NotEqual(key string, val interface{}) {
@@ -160,7 +237,18 @@ func (q *Query) Sort(by string) {
 
 func (q *Query) Execute(ctx context.Context) ([]crudley.Model, error) {
 	out := []crudley.Model{}
-	iter := q.q.Documents(ctx)
+	fq := q.q
+	for _, key := range q.eqKeys {
+		if vals := q.eq[key]; len(vals) == 1 {
+			fq = fq.Where(key, "==", vals[0])
+		} else {
+			fq = fq.Where(key, "in", vals)
+		}
+	}
+	iter := fq.Documents(ctx)
+	if q.tx != nil {
+		iter = q.tx.Documents(fq)
+	}
 	for {
 		doc, err := iter.Next()
 		if err == iterator.Done {
@@ -199,7 +287,6 @@ func (b *Base) New(id string) crudley.Model {
 // GetName should be overridden to return the name of your collection
 func (b *Base) GetName() string {
 	panic("must override Name() on Base model")
-	return "base"
 }
 
 func (b *Base) PrimaryKey() string {
@@ -213,3 +300,7 @@ func (b *Base) Delete() {
 func (b *Base) IsDeleted() bool {
 	return !b.Deleted.IsZero()
 }
+
+func (b *Base) Restore() {
+	b.Deleted = time.Time{}
+}
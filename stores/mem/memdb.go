@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"reflect"
-
-	"github.com/google/uuid"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/ids"
 	"github.com/arussellsaw/crudley/stores/backend/memdb"
 )
 
@@ -16,9 +18,14 @@ func NewStore() crudley.Store {
 	return &Store{db: memdb.New()}
 }
 
+// maxTxAttempts is the number of times RunInTransaction will try to commit a
+// transaction that conflicts with concurrent writes
+const maxTxAttempts = 5
+
 // Store is a memdb implementation of the crudley.Store interface
 type Store struct {
 	db *memdb.Memdb
+	tx *memdb.Txn
 }
 
 // Collection retrieves or creates a new collection from the Store
@@ -26,39 +33,104 @@ func (s *Store) Collection(mdl crudley.Model) (crudley.Collection, error) {
 	return &Collection{
 		col:   s.db.Collection(mdl.GetName()),
 		model: mdl,
+		tx:    s.tx,
 	}, nil
 }
 
+// RunInTransaction implements crudley.Transactor. Transactions hold a lock on
+// the memdb for their duration, and are retried if a write made outside of a
+// transaction conflicts with them. Calling RunInTransaction on a transaction
+// scoped Store joins the existing transaction, while calling it on the Store
+// the transaction was started from, with the TransactionFunc's context, returns
+// crudley.ErrorNestedTransaction rather than waiting for the lock forever.
+func (s *Store) RunInTransaction(ctx context.Context, fn crudley.TransactionFunc) error {
+	if s.tx != nil {
+		return fn(ctx, s)
+	}
+	if db, _ := ctx.Value(txKey{}).(*memdb.Memdb); db == s.db {
+		return crudley.ErrorNestedTransaction
+	}
+	var err error
+	for i := 0; i < maxTxAttempts; i++ {
+		err = s.runTx(ctx, fn)
+		if err != memdb.ErrConflict {
+			return err
+		}
+	}
+	return err
+}
+
+// txKey is the context key for the memdb a transaction is open on
+type txKey struct{}
+
+func (s *Store) runTx(ctx context.Context, fn crudley.TransactionFunc) error {
+	tx := s.db.Begin()
+	defer tx.Rollback()
+	err := fn(context.WithValue(ctx, txKey{}, s.db), &Store{db: s.db, tx: tx})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // Collection is the crudley.Collection memdb implementation
 type Collection struct {
 	col   *memdb.Collection
 	model crudley.Model
+	tx    *memdb.Txn
 }
 
 // Update an existing Model in the memdb
 func (c *Collection) Update(ctx context.Context, id string, model crudley.Model) error {
-	return c.col.Set(id, model)
+	return c.set(id, model)
 }
 
 // Create creates a new instance of the Model, and saves it to the Collection
 func (c *Collection) Create(ctx context.Context, crFunc crudley.CreaterFunc) error {
-	id := c.id()
+	id := crudley.GenerateID(ctx, c.model, ids.UUIDv4)
 	mdl, err := crFunc(id)
 	if err != nil {
 		return err
 	}
-	err = c.col.Set(id, mdl)
+	err = c.set(id, mdl)
+	return err
+}
+
+// CreateWithID implements crudley.IDCreater, returning a crudley.ConflictError
+// if a Model with the id already exists
+func (c *Collection) CreateWithID(ctx context.Context, id string, crFunc crudley.CreaterFunc) error {
+	mdl, err := crFunc(id)
+	if err != nil {
+		return err
+	}
+	if c.tx != nil {
+		err = c.tx.Insert(c.col, id, mdl)
+	} else {
+		err = c.col.Insert(id, mdl)
+	}
+	if err == memdb.ErrExists {
+		return crudley.ConflictError("Model " + id + " already exists")
+	}
 	return err
 }
 
 // Delete removes a Model from the collection
 func (c *Collection) Delete(ctx context.Context, id string) error {
+	if c.tx != nil {
+		return c.tx.Remove(c.col, id)
+	}
 	return c.col.Remove(id)
 }
 
 // Scan iterates over all items in the collection from memdb
 func (c *Collection) Scan(ctx context.Context, scanner crudley.ScannerFunc) error {
-	for _, doc := range c.col.AllRaw() {
+	var docs map[string][]byte
+	if c.tx != nil {
+		docs = c.tx.AllRaw(c.col)
+	} else {
+		docs = c.col.AllRaw()
+	}
+	for _, doc := range docs {
 		m := c.model.New("")
 		err := json.Unmarshal(doc, m)
 		if err != nil {
@@ -106,8 +178,16 @@ func (c *Collection) Search(ctx context.Context, partialModel crudley.Model, sca
 
 // View retrieves a Model from the memdb
 func (c *Collection) View(ctx context.Context, id string) (crudley.Model, error) {
-	mdl := c.model.New(id)
-	found, err := c.col.Doc(id, mdl)
+	var (
+		mdl   = c.model.New(id)
+		found bool
+		err   error
+	)
+	if c.tx != nil {
+		found, err = c.tx.Doc(c.col, id, mdl)
+	} else {
+		found, err = c.col.Doc(id, mdl)
+	}
 	if !found {
 		return nil, nil
 	}
@@ -165,28 +245,147 @@ func (q *Query) Sort(by string) {
 	q.sort = by
 }
 
-// Execute runs the Query
+// Execute runs the Query, Models are sorted by ID unless a sort field is set,
+// and skip and limit are applied to the matched Models
 func (q *Query) Execute(ctx context.Context) ([]crudley.Model, error) {
 	var out []crudley.Model
-	var i int
-	q.col.Scan(ctx, func(m crudley.Model) error {
-		i++
-		if i < q.skip {
-			return nil
-		}
-		if i > q.limit && q.limit != 0 {
-			return nil
-		}
+	err := q.col.Scan(ctx, func(m crudley.Model) error {
 		mValue := reflect.ValueOf(m).Elem()
-		pass := check(mValue, q)
-		if pass {
+		if check(mValue, q) {
 			out = append(out, m)
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	sortModels(out, q.sort)
+	if q.skip >= len(out) {
+		return nil, nil
+	}
+	out = out[q.skip:]
+	if q.limit != 0 && len(out) > q.limit {
+		out = out[:q.limit]
+	}
 	return out, nil
 }
 
+// sortModels sorts by the field with the json tag by, descending if it has a
+// "-" prefix, falling back to the Models' primary keys
+func sortModels(models []crudley.Model, by string) {
+	desc := strings.HasPrefix(by, "-")
+	by = strings.TrimPrefix(by, "-")
+	sort.SliceStable(models, func(i, j int) bool {
+		if by != "" {
+			a, aok := fieldByTag(reflect.ValueOf(models[i]).Elem(), by)
+			b, bok := fieldByTag(reflect.ValueOf(models[j]).Elem(), by)
+			if aok && bok {
+				if c := compareValues(a, b); c != 0 {
+					return (c < 0) != desc
+				}
+			}
+		}
+		return models[i].PrimaryKey() < models[j].PrimaryKey()
+	})
+}
+
+func fieldByTag(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if tag == name {
+			return v.Field(i), true
+		}
+		if tag == "" && v.Field(i).Kind() == reflect.Struct {
+			if fv, ok := fieldByTag(v.Field(i), name); ok {
+				return fv, true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// compareValues orders two values of the same type, nil pointers first
+func compareValues(a, b reflect.Value) int {
+	if a.Kind() == reflect.Ptr {
+		switch {
+		case a.IsNil() && b.IsNil():
+			return 0
+		case a.IsNil():
+			return -1
+		case b.IsNil():
+			return 1
+		}
+		return compareValues(a.Elem(), b.Elem())
+	}
+	if t, ok := a.Interface().(time.Time); ok {
+		switch u := b.Interface().(time.Time); {
+		case t.Before(u):
+			return -1
+		case t.After(u):
+			return 1
+		}
+		return 0
+	}
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch {
+		case a.Int() < b.Int():
+			return -1
+		case a.Int() > b.Int():
+			return 1
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch {
+		case a.Uint() < b.Uint():
+			return -1
+		case a.Uint() > b.Uint():
+			return 1
+		}
+	case reflect.Float32, reflect.Float64:
+		switch {
+		case a.Float() < b.Float():
+			return -1
+		case a.Float() > b.Float():
+			return 1
+		}
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Bool:
+		switch {
+		case !a.Bool() && b.Bool():
+			return -1
+		case a.Bool() && !b.Bool():
+			return 1
+		}
+	}
+	return 0
+}
+
+// compareOrdered compares a field to the value of a GreaterThan or LessThan
+// predicate, returning false if they can't be ordered. Numbers are compared with
+// numbers of any size, other values with values of the same type.
+func compareOrdered(field, val reflect.Value) (int, bool) {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch val.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return compareValues(reflect.ValueOf(field.Int()), reflect.ValueOf(val.Int())), true
+		}
+		return 0, false
+	case reflect.Float32, reflect.Float64:
+		switch val.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return compareValues(reflect.ValueOf(field.Float()), reflect.ValueOf(val.Float())), true
+		}
+		return 0, false
+	}
+	if !val.IsValid() || field.Type() != val.Type() {
+		return 0, false
+	}
+	return compareValues(field, val), true
+}
+
 func check(mValue reflect.Value, q *Query) bool {
 	mType := mValue.Type()
 	var pass bool
@@ -207,17 +406,17 @@ func check(mValue reflect.Value, q *Query) bool {
 				return false
 			}
 		}
+		// Equal predicates on the same field match any of their values
+		var matched bool
 		for _, kv := range q.eq {
 			if kv.k == tag {
 				checks++
 				if reflect.DeepEqual(kv.v, mValue.Field(i).Interface()) {
-					pass = true
-				} else {
-					pass = false
+					matched = true
 				}
 			}
 		}
-		if pass == false && checks != 0 {
+		if !matched && checks != 0 {
 			return false
 		}
 		checks = 0
@@ -234,89 +433,28 @@ func check(mValue reflect.Value, q *Query) bool {
 		if pass == false && checks != 0 {
 			return false
 		}
-		checks = 0
 		for _, kv := range q.gt {
 			if kv.k == tag {
-				checks++
-				mKVval := reflect.ValueOf(kv.v)
-				switch mValue.Field(i).Kind() {
-				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-					mFieldIntval := mValue.Field(i).Int()
-					switch mKVval.Kind() {
-					case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-						mKVIntVal := mKVval.Int()
-						if mFieldIntval > mKVIntVal {
-							pass = true
-						} else {
-							pass = false
-						}
-					default:
-						pass = false
-					}
-				case reflect.Float32, reflect.Float64:
-					mFieldFloatval := mValue.Field(i).Float()
-					switch mKVval.Kind() {
-					case reflect.Float32, reflect.Float64:
-						mKVFloatVal := mKVval.Float()
-						if mFieldFloatval > mKVFloatVal {
-							pass = true
-						} else {
-							pass = false
-						}
-					default:
-						pass = false
-					}
-				default:
-					pass = false
+				if c, ok := compareOrdered(mValue.Field(i), reflect.ValueOf(kv.v)); !ok || c <= 0 {
+					return false
 				}
 			}
 		}
-		if pass == false && checks != 0 {
-			return false
-		}
-		checks = 0
 		for _, kv := range q.lt {
 			if kv.k == tag {
-				checks++
-				mKVval := reflect.ValueOf(kv.v)
-				switch mValue.Field(i).Kind() {
-				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-					mFieldIntval := mValue.Field(i).Int()
-					switch mKVval.Kind() {
-					case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-						mKVIntVal := mKVval.Int()
-						if mFieldIntval < mKVIntVal {
-							pass = true
-						} else {
-							pass = false
-						}
-					default:
-						pass = false
-					}
-				case reflect.Float32, reflect.Float64:
-					mFieldFloatval := mValue.Field(i).Float()
-					switch mKVval.Kind() {
-					case reflect.Float32, reflect.Float64:
-						mKVFloatVal := mKVval.Float()
-						if mFieldFloatval < mKVFloatVal {
-							pass = true
-						} else {
-							pass = false
-						}
-					default:
-						pass = false
-					}
+				if c, ok := compareOrdered(mValue.Field(i), reflect.ValueOf(kv.v)); !ok || c >= 0 {
+					return false
 				}
 			}
 		}
-		if pass == false && checks != 0 {
-			return false
-		}
 		pass = false
 	}
 	return true
 }
 
-func (c *Collection) id() string {
-	return uuid.New().String()
+func (c *Collection) set(id string, mdl crudley.Model) error {
+	if c.tx != nil {
+		return c.tx.Set(c.col, id, mdl)
+	}
+	return c.col.Set(id, mdl)
 }
@@ -1,8 +1,11 @@
 package mem
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/arussellsaw/crudley"
 	"github.com/arussellsaw/crudley/testutil/store"
 )
 
@@ -30,3 +33,51 @@ func TestQuery(t *testing.T) {
 	db := NewStore()
 	store.TestQuery(db, t)
 }
+
+func TestTransaction(t *testing.T) {
+	db := NewStore()
+	store.TestTransaction(db, t)
+}
+
+func TestCreateWithID(t *testing.T) {
+	db := NewStore()
+	store.TestCreateWithID(db, t)
+}
+
+func TestIDGenerator(t *testing.T) {
+	db := NewStore()
+	store.TestIDGenerator(db, t)
+}
+
+func TestTypedCollection(t *testing.T) {
+	db := NewStore()
+	store.TestTypedCollection(db, t)
+}
+
+func TestNestedTransaction(t *testing.T) {
+	db := NewStore()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- crudley.RunInTransaction(context.Background(), db, func(ctx context.Context, tx crudley.Store) error {
+			// joining through the transaction's Store is allowed
+			err := crudley.RunInTransaction(ctx, tx, func(context.Context, crudley.Store) error { return nil })
+			if err != nil {
+				return err
+			}
+			return crudley.RunInTransaction(ctx, db, func(context.Context, crudley.Store) error { return nil })
+		})
+	}()
+	select {
+	case err := <-errs:
+		if err != crudley.ErrorNestedTransaction {
+			t.Errorf("expected %s, got %v", crudley.ErrorNestedTransaction, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected nested transaction to fail, it deadlocked")
+	}
+	// the lock was released
+	err := crudley.RunInTransaction(context.Background(), db, func(context.Context, crudley.Store) error { return nil })
+	if err != nil {
+		t.Errorf("expected nil, got %s", err)
+	}
+}
@@ -67,9 +67,6 @@ func (c *Collection) View(ctx context.Context, id string) (crudley.Model, error)
 	if err == mgo.ErrNotFound {
 		return nil, nil
 	}
-	if m.IsDeleted() {
-		return nil, nil
-	}
 	return m, err
 }
 
@@ -140,7 +137,7 @@ func (c *Collection) Search(ctx context.Context, partial crudley.Model, scanner
 
 // Create accepts a creation function to add a new crudley.Model to the collection
 func (c *Collection) Create(ctx context.Context, createFn crudley.CreaterFunc) error {
-	id := c.id()
+	id := crudley.GenerateID(ctx, c.Model, ObjectID)
 	m, err := createFn(id)
 	if err != nil {
 		return err
@@ -148,6 +145,20 @@ func (c *Collection) Create(ctx context.Context, createFn crudley.CreaterFunc) e
 	return c.col.Insert(m)
 }
 
+// CreateWithID implements crudley.IDCreater, the Model returned by createFn must
+// use id as its _id, and a crudley.ConflictError is returned if it already exists
+func (c *Collection) CreateWithID(ctx context.Context, id string, createFn crudley.CreaterFunc) error {
+	m, err := createFn(id)
+	if err != nil {
+		return err
+	}
+	err = c.col.Insert(m)
+	if mgo.IsDup(err) {
+		return crudley.ConflictError("Model " + id + " already exists")
+	}
+	return err
+}
+
 // Query returns a crudley.Query for building more complex queries against the Collection
 func (c *Collection) Query() crudley.Query {
 	return &Query{
@@ -255,6 +266,8 @@ func (q *Query) Execute(ctx context.Context) ([]crudley.Model, error) {
 	return mdls, nil
 }
 
-func (c *Collection) id() string {
+// ObjectID is the default crudley.IDGenerator for mongodb, generating hex
+// encoded bson ObjectIds
+var ObjectID crudley.IDGenerator = crudley.IDGeneratorFunc(func() string {
 	return bson.NewObjectId().Hex()
-}
+})
@@ -0,0 +1,391 @@
+// Package remote is a crudley.Store backed by the REST API of another crudley
+// service. Each Collection calls the Path serving its Model, so one service can
+// proxy or compose the Models of another:
+//
+//	s := remote.NewStore(client.New("https://users.internal", client.OptionHeader("Authorization", token)))
+//	mux.Handle("/api/users/", http.StripPrefix("/api/users", crudley.NewPath(&User{}, s)))
+//
+// Models are exchanged as JSON, so the remote Path's rest tags apply, fields it
+// doesn't return are zero and fields it doesn't accept are not saved.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/client"
+	"github.com/arussellsaw/crudley/ids"
+)
+
+// Option configures a Store
+type Option func(s *Store)
+
+// OptionPath sets the path of the remote Path serving the Model named name,
+// instead of /<name>
+func OptionPath(name, path string) Option {
+	return func(s *Store) {
+		s.paths[name] = path
+	}
+}
+
+// NewStore returns a Store that calls the API c is configured for. The Model
+// with the name GetName is expected to be served under /<name> unless set with
+// OptionPath.
+func NewStore(c *client.Client, opts ...Option) crudley.Store {
+	s := &Store{
+		client: c,
+		paths:  make(map[string]string),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Store is a crudley.Store that reads and writes the Models of remote Paths
+type Store struct {
+	client *client.Client
+	paths  map[string]string
+}
+
+// Collection returns the Collection of the remote Path serving m
+func (s *Store) Collection(m crudley.Model) (crudley.Collection, error) {
+	path, ok := s.paths[m.GetName()]
+	if !ok {
+		path = "/" + m.GetName()
+	}
+	return &Collection{
+		remote:  client.NewCollection[json.RawMessage](s.client, path),
+		model:   m,
+		idField: idField(m),
+	}, nil
+}
+
+// Collection is the crudley.Collection of a remote Path
+type Collection struct {
+	remote *client.Collection[json.RawMessage]
+	model  crudley.Model
+	// idField is the json name of the Model's ID, which scans are sorted by so
+	// that they page with a cursor
+	idField string
+}
+
+// idField returns the json name of m's ID, or "" if it isn't serialized
+func idField(m crudley.Model) string {
+	const id = "remote-id"
+	fields, err := jsonFields(m.New(id))
+	if err != nil {
+		return ""
+	}
+	for key, val := range fields {
+		if val == id {
+			return key
+		}
+	}
+	return ""
+}
+
+// storeError converts the errors of the remote Path into the errors a Store
+// returns
+func storeError(err error) error {
+	switch {
+	case errors.Is(err, client.ErrorNotFound):
+		return crudley.NotFoundError(err.Error())
+	case errors.Is(err, client.ErrorConflict):
+		return crudley.ConflictError(err.Error())
+	}
+	return err
+}
+
+func (c *Collection) decode(raw json.RawMessage) (crudley.Model, error) {
+	m := c.model.New("")
+	err := json.Unmarshal(raw, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %s", c.model.GetName(), err)
+	}
+	return m, nil
+}
+
+// View retrieves a Model with a GET request, returning nil if the remote Path
+// responds not found, as it does for deleted Models
+func (c *Collection) View(ctx context.Context, id string) (crudley.Model, error) {
+	raw, err := c.remote.Get(ctx, id)
+	if errors.Is(err, client.ErrorNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.decode(raw)
+}
+
+// Update sends the fields of the Model that differ from the remote Path's copy
+// in a PUT request, which the remote Path applies to the Model it has. Fields
+// the remote Path doesn't return, such as writeonly ones, are only sent if they
+// are set, so they aren't cleared by updating other fields. Paths soft delete
+// Models by updating them, so a deleted Model is instead deleted by the remote
+// Path, which decides how deletion is stored.
+func (c *Collection) Update(ctx context.Context, id string, m crudley.Model) error {
+	if m.IsDeleted() {
+		return c.Delete(ctx, id)
+	}
+	fields, err := jsonFields(m)
+	if err != nil {
+		return err
+	}
+	zero, err := jsonFields(m.New(""))
+	if err != nil {
+		return err
+	}
+	raw, err := c.remote.Get(ctx, id)
+	if err != nil {
+		return storeError(err)
+	}
+	current, err := decodeFields(raw)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %s", c.model.GetName(), err)
+	}
+	changed := make(map[string]interface{})
+	for key, val := range fields {
+		prev, ok := current[key]
+		if ok && reflect.DeepEqual(val, prev) {
+			continue
+		}
+		if !ok && reflect.DeepEqual(val, zero[key]) {
+			continue
+		}
+		changed[key] = val
+	}
+	buf, err := json.Marshal(changed)
+	if err != nil {
+		return err
+	}
+	_, err = c.remote.Update(ctx, id, buf)
+	return storeError(err)
+}
+
+// Create generates an ID in the same way as other Stores, and creates the
+// Model with it. This requires the remote Path's Store to implement
+// crudley.IDCreater.
+func (c *Collection) Create(ctx context.Context, crFunc crudley.CreaterFunc) error {
+	id := crudley.GenerateID(ctx, c.model, ids.UUIDv4)
+	return c.CreateWithID(ctx, id, crFunc)
+}
+
+// CreateWithID implements crudley.IDCreater with a create operation sent to the
+// remote Path's batch endpoint, returning a crudley.ConflictError if a Model
+// with the id already exists
+func (c *Collection) CreateWithID(ctx context.Context, id string, crFunc crudley.CreaterFunc) error {
+	m, err := crFunc(id)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = c.remote.CreateWithID(ctx, id, buf)
+	return storeError(err)
+}
+
+// Delete sends a DELETE request to the remote Path, which soft deletes the
+// Model unless it was created with crudley.OptionHardDelete
+func (c *Collection) Delete(ctx context.Context, id string) error {
+	_, err := c.remote.Delete(ctx, id)
+	return storeError(err)
+}
+
+// Scan pages through all of the remote Path's Models, including deleted ones
+func (c *Collection) Scan(ctx context.Context, scanner crudley.ScannerFunc) error {
+	return c.scan(ctx, client.NewQuery().IncludeDeleted(), scanner)
+}
+
+// scan pages through the Models matching q, sorted by ID unless q is sorted
+func (c *Collection) scan(ctx context.Context, q *client.Query, scanner crudley.ScannerFunc) error {
+	if q.Values().Get("sort") == "" && c.idField != "" {
+		q.Sort(c.idField)
+	}
+	it := c.remote.Iterate(q)
+	for it.Next(ctx) {
+		m, err := c.decode(it.Value())
+		if err != nil {
+			return err
+		}
+		err = scanner(m)
+		if err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// Search queries the remote Path for Models equal to the non zero string,
+// number and bool fields of partialModel. Other fields are ignored.
+func (c *Collection) Search(ctx context.Context, partialModel crudley.Model, scanner crudley.ScannerFunc) (int, error) {
+	fields, err := jsonFields(partialModel)
+	if err != nil {
+		return 0, err
+	}
+	zero, err := jsonFields(partialModel.New(""))
+	if err != nil {
+		return 0, err
+	}
+	q := client.NewQuery().IncludeDeleted()
+	for key, val := range fields {
+		if reflect.DeepEqual(val, zero[key]) {
+			continue
+		}
+		switch val.(type) {
+		case string, json.Number, bool:
+			q.Equal(key, val)
+		}
+	}
+	var count int
+	err = c.scan(ctx, q, func(m crudley.Model) error {
+		count++
+		return scanner(m)
+	})
+	return count, err
+}
+
+// jsonFields returns the top level fields of the Model's JSON
+func jsonFields(m crudley.Model) (map[string]interface{}, error) {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return decodeFields(buf)
+}
+
+// decodeFields returns the top level fields of a JSON object, with numbers kept
+// as they were encoded
+func decodeFields(buf []byte) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.UseNumber()
+	err := d.Decode(&fields)
+	return fields, err
+}
+
+// Query returns a Query of the remote Path's Models
+func (c *Collection) Query() crudley.Query {
+	return &Query{
+		col: c,
+		q:   client.NewQuery().IncludeDeleted(),
+	}
+}
+
+type kv struct {
+	k string
+	v interface{}
+}
+
+// Query translates predicates into the query parameters of a list request.
+// Equal predicates on the same field are sent as repeated parameters, which the
+// remote Path matches against any of the values, like every crudley.Query.
+type Query struct {
+	col         *Collection
+	q           *client.Query
+	ne          []kv
+	limit, skip int
+}
+
+func (q *Query) Equal(key string, val interface{}) {
+	q.q.Equal(key, val)
+}
+
+// NotEqual has no query parameter, so Models are filtered after they are
+// retrieved, and Skip and Limit are applied to the filtered Models
+func (q *Query) NotEqual(key string, val interface{}) {
+	q.ne = append(q.ne, kv{key, val})
+}
+
+func (q *Query) GreaterThan(key string, val interface{}) {
+	q.q.GreaterThan(key, val)
+}
+
+func (q *Query) LessThan(key string, val interface{}) {
+	q.q.LessThan(key, val)
+}
+
+func (q *Query) Limit(n int) {
+	q.limit = n
+}
+
+func (q *Query) Skip(n int) {
+	q.skip = n
+}
+
+func (q *Query) Has(key string) {
+	q.q.Has(key)
+}
+
+func (q *Query) Sort(by string) {
+	q.q.Sort(by)
+}
+
+// Execute runs the Query with a single list request, or pages through all of
+// the matching Models if there are NotEqual predicates
+func (q *Query) Execute(ctx context.Context) ([]crudley.Model, error) {
+	if len(q.ne) == 0 {
+		raws, err := q.col.remote.List(ctx, q.q.Skip(q.skip).Limit(q.limit))
+		if err != nil {
+			return nil, storeError(err)
+		}
+		out := make([]crudley.Model, 0, len(raws))
+		for _, raw := range raws {
+			m, err := q.col.decode(raw)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, m)
+		}
+		return out, nil
+	}
+
+	var out []crudley.Model
+	err := q.col.scan(ctx, q.q.Skip(0).Limit(0), func(m crudley.Model) error {
+		fields, err := jsonFields(m)
+		if err != nil {
+			return err
+		}
+		for _, ne := range q.ne {
+			if format(fields[ne.k]) == format(ne.v) {
+				return nil
+			}
+		}
+		out = append(out, m)
+		return nil
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if q.skip >= len(out) {
+		return nil, nil
+	}
+	out = out[q.skip:]
+	if q.limit != 0 && len(out) > q.limit {
+		out = out[:q.limit]
+	}
+	return out, nil
+}
+
+// format formats a value in the same way as a query parameter, so that values
+// decoded from JSON compare equal to the values they were encoded from
+func format(val interface{}) string {
+	switch v := val.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(val)
+}
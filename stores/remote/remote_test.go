@@ -0,0 +1,185 @@
+package remote_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/client"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/stores/remote"
+	"github.com/arussellsaw/crudley/testutil/store"
+)
+
+// setUp serves the test Models from a mem Store, returning a remote Store
+// calling them
+func setUp(t *testing.T) crudley.Store {
+	s := mem.NewStore()
+	mux := http.NewServeMux()
+	mux.Handle("/api/testmodel/", http.StripPrefix("/api/testmodel", crudley.NewPath(&store.TestModel{}, s)))
+	mux.Handle("/generatedidmodel/", http.StripPrefix("/generatedidmodel", crudley.NewPath(&store.GeneratedIDModel{}, s)))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return remote.NewStore(client.New(srv.URL), remote.OptionPath("testmodel", "/api/testmodel"))
+}
+
+func TestSetGet(t *testing.T) {
+	store.TestSetGet(setUp(t), t)
+}
+
+func TestScan(t *testing.T) {
+	store.TestScan(setUp(t), t)
+}
+
+func TestUpdate(t *testing.T) {
+	store.TestUpdate(setUp(t), t)
+}
+
+func TestSearch(t *testing.T) {
+	store.TestSearch(setUp(t), t)
+}
+
+func TestQuery(t *testing.T) {
+	store.TestQuery(setUp(t), t)
+}
+
+func TestCreateWithID(t *testing.T) {
+	store.TestCreateWithID(setUp(t), t)
+}
+
+func TestIDGenerator(t *testing.T) {
+	store.TestIDGenerator(setUp(t), t)
+}
+
+func TestQueryNotEqual(t *testing.T) {
+	s := setUp(t)
+	col, err := s.Collection(&store.TestModel{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		err = col.Create(ctx, func(id string) (crudley.Model, error) {
+			return &store.TestModel{ID: id, Count: i, Val: "a"}, nil
+		})
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+	}
+	q := col.Query()
+	q.NotEqual("count", 1)
+	q.Equal("val", "a")
+	q.Sort("-count")
+	q.Skip(1)
+	q.Limit(2)
+	res, err := q.Execute(ctx)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if len(res) != 2 || res[0].(*store.TestModel).Count != 3 || res[1].(*store.TestModel).Count != 2 {
+		t.Errorf("expected counts 3 and 2, got %+v", res)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	p := crudley.NewPath(&store.TestModel{}, setUp(t))
+	srv := httptest.NewServer(http.StripPrefix("/proxy", p))
+	defer srv.Close()
+	ctx := context.Background()
+	tests := client.NewCollection[*store.TestModel](client.New(srv.URL), "/proxy")
+
+	m, err := tests.Create(ctx, &store.TestModel{Val: "proxied"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	got, err := tests.Get(ctx, m.ID)
+	if err != nil || got.Val != "proxied" {
+		t.Fatalf("expected proxied, got %+v, %v", got, err)
+	}
+	ms, err := tests.List(ctx, client.NewQuery().Equal("val", "proxied"))
+	if err != nil || len(ms) != 1 {
+		t.Errorf("expected 1 model, got %v, %v", len(ms), err)
+	}
+	_, err = tests.Delete(ctx, m.ID)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	ms, err = tests.List(ctx, nil)
+	if err != nil || len(ms) != 0 {
+		t.Errorf("expected no models, got %v, %v", len(ms), err)
+	}
+}
+
+func TestTypedCollection(t *testing.T) {
+	store.TestTypedCollection(setUp(t), t)
+}
+
+type account struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Password string `json:"password" rest:"writeonly"`
+	Deleted  bool   `json:"deleted"`
+}
+
+func (a *account) New(id string) crudley.Model { return &account{ID: id} }
+func (a *account) GetName() string             { return "accounts" }
+func (a *account) PrimaryKey() string          { return a.ID }
+func (a *account) Delete()                     { a.Deleted = true }
+func (a *account) IsDeleted() bool             { return a.Deleted }
+
+func TestUpdateWriteOnly(t *testing.T) {
+	s := mem.NewStore()
+	srv := httptest.NewServer(http.StripPrefix("/accounts", crudley.NewPath(&account{}, s)))
+	defer srv.Close()
+	col, err := remote.NewStore(client.New(srv.URL)).Collection(&account{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	stored, err := s.Collection(&account{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	ctx := context.Background()
+	var id string
+	err = col.Create(ctx, func(newID string) (crudley.Model, error) {
+		id = newID
+		return &account{ID: newID, Name: "alice", Password: "hunter2"}, nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+
+	m, err := col.View(ctx, id)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if m.(*account).Password != "" {
+		t.Fatalf("expected password to be redacted, got %s", m.(*account).Password)
+	}
+	m.(*account).Name = "bob"
+	err = col.Update(ctx, id, m)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	m, err = stored.View(ctx, id)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if a := m.(*account); a.Name != "bob" || a.Password != "hunter2" {
+		t.Errorf("expected bob with password kept, got %+v", a)
+	}
+
+	err = col.Update(ctx, id, &account{ID: id, Name: "bob", Password: "changed"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	m, err = stored.View(ctx, id)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if a := m.(*account); a.Password != "changed" {
+		t.Errorf("expected changed password, got %+v", a)
+	}
+}
@@ -0,0 +1,257 @@
+package crudley
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// TenantResolver identifies the tenant making a request
+type TenantResolver func(r *http.Request) (string, error)
+
+// TenantHeader resolves the tenant from the named request header
+func TenantHeader(name string) TenantResolver {
+	return func(r *http.Request) (string, error) {
+		return r.Header.Get(name), nil
+	}
+}
+
+// TenantContext resolves the tenant set on the request's context by WithTenant,
+// for middleware that authenticates the tenant before the Path
+func TenantContext(r *http.Request) (string, error) {
+	return TenantFromContext(r.Context()), nil
+}
+
+// TenantPrincipal is a Principal that belongs to a tenant
+type TenantPrincipal interface {
+	Principal
+	PrincipalTenant() string
+}
+
+// TenantOfPrincipal resolves the tenant of the request's Principal, which is
+// resolved before the tenant, requests without a TenantPrincipal have no tenant
+func TenantOfPrincipal(r *http.Request) (string, error) {
+	tp, ok := PrincipalFromContext(r.Context()).(TenantPrincipal)
+	if !ok {
+		return "", nil
+	}
+	return tp.PrincipalTenant(), nil
+}
+
+// TenantStoreFunc returns the Store holding a tenant's Models
+type TenantStoreFunc func(ctx context.Context, tenant string) (Store, error)
+
+type tenantKey struct{}
+
+// WithTenant returns a context for requests made by tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set with WithTenant
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// OptionTenant scopes the Path to the tenant identified by resolve, requests
+// without a tenant are rejected. If field is set it is the json name of the
+// Model's tenant field, which is filled in on Models the Path creates, and
+// restricts every read and write to the tenant's own Models.
+func OptionTenant(resolve TenantResolver, field string) Option {
+	return func(p *Path) {
+		p.Tenant = resolve
+		p.TenantField = field
+	}
+}
+
+// OptionTenantStore gives every tenant their own Store, such as a separate
+// database, and requires OptionTenant. The Path's Store is still used to decide
+// which optional endpoints are served, so should be of the same type.
+func OptionTenantStore(fn TenantStoreFunc) Option {
+	return func(p *Path) {
+		p.TenantStore = fn
+	}
+}
+
+// store returns the Store for the request's tenant
+func (p *Path) store(ctx context.Context) (Store, error) {
+	if p.TenantStore == nil {
+		return p.Store, nil
+	}
+	return p.TenantStore(ctx, TenantFromContext(ctx))
+}
+
+// collection returns the Path's Collection, scoped to the request's tenant
+func (p *Path) collection(ctx context.Context, s Store) (Collection, error) {
+	c, err := s.Collection(p.Model)
+	if err != nil {
+		return nil, err
+	}
+	if p.Tenant == nil || p.TenantField == "" {
+		return c, nil
+	}
+	return NewTenantCollection(c, p.TenantField, TenantFromContext(ctx))
+}
+
+// NewTenantCollection wraps c so that it only contains the Models whose field,
+// identified by its json name, is tenant. Models of other tenants are not found,
+// new Models have the field set to tenant, and Updates that change it fail with
+// ErrorTenantMismatch.
+func NewTenantCollection(c Collection, field, tenant string) (Collection, error) {
+	if tenant == "" {
+		return nil, ErrorNoTenant
+	}
+	return &tenantCollection{Collection: c, field: field, tenant: tenant}, nil
+}
+
+type tenantCollection struct {
+	Collection
+	field  string
+	tenant string
+}
+
+// tenantField returns the addressable tenant field of m
+func (c *tenantCollection) tenantField(m Model) (reflect.Value, error) {
+	v := reflect.ValueOf(m)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	f, ok := fieldByJSONName(v, c.field)
+	if !ok || f.Kind() != reflect.String {
+		return reflect.Value{}, fmt.Errorf("%s has no string field %s", m.GetName(), c.field)
+	}
+	return f, nil
+}
+
+func (c *tenantCollection) owns(m Model) bool {
+	f, err := c.tenantField(m)
+	return err == nil && f.String() == c.tenant
+}
+
+func (c *tenantCollection) stamp(m Model) error {
+	f, err := c.tenantField(m)
+	if err != nil {
+		return err
+	}
+	if !f.CanSet() {
+		return fmt.Errorf("%s field %s can't be set", m.GetName(), c.field)
+	}
+	f.SetString(c.tenant)
+	return nil
+}
+
+func (c *tenantCollection) View(ctx context.Context, id string) (Model, error) {
+	m, err := c.Collection.View(ctx, id)
+	if err != nil || m == nil {
+		return m, err
+	}
+	if !c.owns(m) {
+		return nil, nil
+	}
+	return m, nil
+}
+
+func (c *tenantCollection) Update(ctx context.Context, id string, m Model) error {
+	if !c.owns(m) {
+		return ErrorTenantMismatch
+	}
+	existing, err := c.View(ctx, id)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return NotFoundError(fmt.Sprintf("%s %s not found", m.GetName(), id))
+	}
+	return c.Collection.Update(ctx, id, m)
+}
+
+func (c *tenantCollection) Delete(ctx context.Context, id string) error {
+	existing, err := c.View(ctx, id)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return NotFoundError(fmt.Sprintf("%s not found", id))
+	}
+	return c.Collection.Delete(ctx, id)
+}
+
+func (c *tenantCollection) Scan(ctx context.Context, fn ScannerFunc) error {
+	return c.Collection.Scan(ctx, func(m Model) error {
+		if !c.owns(m) {
+			return nil
+		}
+		return fn(m)
+	})
+}
+
+func (c *tenantCollection) Create(ctx context.Context, fn CreaterFunc) error {
+	return c.Collection.Create(ctx, c.creater(fn))
+}
+
+// CreateWithID passes through to the wrapped Collection if it is an IDCreater
+func (c *tenantCollection) CreateWithID(ctx context.Context, id string, fn CreaterFunc) error {
+	ic, ok := c.Collection.(IDCreater)
+	if !ok {
+		return ErrorClientIDUnsupported
+	}
+	return ic.CreateWithID(ctx, id, c.creater(fn))
+}
+
+// creater stamps the tenant on Models created by fn
+func (c *tenantCollection) creater(fn CreaterFunc) CreaterFunc {
+	return func(id string) (Model, error) {
+		m, err := fn(id)
+		if err != nil {
+			return m, err
+		}
+		return m, c.stamp(m)
+	}
+}
+
+func (c *tenantCollection) Search(ctx context.Context, m Model, fn ScannerFunc) (int, error) {
+	err := c.stamp(m)
+	if err != nil {
+		return 0, err
+	}
+	return c.Collection.Search(ctx, m, fn)
+}
+
+func (c *tenantCollection) Query() Query {
+	q := c.Collection.Query()
+	q.Equal(c.field, c.tenant)
+	return &tenantQuery{Query: q, c: c}
+}
+
+// tenantQuery ignores predicates on the tenant field, as Stores differ in how
+// they combine several predicates on the same field
+type tenantQuery struct {
+	Query
+	c *tenantCollection
+}
+
+func (q *tenantQuery) Equal(key string, val interface{}) {
+	if key != q.c.field {
+		q.Query.Equal(key, val)
+	}
+}
+
+func (q *tenantQuery) NotEqual(key string, val interface{}) {
+	if key != q.c.field {
+		q.Query.NotEqual(key, val)
+	}
+}
+
+func (q *tenantQuery) GreaterThan(key string, val interface{}) {
+	if key != q.c.field {
+		q.Query.GreaterThan(key, val)
+	}
+}
+
+func (q *tenantQuery) LessThan(key string, val interface{}) {
+	if key != q.c.field {
+		q.Query.LessThan(key, val)
+	}
+}
@@ -0,0 +1,205 @@
+package crudley_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+func tenantRequest(method, URL, tenant string, body io.Reader) (model.TestModelResponse, int, error) {
+	tmr := model.TestModelResponse{}
+	r, err := http.NewRequest(method, URL, body)
+	if err != nil {
+		return tmr, 0, err
+	}
+	if tenant != "" {
+		r.Header.Set("X-Tenant", tenant)
+	}
+	return doRequest(r)
+}
+
+func doRequest(r *http.Request) (model.TestModelResponse, int, error) {
+	tmr := model.TestModelResponse{}
+	res, err := client.Do(r)
+	if err != nil {
+		return tmr, 0, err
+	}
+	defer res.Body.Close()
+	tmr.RawResponse, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return tmr, res.StatusCode, err
+	}
+	err = json.Unmarshal(tmr.RawResponse, &tmr)
+	return tmr, res.StatusCode, err
+}
+
+func TestTenant(t *testing.T) {
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore(), crudley.OptionTenant(crudley.TenantHeader("X-Tenant"), "owner"))
+	s := httptest.NewServer(http.StripPrefix("/api/test", p))
+	defer s.Close()
+	URL := s.URL + "/api/test/"
+
+	_, code, err := tenantRequest("GET", URL, "", nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %v", code)
+	}
+
+	tmr, _, err := tenantRequest("POST", URL, "a", bytes.NewBufferString(`{"string_val": "a's", "owner": "b"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	if tmr.Results[0].Owner != "a" {
+		t.Errorf("expected owner a, got %s", tmr.Results[0].Owner)
+	}
+	aID := tmr.Results[0].ID
+	tmr, _, err = tenantRequest("POST", URL, "b", bytes.NewBufferString(`{"string_val": "b's"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	bID := tmr.Results[0].ID
+
+	for query, n := range map[string]int{"": 1, "?owner=b": 1, "?string_val=b's": 0} {
+		tmr, _, err = tenantRequest("GET", URL+query, "a", nil)
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		if len(tmr.Results) != n {
+			t.Errorf("expected %v results for %q, got %v", n, query, len(tmr.Results))
+		}
+		for _, m := range tmr.Results {
+			if m.Owner != "a" {
+				t.Errorf("expected only a's models for %q, got %+v", query, m)
+			}
+		}
+	}
+
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		_, code, err := tenantRequest(method, URL+bID, "a", bytes.NewBufferString(`{"int_val": 1}`))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		if code != http.StatusNotFound {
+			t.Errorf("expected 404 for %s, got %v", method, code)
+		}
+	}
+
+	_, code, err = tenantRequest("PUT", URL+aID, "a", bytes.NewBufferString(`{"owner": "b"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if code != http.StatusForbidden {
+		t.Errorf("expected 403, got %v", code)
+	}
+	tmr, code, err = tenantRequest("GET", URL+aID, "a", nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if code != http.StatusOK || tmr.Results[0].Owner != "a" {
+		t.Errorf("expected a's model, got %v %+v", code, tmr.Results)
+	}
+}
+
+func TestTenantUpsert(t *testing.T) {
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore(),
+		crudley.OptionTenant(crudley.TenantHeader("X-Tenant"), "owner"),
+		crudley.OptionUpsert,
+	)
+	s := httptest.NewServer(p)
+	defer s.Close()
+
+	tmr, code, err := tenantRequest("PUT", s.URL+"/shared", "a", bytes.NewBufferString(`{"string_val": "a's"}`))
+	if err != nil || code != http.StatusCreated {
+		t.Fatalf("expected 201, got %v, %v - %s", code, err, string(tmr.RawResponse))
+	}
+	// the id is taken by a's Model, which b can't tell exists
+	_, code, err = tenantRequest("PUT", s.URL+"/shared", "b", bytes.NewBufferString(`{"string_val": "b's"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if code != http.StatusNotFound {
+		t.Errorf("expected 404, got %v", code)
+	}
+	tmr, _, err = tenantRequest("GET", s.URL+"/shared", "a", nil)
+	if err != nil || len(tmr.Results) != 1 || tmr.Results[0].StringVal != "a's" {
+		t.Errorf("expected a's, got %+v, %v", tmr.Results, err)
+	}
+}
+
+func TestTenantStore(t *testing.T) {
+	stores := map[string]crudley.Store{"a": mem.NewStore(), "b": mem.NewStore()}
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore(),
+		crudley.OptionTenant(crudley.TenantHeader("X-Tenant"), ""),
+		crudley.OptionTenantStore(func(ctx context.Context, tenant string) (crudley.Store, error) {
+			s, ok := stores[tenant]
+			if !ok {
+				return nil, fmt.Errorf("unknown tenant %s", tenant)
+			}
+			return s, nil
+		}),
+	)
+	s := httptest.NewServer(http.StripPrefix("/api/test", p))
+	defer s.Close()
+	URL := s.URL + "/api/test/"
+
+	tmr, _, err := tenantRequest("POST", URL, "a", bytes.NewBufferString(`{"string_val": "a's"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+	}
+	aID := tmr.Results[0].ID
+
+	_, code, err := tenantRequest("GET", URL+aID, "b", nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if code != http.StatusNotFound {
+		t.Errorf("expected 404, got %v", code)
+	}
+	c, err := stores["a"].Collection(&model.TestModel{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	m, err := c.View(context.Background(), aID)
+	if err != nil || m == nil {
+		t.Errorf("expected a's model in a's store, got %v, %v", m, err)
+	}
+}
+
+func TestTenantStoreError(t *testing.T) {
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore(),
+		crudley.OptionTenant(crudley.TenantHeader("X-Tenant"), ""),
+		crudley.OptionTenantStore(func(ctx context.Context, tenant string) (crudley.Store, error) {
+			return nil, fmt.Errorf("unknown tenant %s", tenant)
+		}),
+	)
+	s := httptest.NewServer(http.StripPrefix("/api/test", p))
+	defer s.Close()
+
+	for i := 0; i < 2; i++ {
+		r, err := http.NewRequest("POST", s.URL+"/api/test/", bytes.NewBufferString(`{"string_val": "c's"}`))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		r.Header.Set("X-Tenant", "c")
+		r.Header.Set(crudley.IdempotencyKeyHeader, "key")
+		tmr, code, err := doRequest(r)
+		if err != nil {
+			t.Fatalf("expected nil, got %s - %s", err, string(tmr.RawResponse))
+		}
+		if code != http.StatusInternalServerError || tmr.Error == "" {
+			t.Errorf("expected 500 with an error, got %v %q", code, tmr.Error)
+		}
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 var AuthoriseFunc func(ctx context.Context, action crudley.Action, m *TestModel) error
 
+var AuthoriseQueryFunc func(ctx context.Context, q crudley.Query) error
+
 // TestModel is a testing implementation of the Model interface
 type TestModel struct {
 	ID        string    `json:"id" bson:"id,omitempty" rest:"immutable"`
@@ -51,6 +53,11 @@ func (m *TestModel) IsDeleted() bool {
 	return m.Deleted
 }
 
+// Restore unmarks the TestModel as deleted
+func (m *TestModel) Restore() {
+	m.Deleted = false
+}
+
 func (m *TestModel) Authorise(ctx context.Context, action crudley.Action) error {
 	if AuthoriseFunc == nil {
 		return nil
@@ -58,10 +65,27 @@ func (m *TestModel) Authorise(ctx context.Context, action crudley.Action) error
 	return AuthoriseFunc(ctx, action, m)
 }
 
+func (m *TestModel) AuthoriseQuery(ctx context.Context, q crudley.Query) error {
+	if AuthoriseQueryFunc == nil {
+		return nil
+	}
+	return AuthoriseQueryFunc(ctx, q)
+}
+
 // TestModelResponse is a response implementation for easy testing of the http
 // handlers
 type TestModelResponse struct {
 	RawResponse []byte
-	Results     []*TestModel `json:"results"`
-	Error       string       `json:"error"`
+	Results     []*TestModel      `json:"results"`
+	Batch       []TestBatchResult `json:"batch"`
+	Error       string            `json:"error"`
+}
+
+// TestBatchResult is the result of a single batch operation for a TestModel
+type TestBatchResult struct {
+	Op     string     `json:"op"`
+	ID     string     `json:"id"`
+	Status int        `json:"status"`
+	Result *TestModel `json:"result"`
+	Error  string     `json:"error"`
 }
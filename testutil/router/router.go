@@ -0,0 +1,91 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/client"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+// TestRouter checks that a Path created with opt, which sets its Router, serves
+// all of its routes and reads their parameters
+func TestRouter(opt crudley.Option, t *testing.T) {
+	p := crudley.NewPath(&model.TestModel{}, mem.NewStore(), opt, crudley.OptionHistory)
+	s := httptest.NewServer(http.StripPrefix("/api/test", p))
+	defer s.Close()
+	ctx := context.Background()
+	tests := client.NewCollection[*model.TestModel](client.New(s.URL), "/api/test")
+
+	m, err := tests.Create(ctx, &model.TestModel{StringVal: "v1"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	_, err = tests.Update(ctx, m.ID, &model.TestModel{StringVal: "v2"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	got, err := tests.Get(ctx, m.ID)
+	if err != nil || got.StringVal != "v2" {
+		t.Fatalf("expected v2, got %+v, %v", got, err)
+	}
+	ms, err := tests.List(ctx, client.NewQuery().Equal("string_val", "v2"))
+	if err != nil || len(ms) != 1 {
+		t.Errorf("expected 1 model, got %v, %v", len(ms), err)
+	}
+
+	var history struct {
+		Results []crudley.Revision `json:"results"`
+	}
+	res, err := http.Get(fmt.Sprintf("%s/api/test/%s/_history/1", s.URL, m.ID))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	err = json.NewDecoder(res.Body).Decode(&history)
+	res.Body.Close()
+	if err != nil || len(history.Results) != 1 || history.Results[0].Rev != 1 || history.Results[0].DocID != m.ID {
+		t.Errorf("expected revision 1 of %s, got %+v, %v", m.ID, history.Results, err)
+	}
+
+	_, err = tests.Delete(ctx, m.ID)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	m, err = tests.Restore(ctx, m.ID)
+	if err != nil || m.Deleted {
+		t.Errorf("expected restored model, got %+v, %v", m, err)
+	}
+	_, err = tests.Get(ctx, "missing")
+	if !errors.Is(err, client.ErrorNotFound) {
+		t.Errorf("expected %s, got %v", client.ErrorNotFound, err)
+	}
+
+	res, err = http.Get(s.URL + "/api/test/_schema")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(res.Header.Get("Content-Type"), "schema+json") {
+		t.Errorf("expected the schema, got %v %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	req, err := http.NewRequest(http.MethodPatch, s.URL+"/api/test/"+m.ID, nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %v", res.StatusCode)
+	}
+}
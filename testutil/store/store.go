@@ -198,6 +198,271 @@ func TestQuery(store crudley.Store, t *testing.T) {
 	if res[0].(*TestModel).Val != "testing123" {
 		t.Errorf("expected testing1234, got %s", err)
 	}
+	// Equal predicates on the same field match any of the values
+	q = col.Query()
+	q.Equal("val", "testing123")
+	q.Equal("val", "testing1234")
+	res, err = q.Execute(context.Background())
+	if err != nil {
+		t.Errorf("expected nil, got %s", err)
+	}
+	if len(res) != 2 {
+		t.Errorf("expected 2, got %v", len(res))
+	}
+	q = col.Query()
+	q.GreaterThan("val", "testing123")
+	res, err = q.Execute(context.Background())
+	if err != nil {
+		t.Errorf("expected nil, got %s", err)
+	}
+	if len(res) != 1 || res[0].(*TestModel).Val != "testing1234" {
+		t.Errorf("expected testing1234, got %v", res)
+	}
+}
+
+func TestTransaction(store crudley.Store, t *testing.T) {
+	var model = &TestModel{}
+	col, err := store.Collection(model)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	var fromID, toID string
+	col.Create(context.Background(), func(id string) (crudley.Model, error) {
+		fromID = id
+		md := model.New(id)
+		md.(*TestModel).Count = 10
+		return md, nil
+	})
+	col.Create(context.Background(), func(id string) (crudley.Model, error) {
+		toID = id
+		md := model.New(id)
+		md.(*TestModel).Count = 0
+		return md, nil
+	})
+	transfer := func(n int) crudley.TransactionFunc {
+		return func(ctx context.Context, tx crudley.Store) error {
+			txCol, err := tx.Collection(model)
+			if err != nil {
+				return err
+			}
+			from, err := txCol.View(ctx, fromID)
+			if err != nil {
+				return err
+			}
+			to, err := txCol.View(ctx, toID)
+			if err != nil {
+				return err
+			}
+			from.(*TestModel).Count -= n
+			to.(*TestModel).Count += n
+			if from.(*TestModel).Count < 0 {
+				return fmt.Errorf("insufficient count")
+			}
+			err = txCol.Update(ctx, fromID, from)
+			if err != nil {
+				return err
+			}
+			return txCol.Update(ctx, toID, to)
+		}
+	}
+	err = crudley.RunInTransaction(context.Background(), store, transfer(4))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	err = crudley.RunInTransaction(context.Background(), store, transfer(7))
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	from, err := col.View(context.Background(), fromID)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if from.(*TestModel).Count != 6 {
+		t.Errorf("expected 6, got %v", from.(*TestModel).Count)
+	}
+	to, err := col.View(context.Background(), toID)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if to.(*TestModel).Count != 4 {
+		t.Errorf("expected 4, got %v", to.(*TestModel).Count)
+	}
+
+	// a write outside of the transaction causes it to conflict and be retried
+	var attempts int
+	err = crudley.RunInTransaction(context.Background(), store, func(ctx context.Context, tx crudley.Store) error {
+		attempts++
+		txCol, err := tx.Collection(model)
+		if err != nil {
+			return err
+		}
+		m, err := txCol.View(ctx, fromID)
+		if err != nil {
+			return err
+		}
+		if attempts == 1 {
+			err = col.Update(ctx, fromID, &TestModel{ID: fromID, Count: 100})
+			if err != nil {
+				return err
+			}
+		}
+		m.(*TestModel).Count++
+		return txCol.Update(ctx, fromID, m)
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2, got %v", attempts)
+	}
+	from, err = col.View(context.Background(), fromID)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if from.(*TestModel).Count != 101 {
+		t.Errorf("expected 101, got %v", from.(*TestModel).Count)
+	}
+}
+
+func TestCreateWithID(store crudley.Store, t *testing.T) {
+	var model = &TestModel{}
+	col, err := store.Collection(model)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	ic, ok := col.(crudley.IDCreater)
+	if !ok {
+		t.Fatalf("expected crudley.IDCreater, got %T", col)
+	}
+	err = ic.CreateWithID(context.Background(), "natural-key", func(id string) (crudley.Model, error) {
+		md := model.New(id)
+		md.(*TestModel).Val = "testing123"
+		return md, nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	err = ic.CreateWithID(context.Background(), "natural-key", func(id string) (crudley.Model, error) {
+		md := model.New(id)
+		md.(*TestModel).Val = "testing1234"
+		return md, nil
+	})
+	if _, ok := err.(crudley.ConflictError); !ok {
+		t.Fatalf("expected crudley.ConflictError, got %v", err)
+	}
+	newModel, err := col.View(context.Background(), "natural-key")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if newModel.(*TestModel).Val != "testing123" {
+		t.Fatalf("expected testing123, got %s", newModel.(*TestModel).Val)
+	}
+}
+
+func TestIDGenerator(store crudley.Store, t *testing.T) {
+	col, err := store.Collection(&GeneratedIDModel{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	var modelID string
+	err = col.Create(context.Background(), func(id string) (crudley.Model, error) {
+		modelID = id
+		return &GeneratedIDModel{TestModel{ID: id}}, nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if modelID != "generated" {
+		t.Errorf("expected generated, got %s", modelID)
+	}
+	ctx := crudley.WithIDGenerator(context.Background(), crudley.IDGeneratorFunc(func() string {
+		return "from-context"
+	}))
+	err = col.Create(ctx, func(id string) (crudley.Model, error) {
+		modelID = id
+		return &GeneratedIDModel{TestModel{ID: id}}, nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if modelID != "from-context" {
+		t.Errorf("expected from-context, got %s", modelID)
+	}
+	mdl, err := col.View(context.Background(), "from-context")
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if mdl == nil {
+		t.Fatalf("expected model, got nil")
+	}
+}
+
+func TestTypedCollection(store crudley.Store, t *testing.T) {
+	col, err := crudley.NewTypedCollection[*TestModel](store)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err = col.Create(ctx, func(id string) (*TestModel, error) {
+			return &TestModel{ID: id, Val: "typed", Count: i}, nil
+		})
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+	}
+	res, err := col.Query().Equal("val", "typed").GreaterThan("count", 0).Sort("-count").Execute(ctx)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if len(res) != 2 || res[0].Count != 2 || res[1].Count != 1 {
+		t.Fatalf("expected counts 2 and 1, got %+v", res)
+	}
+	m, err := col.View(ctx, res[0].ID)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	m.Val = "updated"
+	err = col.Update(ctx, m)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	var found []*TestModel
+	_, err = col.Search(ctx, &TestModel{Val: "updated"}, func(m *TestModel) error {
+		found = append(found, m)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if len(found) != 1 || found[0].ID != m.ID {
+		t.Errorf("expected %s, got %+v", m.ID, found)
+	}
+	err = col.Delete(ctx, m.ID)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	_, err = col.View(ctx, m.ID)
+	if _, ok := err.(crudley.NotFoundError); !ok {
+		t.Errorf("expected crudley.NotFoundError, got %v", err)
+	}
+}
+
+// GeneratedIDModel is a TestModel that generates its own IDs
+type GeneratedIDModel struct {
+	TestModel
+}
+
+func (m *GeneratedIDModel) New(id string) crudley.Model {
+	return &GeneratedIDModel{TestModel{ID: id}}
+}
+
+func (m *GeneratedIDModel) GetName() string {
+	return "generatedidmodel"
+}
+
+func (m *GeneratedIDModel) GenerateID() string {
+	return "generated"
 }
 
 type TestModel struct {
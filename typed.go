@@ -0,0 +1,212 @@
+package crudley
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// newModel returns a new T, allocating the struct T points to so that Models
+// needn't be constructed with Model.New
+func newModel[T Model]() T {
+	var m T
+	t := reflect.TypeOf(&m).Elem()
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()).Interface().(T)
+	}
+	return m
+}
+
+// asModel asserts that m, returned by a Store, is a T
+func asModel[T Model](m Model) (T, error) {
+	t, ok := m.(T)
+	if !ok {
+		return t, fmt.Errorf("expected %T, got %T", t, m)
+	}
+	return t, nil
+}
+
+// NewTypedPath returns a Path serving Models of type T, which is usually a
+// pointer to a struct
+//
+//	p := crudley.NewTypedPath[*Incident](s)
+func NewTypedPath[T Model](s Store, opts ...Option) *Path {
+	return NewPath(newModel[T](), s, opts...)
+}
+
+// TypedCollection wraps a Collection of Models of type T, taking and returning
+// T rather than Model so that callers needn't type assert
+type TypedCollection[T Model] struct {
+	c Collection
+}
+
+// NewTypedCollection returns the Collection of Models of type T from s
+//
+//	incidents, err := crudley.NewTypedCollection[*Incident](s)
+func NewTypedCollection[T Model](s Store) (*TypedCollection[T], error) {
+	c, err := s.Collection(newModel[T]())
+	if err != nil {
+		return nil, err
+	}
+	return &TypedCollection[T]{c: c}, nil
+}
+
+// Collection returns the wrapped Collection
+func (c *TypedCollection[T]) Collection() Collection {
+	return c.c
+}
+
+// View retrieves the Model with the id, returning a NotFoundError if it doesn't
+// exist
+func (c *TypedCollection[T]) View(ctx context.Context, id string) (T, error) {
+	var zero T
+	m, err := c.c.View(ctx, id)
+	if err != nil {
+		return zero, err
+	}
+	if m == nil {
+		return zero, NotFoundError("Model " + id + " not found")
+	}
+	return asModel[T](m)
+}
+
+// Update saves m, by its PrimaryKey
+func (c *TypedCollection[T]) Update(ctx context.Context, m T) error {
+	return c.c.Update(ctx, m.PrimaryKey(), m)
+}
+
+// Delete removes the Model with the id
+func (c *TypedCollection[T]) Delete(ctx context.Context, id string) error {
+	return c.c.Delete(ctx, id)
+}
+
+// Create creates the Model returned by fn for a generated ID, returning it
+func (c *TypedCollection[T]) Create(ctx context.Context, fn func(id string) (T, error)) (T, error) {
+	var out T
+	err := c.c.Create(ctx, func(id string) (Model, error) {
+		var err error
+		out, err = fn(id)
+		return out, err
+	})
+	return out, err
+}
+
+// CreateWithID creates the Model returned by fn with the id, returning
+// ErrorClientIDUnsupported if the Collection doesn't implement IDCreater
+func (c *TypedCollection[T]) CreateWithID(ctx context.Context, id string, fn func(id string) (T, error)) (T, error) {
+	var out T
+	ic, ok := c.c.(IDCreater)
+	if !ok {
+		return out, ErrorClientIDUnsupported
+	}
+	err := ic.CreateWithID(ctx, id, func(id string) (Model, error) {
+		var err error
+		out, err = fn(id)
+		return out, err
+	})
+	return out, err
+}
+
+// Scan calls fn for every Model in the Collection
+func (c *TypedCollection[T]) Scan(ctx context.Context, fn func(T) error) error {
+	return c.c.Scan(ctx, func(m Model) error {
+		t, err := asModel[T](m)
+		if err != nil {
+			return err
+		}
+		return fn(t)
+	})
+}
+
+// Search calls fn for every Model matching the set fields of partial
+func (c *TypedCollection[T]) Search(ctx context.Context, partial T, fn func(T) error) (int, error) {
+	return c.c.Search(ctx, partial, func(m Model) error {
+		t, err := asModel[T](m)
+		if err != nil {
+			return err
+		}
+		return fn(t)
+	})
+}
+
+// Query returns a TypedQuery of the Collection
+func (c *TypedCollection[T]) Query() *TypedQuery[T] {
+	return &TypedQuery[T]{q: c.c.Query()}
+}
+
+// TypedQuery wraps a Query of Models of type T, its methods can be chained
+//
+//	open, err := incidents.Query().Equal("closed", false).Sort("-created").Limit(10).Execute(ctx)
+type TypedQuery[T Model] struct {
+	q Query
+}
+
+// Query returns the wrapped Query
+func (q *TypedQuery[T]) Query() Query {
+	return q.q
+}
+
+// Equal adds an Equal predicate
+func (q *TypedQuery[T]) Equal(key string, val interface{}) *TypedQuery[T] {
+	q.q.Equal(key, val)
+	return q
+}
+
+// NotEqual adds a NotEqual predicate
+func (q *TypedQuery[T]) NotEqual(key string, val interface{}) *TypedQuery[T] {
+	q.q.NotEqual(key, val)
+	return q
+}
+
+// GreaterThan adds a GreaterThan predicate
+func (q *TypedQuery[T]) GreaterThan(key string, val interface{}) *TypedQuery[T] {
+	q.q.GreaterThan(key, val)
+	return q
+}
+
+// LessThan adds a LessThan predicate
+func (q *TypedQuery[T]) LessThan(key string, val interface{}) *TypedQuery[T] {
+	q.q.LessThan(key, val)
+	return q
+}
+
+// Limit returns at most n results
+func (q *TypedQuery[T]) Limit(n int) *TypedQuery[T] {
+	q.q.Limit(n)
+	return q
+}
+
+// Skip skips the first n results
+func (q *TypedQuery[T]) Skip(n int) *TypedQuery[T] {
+	q.q.Skip(n)
+	return q
+}
+
+// Sort orders the results by the field, prefix it with - for descending order
+func (q *TypedQuery[T]) Sort(by string) *TypedQuery[T] {
+	q.q.Sort(by)
+	return q
+}
+
+// Has matches Models where the field is set
+func (q *TypedQuery[T]) Has(key string) *TypedQuery[T] {
+	q.q.Has(key)
+	return q
+}
+
+// Execute runs the Query
+func (q *TypedQuery[T]) Execute(ctx context.Context) ([]T, error) {
+	models, err := q.q.Execute(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]T, 0, len(models))
+	for _, m := range models {
+		t, err := asModel[T](m)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
@@ -0,0 +1,58 @@
+package crudley_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+)
+
+func TestTypedPath(t *testing.T) {
+	s := mem.NewStore()
+	p := crudley.NewTypedPath[*model.TestModel](s, crudley.OptionHardDelete)
+	if p.Model.GetName() != "testmodel" || !p.HardDelete {
+		t.Errorf("expected a hard deleting testmodel Path, got %+v", p)
+	}
+	srv := httptest.NewServer(http.StripPrefix("/api/test", p))
+	defer srv.Close()
+	ctx := context.Background()
+
+	res, err := http.Post(srv.URL+"/api/test/", "application/json", strings.NewReader(`{"string_val": "typed"}`))
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	defer res.Body.Close()
+	var created model.TestModelResponse
+	err = json.NewDecoder(res.Body).Decode(&created)
+	if err != nil || len(created.Results) != 1 {
+		t.Fatalf("expected a created model, got %+v, %v", created, err)
+	}
+	tests, err := crudley.NewTypedCollection[*model.TestModel](s)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	m, err := tests.View(ctx, created.Results[0].ID)
+	if err != nil || m.StringVal != "typed" {
+		t.Errorf("expected typed, got %+v, %v", m, err)
+	}
+	m, err = tests.CreateWithID(ctx, "natural-key", func(id string) (*model.TestModel, error) {
+		return &model.TestModel{ID: id, IntVal: 1}, nil
+	})
+	if err != nil || m.ID != "natural-key" {
+		t.Errorf("expected natural-key, got %+v, %v", m, err)
+	}
+	var n int
+	err = tests.Scan(ctx, func(m *model.TestModel) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 2 {
+		t.Errorf("expected 2 models, got %v, %v", n, err)
+	}
+}
@@ -22,12 +22,70 @@ type Model interface {
 	IsDeleted() bool
 }
 
+// Restorer is an optional interface for Models that can be restored after being
+// marked as deleted
+type Restorer interface {
+	// Restore reverses the effect of Model.Delete
+	Restore()
+}
+
+// Authoriser is an optional interface for Models that control access to
+// themselves. Updates are authorised twice, first against the stored Model, then
+// against the Model with the request's changes applied, and Action.Previous and
+// Action.Changes set.
 type Authoriser interface {
 	Authorise(ctx context.Context, action Action) error
 }
 
+// ModelAuthoriser authorises Actions on Models of any type, see
+// OptionAuthoriser. It is called in addition to a Model's own Authoriser.
+type ModelAuthoriser interface {
+	AuthoriseModel(ctx context.Context, m Model, action Action) error
+}
+
+// ModelQueryAuthoriser is an optional interface for ModelAuthorisers that add
+// predicates to Queries, like QueryAuthoriser. m is the Path's Model.
+type ModelQueryAuthoriser interface {
+	AuthoriseModelQuery(ctx context.Context, m Model, q Query) error
+}
+
+// QueryAuthoriser is an optional interface for Models that restrict which Models
+// can be listed by adding predicates to the Query, which is more efficient than
+// the Authoriser check each result is also subject to
+type QueryAuthoriser interface {
+	AuthoriseQuery(ctx context.Context, q Query) error
+}
+
+// Operation kinds for an Action
+const (
+	OpGet     = "get"
+	OpList    = "list"
+	OpCreate  = "create"
+	OpUpdate  = "update"
+	OpDelete  = "delete"
+	OpRestore = "restore"
+	OpBatch   = "batch"
+)
+
+// Action describes what a request is doing to a Model, for an Authoriser
 type Action struct {
 	Method string
+	// Op is the kind of operation, e.g. OpList for a Query or OpGet for a Get
+	Op string
+	// Request is the http request being served
+	Request *http.Request
+	// Principal is the user making the request, see OptionPrincipal
+	Principal Principal
+	// Previous is the stored version of a Model being updated, the Model being
+	// authorised has the changes from the request applied
+	Previous Model
+	// Changes are the json names of the top level fields an update changes
+	Changes []string
+	// IncludeDeleted is set when a query asks to include deleted Models
+	IncludeDeleted bool
+	// Partial is set when the Model isn't a stored or submitted Model, such as one
+	// built from query parameters, so only the Action itself can be authorised
+	Partial bool
 }
 
 // Collection represents a set of Models from a Store. this handles Model creation
@@ -52,7 +110,16 @@ type Collection interface {
 	Query() Query
 }
 
-// Query represents a way to build advanced queries on a Collection, each method adding a predicate to the query
+// IDCreater is an optional interface for Collections that can create a Model
+// with a caller supplied ID, rather than generating one. CreateWithID returns a
+// ConflictError if a Model with the ID already exists.
+type IDCreater interface {
+	CreateWithID(ctx context.Context, id string, fn CreaterFunc) error
+}
+
+// Query represents a way to build advanced queries on a Collection, each method adding a predicate to the query.
+// Equal predicates on the same key match Models equal to any of their values, so a request for ?val=a&val=b
+// matches Models where val is a or b.
 type Query interface {
 	Equal(key string, val interface{})
 	NotEqual(key string, val interface{})
@@ -74,6 +141,32 @@ type Store interface {
 	Collection(m Model) (Collection, error)
 }
 
+// Transactor is an optional interface for Stores that are able to run multiple
+// operations atomically. Collections retrieved from the Store passed to the
+// TransactionFunc are scoped to the transaction, and their changes are only
+// persisted if the TransactionFunc returns nil. Implementations retry the
+// TransactionFunc automatically on contention, so it may be called more than once
+// and should not have side effects outside of the transaction.
+//
+// The mem and firestore Stores implement Transactor. The mongo Store doesn't, as
+// its driver has no multi-document transactions.
+type Transactor interface {
+	RunInTransaction(ctx context.Context, fn TransactionFunc) error
+}
+
+// TransactionFunc is run by a Transactor, tx is a transaction scoped Store
+type TransactionFunc func(ctx context.Context, tx Store) error
+
+// RunInTransaction runs fn in a transaction if the Store implements Transactor,
+// otherwise it returns ErrorTransactionsUnsupported
+func RunInTransaction(ctx context.Context, s Store, fn TransactionFunc) error {
+	t, ok := s.(Transactor)
+	if !ok {
+		return ErrorTransactionsUnsupported
+	}
+	return t.RunInTransaction(ctx, fn)
+}
+
 // ScannerFunc is used to iterate over Models for queries. they are used in the
 // multiple Model response handlers. depending on the Store implementation Query
 // may use a ScannerFunc to filter an entire collection of Models, if the database
@@ -94,6 +187,50 @@ func (e NotFoundError) Error() string {
 	return string(e)
 }
 
+// IDGenerator creates IDs for new Models. A Model can implement IDGenerator to
+// control its own IDs, or one can be set for a Path with OptionIDGenerator. The
+// ids package contains a number of built in generators.
+type IDGenerator interface {
+	GenerateID() string
+}
+
+// IDGeneratorFunc adapts a function to the IDGenerator interface
+type IDGeneratorFunc func() string
+
+// GenerateID calls f
+func (f IDGeneratorFunc) GenerateID() string {
+	return f()
+}
+
+type idGeneratorKey struct{}
+
+// WithIDGenerator returns a context that makes Collection.Create use g to
+// generate IDs, in preference to the Model's own IDGenerator
+func WithIDGenerator(ctx context.Context, g IDGenerator) context.Context {
+	return context.WithValue(ctx, idGeneratorKey{}, g)
+}
+
+// GenerateID should be used by Collection.Create implementations to generate
+// IDs. It uses the IDGenerator from ctx if one is set, then m if it implements
+// IDGenerator, and otherwise the Store's own fallback.
+func GenerateID(ctx context.Context, m Model, fallback IDGenerator) string {
+	if g, ok := ctx.Value(idGeneratorKey{}).(IDGenerator); ok {
+		return g.GenerateID()
+	}
+	if g, ok := m.(IDGenerator); ok {
+		return g.GenerateID()
+	}
+	return fallback.GenerateID()
+}
+
+// ConflictError is returned when a store cannot create a document because one
+// with the same ID already exists
+type ConflictError string
+
+func (e ConflictError) Error() string {
+	return string(e)
+}
+
 func NewBase(id string) Base {
 	return Base{ID: id, CreatedAt: time.Now()}
 }
@@ -115,7 +252,6 @@ func (b *Base) New(id string) Model {
 // GetName should be overridden to return the name of your collection
 func (b *Base) GetName() string {
 	panic("must override Name() on Base model")
-	return "base"
 }
 
 func (b *Base) PrimaryKey() string {
@@ -130,3 +266,8 @@ func (b *Base) Delete() {
 func (b *Base) IsDeleted() bool {
 	return b.Deleted
 }
+
+func (b *Base) Restore() {
+	b.Deleted = false
+	b.DeletedAt = time.Time{}
+}
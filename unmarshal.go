@@ -10,50 +10,42 @@ const (
 	structFieldImmutable = "immutable"
 )
 
-// RestrictedModel wraps a Model to provide immutability of fields from users
+// RestrictedModel wraps a Model to prevent users setting fields they don't have
+// permission to write. Roles are the roles of the user, see OptionRoles.
 type RestrictedModel struct {
 	Model
+	Roles []string
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface, but ignores fields
-// marked with the struct tag rest:"immutable"
+// marked with the struct tag rest:"immutable", "readonly" or "private", and those
+// with a rest:"write=<roles>" tag that don't include one of the Roles
 func (r *RestrictedModel) UnmarshalJSON(buf []byte) error {
 	m := r.Model
-	err := json.Unmarshal(buf, m)
-	if err != nil {
-		return err
+	v := reflect.ValueOf(m).Elem()
+	type kept struct {
+		index []int
+		val   reflect.Value
 	}
-	defaults := getDefaults(reflect.ValueOf(m).Elem())
-	setDefaults(reflect.ValueOf(m).Elem(), defaults)
-	return nil
-}
-
-func getDefaults(val reflect.Value) map[int]interface{} {
-	var defaults = make(map[int]interface{})
-	valType := val.Type()
-	for i := 0; i < val.NumField(); i++ {
-		valFieldType := valType.Field(i)
-		valFieldValue := val.Field(i)
-		if valFieldType.Tag.Get(structTagRest) == structFieldImmutable {
-			defaults[i] = valFieldValue.Interface()
-		} else if valFieldValue.Kind() == reflect.Struct {
-			defaults[i] = getDefaults(valFieldValue)
+	var restore []kept
+	for _, f := range fieldPerms(v.Type()) {
+		if f.canWrite(r.Roles) {
+			continue
 		}
-	}
-	return defaults
-}
-
-func setDefaults(val reflect.Value, defaults map[int]interface{}) {
-	vt := val.Type()
-	for i, fieldDefault := range defaults {
-		fv := val.Field(i)
-		ft := vt.Field(i)
-		if ft.Tag.Get(structTagRest) == structFieldImmutable {
-			if fv.CanSet() {
-				fv.Set(reflect.ValueOf(fieldDefault))
-			}
-		} else if fv.Kind() == reflect.Struct {
-			setDefaults(fv, defaults[i].(map[int]interface{}))
+		fv := v.FieldByIndex(f.index)
+		if !fv.CanSet() {
+			continue
 		}
+		// the field is zeroed so that json can't modify a map or slice it
+		// shares with the original value
+		orig := reflect.New(fv.Type()).Elem()
+		orig.Set(fv)
+		fv.Set(reflect.Zero(fv.Type()))
+		restore = append(restore, kept{f.index, orig})
+	}
+	err := json.Unmarshal(buf, m)
+	for _, k := range restore {
+		v.FieldByIndex(k.index).Set(k.val)
 	}
+	return err
 }
@@ -0,0 +1,52 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/arussellsaw/crudley"
+)
+
+// Delivery records the sending of a change event to an Endpoint
+type Delivery struct {
+	ID             string    `json:"id" bson:"_id" firestore:"id"`
+	Endpoint       string    `json:"endpoint" bson:"endpoint" firestore:"endpoint"`
+	URL            string    `json:"url" bson:"url" firestore:"url"`
+	Model          string    `json:"model" bson:"model" firestore:"model"`
+	ModelID        string    `json:"model_id" bson:"model_id" firestore:"model_id"`
+	Event          string    `json:"event" bson:"event" firestore:"event"`
+	Payload        []byte    `json:"payload" bson:"payload" firestore:"payload"`
+	Status         string    `json:"status" bson:"status" firestore:"status"`
+	Attempts       int       `json:"attempts" bson:"attempts" firestore:"attempts"`
+	ResponseStatus int       `json:"response_status" bson:"response_status" firestore:"response_status"`
+	LastError      string    `json:"last_error" bson:"last_error" firestore:"last_error"`
+	NextAttempt    time.Time `json:"next_attempt" bson:"next_attempt" firestore:"next_attempt"`
+	CreatedAt      time.Time `json:"created_at" bson:"created_at" firestore:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" bson:"updated_at" firestore:"updated_at"`
+	DeliveredAt    time.Time `json:"delivered_at" bson:"delivered_at" firestore:"delivered_at"`
+	Deleted        bool      `json:"deleted" bson:"deleted" firestore:"deleted"`
+}
+
+// New returns an empty Delivery with the ID
+func (d *Delivery) New(id string) crudley.Model {
+	return &Delivery{ID: id}
+}
+
+// GetName returns the collection name Deliveries are stored in
+func (d *Delivery) GetName() string {
+	return "webhook_deliveries"
+}
+
+// PrimaryKey returns the Delivery's ID
+func (d *Delivery) PrimaryKey() string {
+	return d.ID
+}
+
+// Delete marks the Delivery as deleted
+func (d *Delivery) Delete() {
+	d.Deleted = true
+}
+
+// IsDeleted returns true if the Delivery has been deleted
+func (d *Delivery) IsDeleted() bool {
+	return d.Deleted
+}
@@ -0,0 +1,478 @@
+// Package webhook delivers a Path's changes to registered HTTP endpoints. A
+// Dispatcher is a crudley.Observer, so it is added to a Path with
+// crudley.OptionObserver, and it records every delivery as a Model in a
+// crudley.Store. Deliveries left pending when a Dispatcher is closed are
+// resumed with Dispatcher.Resume, so each is delivered at least once.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arussellsaw/crudley"
+)
+
+// Headers set on webhook requests
+const (
+	SignatureHeader = "X-Crudley-Signature"
+	EventHeader     = "X-Crudley-Event"
+	DeliveryHeader  = "X-Crudley-Delivery"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Defaults for a Dispatcher
+const (
+	DefaultMaxAttempts = 8
+	DefaultBackoff     = time.Second
+	DefaultMaxBackoff  = time.Hour
+	DefaultTimeout     = 10 * time.Second
+)
+
+var (
+	// ErrorUnknownEndpoint is returned when redelivering to an Endpoint that is
+	// no longer registered
+	ErrorUnknownEndpoint = errors.New("webhook endpoint is not registered")
+	// ErrorInvalidSignature is returned by Verify when a signature doesn't match
+	ErrorInvalidSignature = errors.New("invalid webhook signature")
+	// ErrorSignatureExpired is returned by Verify when a signature is too old
+	ErrorSignatureExpired = errors.New("webhook signature has expired")
+)
+
+// Endpoint is a receiver for a Model's changes
+type Endpoint struct {
+	// ID identifies the Endpoint in Delivery records
+	ID string
+	// URL the events are POSTed to
+	URL string
+	// Events is the change types sent to the Endpoint, see crudley.ChangeCreated
+	// etc. All changes are sent if it is empty.
+	Events []string
+	// Filter only sends changes to Models matching the query parameters, in the
+	// same format as the Path's Query handler
+	Filter url.Values
+	// Secret signs the requests if set, see Verify
+	Secret string
+	// Roles are the roles the Endpoint reads Models with, fields that can't be
+	// read with them, such as writeonly and private fields, are left out of the
+	// events sent to it
+	Roles []string
+	// Tenant only sends changes made by the tenant, see crudley.WithTenant. Changes
+	// from all tenants are sent if it is empty.
+	Tenant string
+
+	filter *crudley.Filter
+}
+
+func (e *Endpoint) wants(ev crudley.ChangeEvent) bool {
+	if e.Tenant != "" && e.Tenant != ev.Tenant {
+		return false
+	}
+	if len(e.Events) > 0 {
+		var ok bool
+		for _, typ := range e.Events {
+			if typ == ev.Type {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return e.filter == nil || e.filter.Match(ev.Data)
+}
+
+// payload serializes ev without the fields of its Model the Endpoint can't read
+func (e *Endpoint) payload(ev crudley.ChangeEvent) ([]byte, error) {
+	ev.Data = crudley.Redact(ev.Data, e.Roles)
+	return json.Marshal(ev)
+}
+
+// Option configures a Dispatcher
+type Option func(d *Dispatcher)
+
+// OptionMaxAttempts sets how many times a delivery is attempted before it is
+// dead-lettered
+func OptionMaxAttempts(n int) Option {
+	return func(d *Dispatcher) {
+		d.MaxAttempts = n
+	}
+}
+
+// OptionBackoff sets the delay after the first failed attempt, which doubles for
+// each subsequent attempt up to max
+func OptionBackoff(initial, max time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.Backoff = initial
+		d.MaxBackoff = max
+	}
+}
+
+// OptionClient sets the http.Client used for deliveries
+func OptionClient(c *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.Client = c
+	}
+}
+
+// New returns a Dispatcher recording deliveries in s
+func New(s crudley.Store, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		Store:       s,
+		Client:      &http.Client{Timeout: DefaultTimeout},
+		MaxAttempts: DefaultMaxAttempts,
+		Backoff:     DefaultBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		endpoints:   make(map[string][]*Endpoint),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Dispatcher sends changes to the Endpoints registered for their Model,
+// retrying failed deliveries with exponential backoff. Deliveries that fail
+// MaxAttempts times are kept with StatusDead, and can be retried with Redeliver.
+type Dispatcher struct {
+	Store       crudley.Store
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+
+	mu        sync.RWMutex
+	endpoints map[string][]*Endpoint
+	wg        sync.WaitGroup
+	done      chan struct{}
+	closed    bool
+	closeOnce sync.Once
+}
+
+// Register adds an Endpoint for changes to m
+func (d *Dispatcher) Register(m crudley.Model, e Endpoint) error {
+	if e.ID == "" || e.URL == "" {
+		return fmt.Errorf("webhook endpoint requires an ID and URL")
+	}
+	if len(e.Filter) > 0 {
+		f, err := crudley.NewFilter(context.Background(), m, e.Filter)
+		if err != nil {
+			return fmt.Errorf("failed to build filter: %s", err)
+		}
+		e.filter = f
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	name := m.GetName()
+	for i, existing := range d.endpoints[name] {
+		if existing.ID == e.ID {
+			d.endpoints[name][i] = &e
+			return nil
+		}
+	}
+	d.endpoints[name] = append(d.endpoints[name], &e)
+	return nil
+}
+
+// Unregister removes an Endpoint for m, pending retries to it are dead-lettered
+func (d *Dispatcher) Unregister(m crudley.Model, id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	name := m.GetName()
+	endpoints := d.endpoints[name][:0]
+	for _, e := range d.endpoints[name] {
+		if e.ID != id {
+			endpoints = append(endpoints, e)
+		}
+	}
+	d.endpoints[name] = endpoints
+}
+
+func (d *Dispatcher) endpoint(model, id string) *Endpoint {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, e := range d.endpoints[model] {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// Observe records a Delivery for each Endpoint that wants the event, and starts
+// delivering them in the background. It does nothing once the Dispatcher is
+// closed.
+func (d *Dispatcher) Observe(ctx context.Context, ev crudley.ChangeEvent) {
+	d.mu.RLock()
+	if d.closed {
+		d.mu.RUnlock()
+		return
+	}
+	var endpoints []*Endpoint
+	for _, e := range d.endpoints[ev.Model] {
+		if e.wants(ev) {
+			endpoints = append(endpoints, e)
+		}
+	}
+	d.mu.RUnlock()
+	if len(endpoints) == 0 {
+		return
+	}
+	c, err := d.Store.Collection(&Delivery{})
+	if err != nil {
+		return
+	}
+	for _, e := range endpoints {
+		payload, err := e.payload(ev)
+		if err != nil {
+			continue
+		}
+		var dl *Delivery
+		err = c.Create(ctx, func(id string) (crudley.Model, error) {
+			dl = &Delivery{
+				ID:        id,
+				Endpoint:  e.ID,
+				URL:       e.URL,
+				Model:     ev.Model,
+				ModelID:   ev.ID,
+				Event:     ev.Type,
+				Payload:   payload,
+				Status:    StatusPending,
+				CreatedAt: time.Now(),
+			}
+			return dl, nil
+		})
+		if err != nil {
+			continue
+		}
+		d.start(c, dl)
+	}
+}
+
+// Redeliver resets a dead-lettered Delivery and starts delivering it again
+func (d *Dispatcher) Redeliver(ctx context.Context, id string) error {
+	c, err := d.Store.Collection(&Delivery{})
+	if err != nil {
+		return err
+	}
+	m, err := c.View(ctx, id)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return crudley.NotFoundError(fmt.Sprintf("delivery %s not found", id))
+	}
+	dl := m.(*Delivery)
+	if dl.Status != StatusDead {
+		return fmt.Errorf("delivery %s is %s", id, dl.Status)
+	}
+	if d.endpoint(dl.Model, dl.Endpoint) == nil {
+		return ErrorUnknownEndpoint
+	}
+	dl.Status = StatusPending
+	dl.Attempts = 0
+	err = c.Update(ctx, id, dl)
+	if err != nil {
+		return err
+	}
+	d.start(c, dl)
+	return nil
+}
+
+// Resume starts delivering the Deliveries left pending when a Dispatcher was
+// closed or its process stopped, each is attempted when its next attempt is due.
+// It should be called once, after the Endpoints are registered and before the
+// Dispatcher observes any changes, as it also picks up Deliveries in flight.
+func (d *Dispatcher) Resume(ctx context.Context) error {
+	c, err := d.Store.Collection(&Delivery{})
+	if err != nil {
+		return err
+	}
+	q := c.Query()
+	q.Equal("status", StatusPending)
+	pending, err := q.Execute(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		dl, ok := m.(*Delivery)
+		if !ok || dl.Status != StatusPending {
+			continue
+		}
+		d.start(c, dl)
+	}
+	return nil
+}
+
+// Close stops retrying deliveries, and waits for in flight requests to finish.
+// Deliveries that were waiting to be retried are left pending, see Resume.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	d.closeOnce.Do(func() {
+		close(d.done)
+	})
+	d.wg.Wait()
+}
+
+// start delivers dl in the background, unless the Dispatcher is closed, in which
+// case dl is left pending
+func (d *Dispatcher) start(c crudley.Collection, dl *Delivery) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.deliver(c, dl)
+	}()
+}
+
+// deliver attempts dl until it succeeds, is dead-lettered, or the Dispatcher is
+// closed
+func (d *Dispatcher) deliver(c crudley.Collection, dl *Delivery) {
+	ctx := context.Background()
+	for {
+		if wait := time.Until(dl.NextAttempt); wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-d.done:
+				t.Stop()
+				return
+			}
+		}
+		e := d.endpoint(dl.Model, dl.Endpoint)
+		if e == nil {
+			dl.Status = StatusDead
+			dl.LastError = ErrorUnknownEndpoint.Error()
+			c.Update(ctx, dl.ID, dl)
+			return
+		}
+		dl.Attempts++
+		dl.UpdatedAt = time.Now()
+		dl.ResponseStatus, dl.LastError = 0, ""
+		status, err := d.send(ctx, e, dl)
+		dl.ResponseStatus = status
+		if err == nil {
+			dl.Status = StatusDelivered
+			dl.DeliveredAt = time.Now()
+			c.Update(ctx, dl.ID, dl)
+			return
+		}
+		dl.LastError = err.Error()
+		if dl.Attempts >= d.MaxAttempts {
+			dl.Status = StatusDead
+			dl.NextAttempt = time.Time{}
+			c.Update(ctx, dl.ID, dl)
+			return
+		}
+		dl.NextAttempt = time.Now().Add(d.backoff(dl.Attempts))
+		c.Update(ctx, dl.ID, dl)
+	}
+}
+
+// backoff returns the delay after the nth failed attempt
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.Backoff
+	for i := 1; i < attempt; i++ {
+		wait *= 2
+		if wait >= d.MaxBackoff {
+			return d.MaxBackoff
+		}
+	}
+	return wait
+}
+
+func (d *Dispatcher) send(ctx context.Context, e *Endpoint, dl *Delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, e.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, dl.Event)
+	req.Header.Set(DeliveryHeader, dl.ID)
+	if e.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(e.Secret, time.Now(), dl.Payload))
+	}
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// Sign returns the SignatureHeader value for body, in the form
+// t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, signature(secret, ts, body))
+}
+
+func signature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a SignatureHeader value for body, rejecting signatures older
+// than tolerance if it is non zero. Receivers should use it to authenticate
+// deliveries.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			sig = kv[1]
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return ErrorInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, ts, body))) {
+		return ErrorInvalidSignature
+	}
+	if tolerance > 0 && time.Since(time.Unix(unix, 0)) > tolerance {
+		return ErrorSignatureExpired
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package webhook_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arussellsaw/crudley"
+	"github.com/arussellsaw/crudley/stores/mem"
+	"github.com/arussellsaw/crudley/testutil/model"
+	"github.com/arussellsaw/crudley/webhook"
+)
+
+type receiver struct {
+	sync.Mutex
+	fail   int
+	events []crudley.ChangeEvent
+	errors []error
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.Lock()
+	defer rc.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	if err := webhook.Verify("secret", r.Header.Get(webhook.SignatureHeader), body, time.Minute); err != nil {
+		rc.errors = append(rc.errors, err)
+	}
+	if rc.fail > 0 {
+		rc.fail--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var ev crudley.ChangeEvent
+	ev.Data = &model.TestModel{}
+	json.Unmarshal(body, &ev)
+	rc.events = append(rc.events, ev)
+}
+
+// waitForDeliveries polls s until n Deliveries are no longer pending
+func waitForDeliveries(t *testing.T, s crudley.Store, n int) []*webhook.Delivery {
+	c, err := s.Collection(&webhook.Delivery{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var done []*webhook.Delivery
+		err := c.Scan(context.Background(), func(m crudley.Model) error {
+			if d := m.(*webhook.Delivery); d.Status != webhook.StatusPending {
+				done = append(done, d)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		if len(done) >= n {
+			return done
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %v deliveries", n)
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	rc := &receiver{fail: 2}
+	hook := httptest.NewServer(rc)
+	defer hook.Close()
+
+	s := mem.NewStore()
+	d := webhook.New(s, webhook.OptionBackoff(time.Millisecond, 4*time.Millisecond))
+	defer d.Close()
+	err := d.Register(&model.TestModel{}, webhook.Endpoint{
+		ID:     "test",
+		URL:    hook.URL,
+		Events: []string{crudley.ChangeCreated},
+		Filter: url.Values{"owner": {"foo"}},
+		Secret: "secret",
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+
+	p := crudley.NewPath(&model.TestModel{}, s, crudley.OptionObserver(d))
+	api := httptest.NewServer(http.StripPrefix("/api/test", p))
+	defer api.Close()
+	for _, body := range []string{
+		`{"string_val": "filtered", "owner": "bar"}`,
+		`{"string_val": "sent", "owner": "foo"}`,
+	} {
+		res, err := http.Post(api.URL+"/api/test/", "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+		res.Body.Close()
+	}
+
+	deliveries := waitForDeliveries(t, s, 1)
+	if len(deliveries) != 1 {
+		t.Fatalf("expected 1 delivery, got %v", len(deliveries))
+	}
+	dl := deliveries[0]
+	if dl.Status != webhook.StatusDelivered || dl.Attempts != 3 || dl.ResponseStatus != http.StatusOK {
+		t.Errorf("expected delivered on attempt 3, got %+v", dl)
+	}
+	rc.Lock()
+	defer rc.Unlock()
+	if len(rc.errors) != 0 {
+		t.Errorf("expected valid signatures, got %v", rc.errors)
+	}
+	if len(rc.events) != 1 || rc.events[0].Data.(*model.TestModel).StringVal != "sent" {
+		t.Errorf("expected created event for sent, got %+v", rc.events)
+	}
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	rc := &receiver{fail: 3}
+	hook := httptest.NewServer(rc)
+	defer hook.Close()
+
+	s := mem.NewStore()
+	d := webhook.New(s, webhook.OptionMaxAttempts(2), webhook.OptionBackoff(time.Millisecond, time.Millisecond))
+	defer d.Close()
+	err := d.Register(&model.TestModel{}, webhook.Endpoint{ID: "test", URL: hook.URL, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	d.Observe(context.Background(), crudley.ChangeEvent{
+		Type:  crudley.ChangeDeleted,
+		Model: (&model.TestModel{}).GetName(),
+		ID:    "1",
+		Data:  &model.TestModel{ID: "1"},
+	})
+
+	dl := waitForDeliveries(t, s, 1)[0]
+	if dl.Status != webhook.StatusDead || dl.Attempts != 2 || dl.ResponseStatus != http.StatusServiceUnavailable {
+		t.Fatalf("expected dead after 2 attempts, got %+v", dl)
+	}
+
+	err = d.Redeliver(context.Background(), dl.ID)
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	dl = waitForDeliveries(t, s, 1)[0]
+	if dl.Status != webhook.StatusDelivered || dl.Attempts != 2 {
+		t.Errorf("expected delivered on attempt 2, got %+v", dl)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	sig := webhook.Sign("secret", time.Now(), body)
+	if err := webhook.Verify("secret", sig, body, time.Minute); err != nil {
+		t.Errorf("expected nil, got %s", err)
+	}
+	if err := webhook.Verify("other", sig, body, time.Minute); err != webhook.ErrorInvalidSignature {
+		t.Errorf("expected %s, got %v", webhook.ErrorInvalidSignature, err)
+	}
+	old := webhook.Sign("secret", time.Now().Add(-time.Hour), body)
+	if err := webhook.Verify("secret", old, body, time.Minute); err != webhook.ErrorSignatureExpired {
+		t.Errorf("expected %s, got %v", webhook.ErrorSignatureExpired, err)
+	}
+}
+
+type account struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Password string `json:"password" rest:"writeonly"`
+	Notes    string `json:"notes" rest:"read=admin"`
+	Deleted  bool   `json:"deleted"`
+}
+
+func (a *account) New(id string) crudley.Model { return &account{ID: id} }
+func (a *account) GetName() string             { return "accounts" }
+func (a *account) PrimaryKey() string          { return a.ID }
+func (a *account) Delete()                     { a.Deleted = true }
+func (a *account) IsDeleted() bool             { return a.Deleted }
+
+func TestDispatcherRedacts(t *testing.T) {
+	bodies := make(chan map[string]interface{}, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.NewDecoder(r.Body).Decode(&ev)
+		bodies <- ev.Data
+	}))
+	defer hook.Close()
+
+	d := webhook.New(mem.NewStore())
+	defer d.Close()
+	for _, e := range []webhook.Endpoint{
+		{ID: "public", URL: hook.URL},
+		{ID: "admin", URL: hook.URL, Roles: []string{"admin"}},
+	} {
+		if err := d.Register(&account{}, e); err != nil {
+			t.Fatalf("expected nil, got %s", err)
+		}
+	}
+	d.Observe(context.Background(), crudley.ChangeEvent{
+		Type:  crudley.ChangeCreated,
+		Model: "accounts",
+		ID:    "1",
+		Data:  &account{ID: "1", Name: "alice", Password: "hunter2", Notes: "n"},
+	})
+
+	var withNotes int
+	for i := 0; i < 2; i++ {
+		select {
+		case data := <-bodies:
+			if _, ok := data["password"]; ok || data["name"] != "alice" {
+				t.Errorf("expected name without password, got %v", data)
+			}
+			if _, ok := data["notes"]; ok {
+				withNotes++
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for deliveries")
+		}
+	}
+	if withNotes != 1 {
+		t.Errorf("expected notes only for the admin endpoint, got %v", withNotes)
+	}
+}
+
+func TestDispatcherResume(t *testing.T) {
+	rc := &receiver{}
+	hook := httptest.NewServer(rc)
+	defer hook.Close()
+
+	s := mem.NewStore()
+	c, err := s.Collection(&webhook.Delivery{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	// left pending by a previous Dispatcher
+	err = c.Create(context.Background(), func(id string) (crudley.Model, error) {
+		return &webhook.Delivery{
+			ID:          id,
+			Endpoint:    "test",
+			URL:         hook.URL,
+			Model:       (&model.TestModel{}).GetName(),
+			ModelID:     "1",
+			Event:       crudley.ChangeCreated,
+			Payload:     []byte(`{"type":"created","id":"1","data":{"id":"1"}}`),
+			Status:      webhook.StatusPending,
+			Attempts:    1,
+			NextAttempt: time.Now().Add(10 * time.Millisecond),
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+
+	d := webhook.New(s)
+	defer d.Close()
+	err = d.Register(&model.TestModel{}, webhook.Endpoint{ID: "test", URL: hook.URL, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	err = d.Resume(context.Background())
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	dl := waitForDeliveries(t, s, 1)[0]
+	if dl.Status != webhook.StatusDelivered || dl.Attempts != 2 {
+		t.Errorf("expected delivered on attempt 2, got %+v", dl)
+	}
+}
+
+func TestDispatcherTenant(t *testing.T) {
+	rc := &receiver{}
+	hook := httptest.NewServer(rc)
+	defer hook.Close()
+
+	s := mem.NewStore()
+	d := webhook.New(s)
+	defer d.Close()
+	err := d.Register(&model.TestModel{}, webhook.Endpoint{ID: "test", URL: hook.URL, Secret: "secret", Tenant: "acme"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	for _, tenant := range []string{"other", "acme"} {
+		d.Observe(context.Background(), crudley.ChangeEvent{
+			Type:   crudley.ChangeCreated,
+			Model:  (&model.TestModel{}).GetName(),
+			Tenant: tenant,
+			ID:     tenant,
+			Data:   &model.TestModel{StringVal: tenant},
+		})
+	}
+
+	deliveries := waitForDeliveries(t, s, 1)
+	if len(deliveries) != 1 || deliveries[0].ModelID != "acme" {
+		t.Errorf("expected 1 delivery for acme, got %+v", deliveries)
+	}
+}
+
+func TestDispatcherClosed(t *testing.T) {
+	s := mem.NewStore()
+	d := webhook.New(s)
+	err := d.Register(&model.TestModel{}, webhook.Endpoint{ID: "test", URL: "http://localhost"})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	d.Close()
+	d.Observe(context.Background(), crudley.ChangeEvent{
+		Type:  crudley.ChangeCreated,
+		Model: (&model.TestModel{}).GetName(),
+		ID:    "1",
+		Data:  &model.TestModel{},
+	})
+
+	c, err := s.Collection(&webhook.Delivery{})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	var n int
+	err = c.Scan(context.Background(), func(crudley.Model) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+	if n != 0 {
+		t.Errorf("expected no deliveries after close, got %v", n)
+	}
+}